@@ -5,18 +5,26 @@ import (
 	"net/http"
 	"runtime"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
 	"github.com/cloudradar-monitoring/selfupdate"
 
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/docker"
 	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/fs"
 	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/networking"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/portpolicy"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/processes"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/procwatch"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/psi"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/rules"
 	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/sensors"
 	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/updates"
 	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/vmstat"
 	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/vmstat/types"
+	"github.com/cloudradar-monitoring/cagent/pkg/outbox"
 	"github.com/cloudradar-monitoring/cagent/pkg/smart"
 )
 
@@ -32,21 +40,47 @@ type Cagent struct {
 	Config         *Config
 	ConfigLocation string
 
+	// configMu is held for writing while the config is reloaded
+	configMu sync.RWMutex
+
 	selfUpdater *selfupdate.Updater
 
 	hubClient     *http.Client
 	hubClientOnce sync.Once
 
+	outbox *outbox.Outbox
+
+	prometheusExporter *prometheusExporter
+
+	statusAPI  *statusAPI
+	runState   runState
+	collectNow chan struct{}
+
 	cpuWatcher             *CPUWatcher
 	cpuUtilisationAnalyser *CPUUtilisationAnalyser
 
-	fsWatcher  *fs.FileSystemWatcher
-	netWatcher *networking.NetWatcher
+	fsWatcher     *fs.FileSystemWatcher
+	netWatcher    *networking.NetWatcher
+	dockerWatcher *docker.Watcher
+	psiWatcher    *psi.Watcher
 
 	vmstatLazyInit sync.Once
 	vmWatchers     map[string]types.Provider
 	hwInventory    sync.Once
 	smart          *smart.SMART
+
+	modules []namedModule
+
+	rulesEngine *rules.Engine
+	portsPolicy *portpolicy.Policy
+	watchlist   *procwatch.Watchlist
+
+	// schedule keeps track of when each collector and module ran the last time
+	schedule collectorSchedule
+
+	// the process list is shared with the listening ports collector
+	lastProcessListMu sync.Mutex
+	lastProcessList   []*processes.ProcStat
 }
 
 func New(cfg *Config, cfgPath string) (*Cagent, error) {
@@ -54,7 +88,9 @@ func New(cfg *Config, cfgPath string) (*Cagent, error) {
 		Config:         cfg,
 		ConfigLocation: cfgPath,
 		vmWatchers:     make(map[string]types.Provider),
+		collectNow:     make(chan struct{}, 1),
 	}
+	ca.runState.startedAt = time.Now()
 
 	ca.configureLogger()
 
@@ -75,6 +111,15 @@ func New(cfg *Config, cfgPath string) (*Cagent, error) {
 	return ca, nil
 }
 
+// currentConfig returns the config in force. A reload swaps the config instead of changing it,
+// so the returned config can be read after the lock is released
+func (ca *Cagent) currentConfig() *Config {
+	ca.configMu.RLock()
+	defer ca.configMu.RUnlock()
+
+	return ca.Config
+}
+
 func (ca *Cagent) configureAutomaticSelfUpdates() error {
 	if !ca.Config.Updates.Enabled {
 		return nil
@@ -114,6 +159,16 @@ func (ca *Cagent) Shutdown() {
 		}
 	}()
 
+	if ca.prometheusExporter != nil {
+		ca.prometheusExporter.shutdown()
+	}
+
+	closeModules(ca.modules)
+
+	if ca.statusAPI != nil {
+		ca.statusAPI.shutdown()
+	}
+
 	for name, p := range ca.vmWatchers {
 		if err := vmstat.Release(p); err != nil {
 			logrus.WithFields(logrus.Fields{
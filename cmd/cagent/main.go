@@ -6,6 +6,7 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/exec"
 	"os/signal"
@@ -132,7 +133,7 @@ func main() {
 	handleFlagTest(*testConfigPtr, ca)
 	handleFlagSettings(settingsPtr, ca)
 
-	if len(*outputFilePtr) == 0 && cfg.IOMode == cagent.IOModeFile {
+	if len(*outputFilePtr) == 0 && cfg.IOMode == cagent.IOModeFile && len(cfg.Outputs) == 0 {
 		*outputFilePtr = cfg.OutFile
 	}
 
@@ -167,14 +168,22 @@ func main() {
 	// setup interrupt handler
 	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc,
-		syscall.SIGHUP,
 		syscall.SIGINT,
 		syscall.SIGTERM)
+	handleReloadSignal(ca)
 	heartbeatInterruptChan := make(chan struct{})
 	interruptChan := make(chan struct{})
 
 	defer ca.Shutdown()
 
+	if err := ca.StartPrometheusExporter(); err != nil {
+		log.WithError(err).Fatalln("Failed to start the prometheus exporter")
+	}
+
+	if err := ca.StartStatusAPI(); err != nil {
+		log.WithError(err).Error()
+	}
+
 	go ca.RunHeartbeat(heartbeatInterruptChan)
 	if ca.Config.OperationMode != cagent.OperationModeHeartbeat {
 		go ca.Run(output, interruptChan)
@@ -189,6 +198,21 @@ func main() {
 	heartbeatInterruptChan <- struct{}{}
 }
 
+// handleReloadSignal reloads the config on SIGHUP
+func handleReloadSignal(ca *cagent.Cagent) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	go func() {
+		for range sighup {
+			log.Infof("SIGHUP received, reloading config from %s", ca.ConfigLocation)
+			if err := ca.ReloadConfig(); err != nil {
+				log.WithError(err).Error("failed to reload config")
+			}
+		}
+	}()
+}
+
 func handleFlagVersion(versionFlag bool) {
 	if versionFlag {
 		fmt.Printf("cagent v%s %s\n", cagent.Version, cagent.LicenseInfo)
@@ -266,6 +290,7 @@ func handleServiceCommand(ca *cagent.Cagent, check, start, stop, restart bool) {
 func handleFlagPrintConfig(printConfig bool, cfg *cagent.Config) {
 	if printConfig {
 		fmt.Println(cfg.DumpToml())
+		fmt.Println(cfg.DumpSources())
 		os.Exit(0)
 	}
 }
@@ -566,6 +591,22 @@ func handleFlagTest(testConfig bool, ca *cagent.Cagent) {
 		os.Exit(0)
 	}
 
+	if ca.Config.IOMode == cagent.IOModePrometheus {
+		localFields := log.Fields{
+			"listen": ca.Config.Prometheus.Listen,
+			"ioMode": ca.Config.IOMode,
+		}
+		listener, err := net.Listen("tcp", ca.Config.Prometheus.Listen)
+		if err != nil {
+			fmt.Printf("Failed to validate config %+v: %s\n", localFields, err.Error())
+			os.Exit(1)
+		}
+		listener.Close()
+		fmt.Printf("Config verified! %+v\n", localFields)
+
+		os.Exit(0)
+	}
+
 	ctx := context.Background()
 	err := ca.CheckHubCredentials(ctx, "hub_url", "hub_user", "hub_password")
 	if err != nil {
@@ -644,6 +685,15 @@ func (sw *serviceWrapper) Start(s service.Service) error {
 
 	log.Errorf("cagent v%s starting in service mode...", cagent.Version)
 
+	if err := sw.Cagent.StartPrometheusExporter(); err != nil {
+		return err
+	}
+
+	if err := sw.Cagent.StartStatusAPI(); err != nil {
+		log.WithError(err).Error()
+	}
+	handleReloadSignal(sw.Cagent)
+
 	sw.WG.Add(1)
 	go func() {
 		defer sw.WG.Done()
@@ -0,0 +1,472 @@
+package cagent
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/mem"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+	"github.com/cloudradar-monitoring/cagent/pkg/hwinfo"
+	"github.com/cloudradar-monitoring/cagent/pkg/jobmon"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/docker"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/networking"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/processes"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/procwatch"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/sensors"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/services"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/updates"
+)
+
+// collector gathers one section of the measurements. The keys of the result are final, e.g. "cpu.load.avg.1".
+// Module reports returned under the "modules" key are appended to the reports of the other collectors
+type collector struct {
+	name string
+	// minimal collectors run in all operation modes, the others only in the full mode
+	minimal bool
+	// interval and timeout override collector_intervals and collector_timeouts if set, e.g. for the modules
+	interval time.Duration
+	timeout  time.Duration
+	// after lists the collectors which results are needed, the collector waits for them if they run in the same round
+	after   []string
+	enabled func(cfg *Config) bool
+	collect func(ca *Cagent, cleanup *cleanupCommand) (common.MeasurementsMap, error)
+}
+
+// collectors are executed in the order of the list
+var collectors = []collector{
+	{
+		name:    "cpu",
+		minimal: true,
+		enabled: func(cfg *Config) bool { return cfg.CPUMonitoring },
+		collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+			res, err := ca.CPUWatcher().Results()
+			return common.MeasurementsMap{}.AddWithPrefix("cpu.", res), err
+		},
+	},
+	{
+		name:    "fs",
+		minimal: true,
+		enabled: func(cfg *Config) bool { return cfg.FSMonitoring },
+		collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+			res, err := ca.GetFileSystemWatcher().Results()
+			return common.MeasurementsMap{}.AddWithPrefix("fs.", res), err
+		},
+	},
+	{
+		name:    "mem",
+		minimal: true,
+		enabled: func(cfg *Config) bool { return cfg.MemMonitoring },
+		collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+			res, _, err := ca.MemResults()
+			return common.MeasurementsMap{}.AddWithPrefix("mem.", res), err
+		},
+	},
+	{
+		name:    "psi",
+		enabled: func(cfg *Config) bool { return cfg.PSIMonitoring.Enabled },
+		collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+			res, err := ca.PSIWatcher().Results()
+			return common.MeasurementsMap{}.AddWithPrefix("psi.", res), err
+		},
+	},
+	{
+		name:    "cpu_utilisation_analysis",
+		minimal: true,
+		// the analyser is attached to the CPU watcher
+		after:   []string{"cpu"},
+		enabled: func(cfg *Config) bool { return cfg.CPUMonitoring },
+		collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+			res, isActive, err := ca.CPUUtilisationAnalyser().Results()
+			m := common.MeasurementsMap{}.AddWithPrefix("cpu_utilisation_analysis.", res)
+			if isActive {
+				m["cpu_utilisation_analysis.settings"] = ca.Config.CPUUtilisationAnalysis
+			}
+			return m, err
+		},
+	},
+	{
+		name: "system",
+		collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+			errs := common.ErrorCollector{}
+			info, err := ca.HostInfoResults()
+			errs.Add(err)
+			ipResults, err := networking.IPAddresses()
+			errs.Add(err)
+			return common.MeasurementsMap{}.AddWithPrefix("system.", info).AddWithPrefix("system.", ipResults), errs.Combine()
+		},
+	},
+	{
+		name:    "net",
+		enabled: func(cfg *Config) bool { return cfg.NetMonitoring },
+		collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+			res, err := ca.GetNetworkWatcher().Results()
+			return common.MeasurementsMap{}.AddWithPrefix("net.", res), err
+		},
+	},
+	{
+		name: "processes",
+		collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+			memStat, err := mem.VirtualMemory()
+			if err != nil {
+				log.WithError(err).Debug("processes: failed to get virtual memory stat")
+				memStat = nil
+			}
+			res, processList, err := processes.GetMeasurements(memStat, &ca.Config.ProcessMonitoring)
+			if processList != nil {
+				ca.setLastProcessList(processList)
+			}
+			m := common.MeasurementsMap{}.AddWithPrefix("proc.", res)
+			if processList != nil && len(ca.Config.ProcessWatchlist) > 0 {
+				m["modules"] = []*monitoring.ModuleReport{ca.evaluateWatchlist(processList)}
+			}
+			return m, err
+		},
+	},
+	{
+		name:  "listeningports",
+		after: []string{"processes"},
+		collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+			// the program names are taken from the most recent process list
+			res, err := ca.PortsResult(ca.getLastProcessList())
+			return common.MeasurementsMap{}.AddWithPrefix("listeningports.", res), err
+		},
+	},
+	{
+		name:    "swap",
+		enabled: func(cfg *Config) bool { return cfg.MemMonitoring },
+		collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+			res, err := ca.SwapResults()
+			return common.MeasurementsMap{}.AddWithPrefix("swap.", res), err
+		},
+	},
+	{
+		name: "virt",
+		collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+			m := common.MeasurementsMap{}
+			errs := common.ErrorCollector{}
+			ca.getVMStatMeasurements(func(name string, meas common.MeasurementsMap, err error) {
+				if err == nil {
+					m = m.AddWithPrefix("virt."+name+".", meas)
+				}
+				errs.Add(err)
+			})
+			return m, errs.Combine()
+		},
+	},
+	{
+		name: "hw_inventory",
+		collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+			m := common.MeasurementsMap{}
+			var err error
+			// the inventory is sent only once
+			ca.hwInventory.Do(func() {
+				var hwInfo map[string]interface{}
+				hwInfo, err = hwinfo.Inventory()
+				if hwInfo != nil {
+					m = m.AddInnerWithPrefix("hw.inventory", hwInfo)
+				}
+			})
+			return m, err
+		},
+	},
+	{
+		name: "updates",
+		enabled: func(cfg *Config) bool {
+			return cfg.SystemUpdatesChecks.Enabled && cfg.SystemUpdatesChecks.CheckInterval > 0
+		},
+		collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+			cfg := ca.Config.SystemUpdatesChecks
+			watcher := updates.GetWatcher(cfg.FetchTimeout, cfg.CheckInterval)
+			u, err := watcher.GetSystemUpdatesInfo()
+			if err == updates.ErrorDisabledOnHost {
+				return nil, nil
+			}
+			prefix := "linux_update."
+			if runtime.GOOS == "windows" {
+				prefix = "windows_update."
+			}
+			return common.MeasurementsMap{}.AddWithPrefix(prefix, u), err
+		},
+	},
+	{
+		name: "services",
+		collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+			servicesList, err := services.ListServices(ca.Config.DiscoverAutostartingServicesOnly)
+			if err == services.ErrorNotImplementedForOS {
+				err = nil
+			}
+			return common.MeasurementsMap{}.AddWithPrefix("services.", servicesList), err
+		},
+	},
+	{
+		name:    "docker",
+		enabled: func(cfg *Config) bool { return cfg.DockerMonitoring.Enabled },
+		collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+			containersList, report, err := ca.DockerWatcher().ListContainers()
+			if err == docker.ErrorNotImplementedForOS || err == docker.ErrorDockerNotAvailable {
+				err = nil
+			}
+			m := common.MeasurementsMap{}.AddWithPrefix("docker.", containersList)
+			if report != nil {
+				m["modules"] = []*monitoring.ModuleReport{report}
+			}
+			return m, err
+		},
+	},
+	{
+		name:    "temperatures",
+		enabled: func(cfg *Config) bool { return cfg.TemperatureMonitoring },
+		collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+			temperatures, err := sensors.ReadTemperatureSensors()
+			return common.MeasurementsMap{"temperatures.list": temperatures}, err
+		},
+	},
+	{
+		name: "smartmon",
+		collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+			smartMeas := ca.getSMARTMeasurements()
+			if len(smartMeas) == 0 {
+				return nil, nil
+			}
+			return common.MeasurementsMap{}.AddInnerWithPrefix("smartmon", smartMeas), nil
+		},
+	},
+	{
+		name: "jobmon",
+		collect: func(ca *Cagent, cleanup *cleanupCommand) (common.MeasurementsMap, error) {
+			spool := jobmon.NewSpoolManager(ca.Config.JobMonitoring.SpoolDirPath, log.StandardLogger())
+			ids, jobs, err := spool.GetFinishedJobs()
+			cleanup.AddStep(func() error {
+				return spool.RemoveJobs(ids)
+			})
+			return common.MeasurementsMap{"jobmon": jobs}, err
+		},
+	},
+}
+
+// CollectorNames returns the names of all collectors which can be used in collector_intervals.
+// "modules" sets the interval and the timeout of all modules
+func CollectorNames() []string {
+	names := make([]string, 0, len(collectors)+1)
+	for _, c := range collectors {
+		names = append(names, c.name)
+	}
+	return append(names, modulesCollectorName)
+}
+
+// collectorResult is the outcome of a single collector run
+type collectorResult struct {
+	name         string
+	measurements common.MeasurementsMap
+	cleanup      *cleanupCommand
+	err          error
+	duration     time.Duration
+}
+
+// runCollectors executes the collectors concurrently and returns their results in the same order.
+// A collector which doesn't finish within its timeout is left running in the background, its results are discarded.
+// now is recorded as the time of the run for the collectors which are started
+func (ca *Cagent) runCollectors(list []collector, now time.Time) []*collectorResult {
+	done := make(map[string]chan struct{}, len(list))
+	for _, c := range list {
+		done[c.name] = make(chan struct{})
+	}
+
+	results := make([]*collectorResult, len(list))
+	wg := sync.WaitGroup{}
+	for i, c := range list {
+		wg.Add(1)
+		go func(i int, c collector) {
+			defer wg.Done()
+			defer close(done[c.name])
+			results[i] = ca.runCollector(c, done, now)
+		}(i, c)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func (ca *Cagent) runCollector(c collector, done map[string]chan struct{}, now time.Time) *collectorResult {
+	timeout := c.timeout
+	if timeout == 0 {
+		timeout = ca.collectorTimeout(c.name)
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	startedAt := time.Now()
+	timedOut := &collectorResult{
+		name:     c.name,
+		err:      errors.Errorf("collector '%s' timed out after %v", c.name, timeout),
+		duration: timeout,
+	}
+
+	for _, name := range c.after {
+		if ch, exists := done[name]; exists {
+			select {
+			case <-ch:
+			case <-timer.C:
+				return timedOut
+			}
+		}
+	}
+
+	if !ca.schedule.start(c.name, now) {
+		return &collectorResult{
+			name: c.name,
+			err:  errors.Errorf("collector '%s' is still running since a previous timeout", c.name),
+		}
+	}
+
+	resultChan := make(chan *collectorResult, 1)
+	go func() {
+		defer ca.schedule.finish(c.name)
+
+		cleanup := &cleanupCommand{}
+		measurements, err := c.collect(ca, cleanup)
+		resultChan <- &collectorResult{
+			name:         c.name,
+			measurements: measurements,
+			cleanup:      cleanup,
+			err:          err,
+			duration:     time.Since(startedAt),
+		}
+	}()
+
+	select {
+	case res := <-resultChan:
+		return res
+	case <-timer.C:
+		log.Warnf("collector '%s' timed out after %v", c.name, timeout)
+		return timedOut
+	}
+}
+
+// collectorSchedule keeps the time of the last run for collectors and modules
+// and the collectors which are still running
+type collectorSchedule struct {
+	mu        sync.Mutex
+	lastRunAt map[string]time.Time
+	running   map[string]bool
+}
+
+// start marks the collector as running and records the time of the run.
+// It returns false if it's running already, then the collector stays due
+func (s *collectorSchedule) start(name string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running == nil {
+		s.running = make(map[string]bool)
+	}
+	if s.lastRunAt == nil {
+		s.lastRunAt = make(map[string]time.Time)
+	}
+
+	if s.running[name] {
+		return false
+	}
+
+	s.running[name] = true
+	s.lastRunAt[name] = now
+	return true
+}
+
+func (s *collectorSchedule) finish(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.running, name)
+}
+
+// waitIdle waits until none of the collectors is running, at most for the timeout.
+// It returns the names of the collectors which are still running
+func (s *collectorSchedule) waitIdle(timeout time.Duration) []string {
+	deadline := time.Now().Add(timeout)
+	for {
+		s.mu.Lock()
+		var running []string
+		for name := range s.running {
+			running = append(running, name)
+		}
+		s.mu.Unlock()
+
+		if len(running) == 0 || !time.Now().Before(deadline) {
+			sort.Strings(running)
+			return running
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// due reports whether the collector with the name should run now according to its interval
+func (s *collectorSchedule) due(name string, interval time.Duration, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last, exists := s.lastRunAt[name]
+	return !exists || now.Sub(last) >= interval
+}
+
+// collectorInterval returns the interval configured for the collector or module with the name
+// falling back to the global interval
+func (ca *Cagent) collectorInterval(name string) time.Duration {
+	if interval, exists := ca.Config.CollectorIntervals[name]; exists && interval > 0 {
+		return secToDuration(interval)
+	}
+	return secToDuration(ca.Config.Interval)
+}
+
+// collectorTimeout returns the time limit for the collector with the name
+func (ca *Cagent) collectorTimeout(name string) time.Duration {
+	if timeout, exists := ca.Config.CollectorTimeouts[name]; exists && timeout > 0 {
+		return secToDuration(timeout)
+	}
+	return secToDuration(ca.Config.CollectorTimeout)
+}
+
+// collectionTick returns how often the main loop wakes up, that's the shortest of all intervals
+func (ca *Cagent) collectionTick() time.Duration {
+	tick := secToDuration(ca.Config.Interval)
+	intervals := ca.checkIntervals()
+	for _, interval := range ca.Config.CollectorIntervals {
+		intervals = append(intervals, interval)
+	}
+
+	for _, interval := range intervals {
+		if d := secToDuration(interval); d > 0 && d < tick {
+			tick = d
+		}
+	}
+	return tick
+}
+
+func (ca *Cagent) setLastProcessList(list []*processes.ProcStat) {
+	ca.lastProcessListMu.Lock()
+	defer ca.lastProcessListMu.Unlock()
+
+	ca.lastProcessList = list
+}
+
+func (ca *Cagent) getLastProcessList() []*processes.ProcStat {
+	ca.lastProcessListMu.Lock()
+	defer ca.lastProcessListMu.Unlock()
+
+	return ca.lastProcessList
+}
+
+// evaluateWatchlist checks the watched processes against the process list
+func (ca *Cagent) evaluateWatchlist(list []*processes.ProcStat) *monitoring.ModuleReport {
+	if ca.watchlist == nil {
+		ca.watchlist = procwatch.NewWatchlist(ca.Config.ProcessWatchlist)
+	}
+
+	return ca.watchlist.Evaluate(list, time.Now())
+}
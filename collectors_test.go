@@ -0,0 +1,146 @@
+package cagent
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+)
+
+func TestCollectorSchedule(t *testing.T) {
+	s := collectorSchedule{}
+	now := time.Now()
+
+	assert.True(t, s.due("cpu", 10*time.Second, now), "never ran before")
+	assert.True(t, s.start("cpu", now))
+	assert.False(t, s.due("cpu", 10*time.Second, now.Add(5*time.Second)))
+	assert.True(t, s.due("net", 10*time.Second, now.Add(5*time.Second)), "collectors are scheduled independently")
+	assert.True(t, s.due("cpu", 10*time.Second, now.Add(10*time.Second)))
+
+	// a collector which is still running isn't started again and stays due
+	assert.False(t, s.start("cpu", now.Add(10*time.Second)))
+	assert.True(t, s.due("cpu", 10*time.Second, now.Add(15*time.Second)))
+
+	s.finish("cpu")
+	assert.True(t, s.start("cpu", now.Add(15*time.Second)))
+	assert.False(t, s.due("cpu", 10*time.Second, now.Add(20*time.Second)), "measured from the last run")
+}
+
+func TestCollectorIntervals(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Interval = 60
+	cfg.CollectorIntervals = map[string]float64{"cpu": 10, "processes": 300, "modules": 120, "mysql": 30}
+	ca := &Cagent{Config: cfg}
+
+	t.Run("interval", func(t *testing.T) {
+		assert.Equal(t, 10*time.Second, ca.collectorInterval("cpu"))
+		assert.Equal(t, 60*time.Second, ca.collectorInterval("fs"))
+	})
+
+	t.Run("module interval", func(t *testing.T) {
+		assert.Equal(t, 30*time.Second, ca.moduleInterval("mysql"))
+		assert.Equal(t, 120*time.Second, ca.moduleInterval("raid"))
+	})
+
+	t.Run("module timeout", func(t *testing.T) {
+		ca.Config.CollectorTimeouts = map[string]float64{"modules": 10, "mysql": 5}
+		assert.Equal(t, 5*time.Second, ca.moduleTimeout("mysql"))
+		assert.Equal(t, 10*time.Second, ca.moduleTimeout("nagios:disk"))
+		assert.Equal(t, 30*time.Second, ca.collectorTimeout("cpu"))
+	})
+
+	t.Run("tick", func(t *testing.T) {
+		assert.Equal(t, 10*time.Second, ca.collectionTick())
+
+		ca.Config.CollectorIntervals = map[string]float64{"processes": 300}
+		assert.Equal(t, 60*time.Second, ca.collectionTick())
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		assert.NoError(t, validateCollectorIntervals(map[string]float64{"cpu": 10, "storcli": 1800}))
+		assert.Error(t, validateCollectorIntervals(map[string]float64{"unknown": 10}))
+		assert.Error(t, validateCollectorIntervals(map[string]float64{"cpu": 1}))
+	})
+}
+
+func TestCollectMeasurementsOmitsStaleSections(t *testing.T) {
+	cfg := NewConfig()
+	cfg.CPUMonitoring = false
+	cfg.MemMonitoring = false
+	ca := &Cagent{Config: cfg}
+
+	// fs was collected just now, so it's not due in this run
+	ca.schedule.start("fs", time.Now())
+	ca.schedule.finish("fs")
+
+	measurements, _ := ca.collectMeasurements(false, false)
+	assert.Equal(t, 1, measurements["cagent.success"])
+	for k := range measurements {
+		assert.NotContains(t, k, "fs.")
+	}
+
+	// a collection triggered on demand runs all collectors
+	measurements, _ = ca.collectMeasurements(false, true)
+	assert.Contains(t, measurements, "cagent.collector.fs.success")
+}
+
+func TestRunCollectors(t *testing.T) {
+	cfg := NewConfig()
+	cfg.CollectorTimeouts = map[string]float64{"slow": 0.05}
+	ca := &Cagent{Config: cfg}
+
+	release := make(chan struct{})
+	defer close(release)
+
+	var processesDone bool
+	list := []collector{
+		{
+			name: "slow",
+			collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+				<-release
+				return common.MeasurementsMap{"slow.value": 1}, nil
+			},
+		},
+		{
+			name: "processes",
+			collect: func(ca *Cagent, cleanup *cleanupCommand) (common.MeasurementsMap, error) {
+				time.Sleep(10 * time.Millisecond)
+				processesDone = true
+				cleanup.AddStep(func() error { return nil })
+				return common.MeasurementsMap{"proc.value": 1}, nil
+			},
+		},
+		{
+			name:  "ports",
+			after: []string{"processes"},
+			collect: func(ca *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+				assert.True(t, processesDone, "must wait for the collector it depends on")
+				return nil, errors.New("failed")
+			},
+		},
+	}
+
+	results := ca.runCollectors(list, time.Now())
+	if !assert.Len(t, results, 3) {
+		return
+	}
+
+	assert.Equal(t, "slow", results[0].name)
+	assert.EqualError(t, results[0].err, "collector 'slow' timed out after 50ms")
+	assert.Nil(t, results[0].measurements)
+
+	assert.NoError(t, results[1].err)
+	assert.Equal(t, common.MeasurementsMap{"proc.value": 1}, results[1].measurements)
+	assert.Len(t, results[1].cleanup.steps, 1)
+	assert.True(t, results[1].duration >= 10*time.Millisecond)
+
+	assert.EqualError(t, results[2].err, "failed")
+
+	t.Run("still running", func(t *testing.T) {
+		res := ca.runCollectors(list[:1], time.Now())
+		assert.EqualError(t, res[0].err, "collector 'slow' is still running since a previous timeout")
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -17,13 +18,38 @@ import (
 
 	"github.com/cloudradar-monitoring/cagent/pkg/common"
 	"github.com/cloudradar-monitoring/cagent/pkg/jobmon"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/certcheck"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/httpcheck"
 	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/mysql"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/nagios"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/netcheck"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/portpolicy"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/postgresql"
 	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/processes"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/procwatch"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/psi"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/redis"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/rules"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/webstatus"
 )
 
 const (
-	IOModeFile = "file"
-	IOModeHTTP = "http"
+	IOModeFile       = "file"
+	IOModeHTTP       = "http"
+	IOModePrometheus = "prometheus"
+
+	OutputTypeHub        = "hub"
+	OutputTypeFile       = "file"
+	OutputTypeStdout     = "stdout"
+	OutputTypeWebhook    = "webhook"
+	OutputTypeTCP        = "tcp"
+	OutputTypeUDP        = "udp"
+	OutputTypePrometheus = "prometheus"
+
+	OutputFormatJSON       = "json"
+	OutputFormatJSONPretty = "json_pretty"
+	OutputFormatInflux     = "influx"
+	OutputFormatGraphite   = "graphite"
 
 	OperationModeFull      = "full"
 	OperationModeMinimal   = "minimal"
@@ -31,6 +57,8 @@ const (
 
 	minIntervalValue          = 30.0
 	minHeartbeatIntervalValue = 5.0
+	minCollectorIntervalValue = 5.0
+	minCollectorTimeoutValue  = 1.0
 
 	minHubRequestTimeout = 1
 	maxHubRequestTimeout = 600
@@ -52,8 +80,9 @@ var configAutogeneratedHeadline = []byte(
 
 type MinValuableConfig struct {
 	LogLevel    LogLevel `toml:"log_level" comment:"\"debug\", \"info\", \"error\" verbose level; can be overridden with -v flag"`
-	IOMode      string   `toml:"io_mode" commented:"true"`
+	IOMode      string   `toml:"io_mode" commented:"true" comment:"\"http\" to send the results to the HUB, \"file\" to write them to out_file\nor \"prometheus\" to serve them for scraping, see the [prometheus] section"`
 	OutFile     string   `toml:"out_file,omitempty" comment:"output file path in io_mode=\"file\"\ncan be overridden with -o flag\non windows slash must be escaped\nfor example out_file = \"C:\\\\cagent.data.txt\""`
+	OutFormat   string   `toml:"out_format,omitempty" comment:"format of the out_file: \"json\" (default), \"json_pretty\", \"influx\" (InfluxDB line protocol) or \"graphite\" (Graphite plaintext)"`
 	HubURL      string   `toml:"hub_url" commented:"true"`
 	HubUser     string   `toml:"hub_user" commented:"true"`
 	HubPassword string   `toml:"hub_password" commented:"true"`
@@ -69,6 +98,10 @@ type Config struct {
 	HeartbeatInterval float64 `toml:"heartbeat" comment:"send a heartbeat without metrics to the HUB every X seconds"`
 	Sleep             float64 `toml:"sleep" comment:"sleep duration after failed communication with the HUB"`
 
+	CollectorIntervals map[string]float64 `toml:"collector_intervals" comment:"Intervals in seconds for individual collectors and modules, all others use 'interval'\nMeasurements of collectors which are not due are omitted from the data sent"`
+	CollectorTimeout   float64            `toml:"collector_timeout" comment:"Collectors run concurrently. A collector not finished within N seconds is reported as failed in the message"`
+	CollectorTimeouts  map[string]float64 `toml:"collector_timeouts" comment:"Timeouts in seconds for individual collectors and modules, all others use 'collector_timeout'\nThe 'modules' timeout applies to all modules without an own timeout"`
+
 	PidFile   string `toml:"pid" comment:"pid file location"`
 	LogFile   string `toml:"log,omitempty" required:"false" comment:"log file location"`
 	LogSyslog string `toml:"log_syslog" comment:"\"local\" for local unix socket or URL e.g. \"udp://localhost:514\" for remote syslog server"`
@@ -125,10 +158,22 @@ type Config struct {
 
 	MysqlMonitoring mysql.Config `toml:"mysql_monitoring" comment:"Monitor the basic performance metrics of a MySQL or MariaDB database\n** EXPERIMENTAL                          **\n** Do not use in production environments **"`
 
+	PostgresqlMonitoring postgresql.Config `toml:"postgresql_monitoring" comment:"Monitor the performance metrics, the connections and the replication of a PostgreSQL server"`
+
+	RedisMonitoring redis.Config `toml:"redis_monitoring" comment:"Monitor the performance metrics, the replication and the persistence of a Redis server"`
+
+	NginxMonitoring webstatus.NginxConfig `toml:"nginx_monitoring" comment:"Monitor the connections and the requests of nginx using the stub_status page"`
+
+	ApacheMonitoring webstatus.ApacheConfig `toml:"apache_monitoring" comment:"Monitor the workers and the requests of Apache using the mod_status page"`
+
 	ProcessMonitoring processes.Config `toml:"process_monitoring" comment:"Cagent monitors all running processes and reports them for further processing to the Hub.\nOn heavy loaded systems or if you don't need process monitoring at all,\nyou can change the following settings."`
 
+	ListeningPortsPolicy portpolicy.Config `toml:"listening_ports_policy" comment:"Check the listening ports against the expected ones and report the changes since the previous run\nin the 'listening ports policy' module"`
+
 	Updates UpdatesConfig `toml:"self_update" comment:"Control how cagent installs self-updates. Windows-only"`
 
+	PSIMonitoring psi.Config `toml:"psi_monitoring" comment:"Pressure stall information of CPU, memory and IO, i.e. the share of the time tasks were stalled waiting for the resource"`
+
 	DockerMonitoring DockerMonitoringConfig `toml:"docker_monitoring" comment:"Cagent monitors all running docker containers and reports them for further processing to the Hub.\nYou can change the following settings."`
 
 	MemMonitoring bool `toml:"mem_monitoring" comment:"\nTurn on or off parts of the monitoring.\nPresets of the operation_mode have precedence.\nWhat's disabled by the operation_mode can't be turned on here.\nBut it can still be turned off.\n\nTurn on/off the monitoring of memory"`
@@ -141,6 +186,29 @@ type Config struct {
 
 	OnHTTP5xxRetries       int     `toml:"on_http_5xx_retries" comment:"Number of retries if server replies with a 5xx code"`
 	OnHTTP5xxRetryInterval float64 `toml:"on_http_5xx_retry_interval" comment:"Interval in seconds between retries to contact server in case of a 5xx code"`
+
+	Prometheus PrometheusConfig `toml:"prometheus" comment:"Serve the collected measurements over HTTP in the Prometheus text format\nApplies only to io_mode = \"prometheus\" or an output of type = \"prometheus\""`
+
+	NagiosChecks []nagios.Check `toml:"nagios_checks,omitempty" comment:"Nagios/Icinga compatible plugins executed as modules"`
+
+	HTTPChecks []httpcheck.Check `toml:"http_checks,omitempty" comment:"HTTP and HTTPS endpoints probed from the host"`
+
+	CertChecks []certcheck.Check `toml:"cert_checks,omitempty" comment:"Expiry of the certificates of TLS endpoints and of certificate files"`
+
+	NetChecks []netcheck.Check `toml:"net_checks,omitempty" comment:"TCP and UDP port reachability and DNS resolution"`
+
+	ProcessWatchlist []procwatch.Process `toml:"process_watchlist,omitempty" comment:"Critical processes checked for presence, the number of instances and restarts in the 'process watchlist' module"`
+
+	Rules []rules.Rule `toml:"rules,omitempty" comment:"Threshold rules over the measurements. Firing rules are reported as alerts or warnings in the 'threshold rules' module"`
+
+	Outputs []OutputConfig `toml:"outputs,omitempty" comment:"Deliver the results to several destinations at once. If at least one output is configured io_mode is ignored.\nThe output file set with the -o flag still has a precedence"`
+
+	StatusAPI StatusAPIConfig `toml:"status_api" comment:"Local HTTP API to inspect and control the running agent\nEndpoints: /status, /last (the most recent result), /collect (POST, triggers an immediate collection) and /health"`
+
+	Outbox OutboxConfig `toml:"outbox" comment:"Measurements that could not be delivered to the Hub are kept on disk\nand sent in the order of collection as soon as the Hub is reachable again"`
+
+	// sources contains the origin of the values which are not defaults, keyed by the TOML key
+	sources map[string]string `toml:"-"`
 }
 
 type ConfigDeprecated struct {
@@ -154,6 +222,8 @@ type CPUUtilisationAnalysisConfig struct {
 	GatheringMode                  string  `toml:"gathering_mode" comment:"should be one of values of cpu_utilisation_gathering_mode" json:"gathering_mode"`
 	ReportProcesses                int     `toml:"report_processes" comment:"number of processes to return" json:"report_processes"`
 	TrailingProcessAnalysisMinutes int     `toml:"trailing_process_analysis_minutes" comment:"how much time analysis will continue to perform after the CPU utilisation returns to the normal value" json:"trailing_process_analysis_minutes"`
+	PSIThreshold                   float64 `toml:"psi_threshold" comment:"also start the analysis if the CPU pressure stall information reaches this percent, 0 disables, Linux only" json:"psi_threshold"`
+	PSIMetric                      string  `toml:"psi_metric" comment:"possible values: 'some.avg10', 'some.avg60', 'some.avg300', 'full.avg10', 'full.avg60', 'full.avg300'. The system-wide CPU 'full' requires kernel 5.13 or newer" json:"psi_metric"`
 }
 
 type StorCLIConfig struct {
@@ -167,7 +237,8 @@ type UpdatesMonitoringConfig struct {
 }
 
 type DockerMonitoringConfig struct {
-	Enabled bool `toml:"enabled" comment:"Set 'false' to disable docker monitoring'"`
+	Enabled              bool `toml:"enabled" comment:"Set 'false' to disable docker monitoring'"`
+	RestartLoopThreshold int  `toml:"restart_loop_threshold" comment:"Alert if a container was restarted at least N times since the previous check. Set to 0 to alert only on the 'restarting' state"`
 }
 
 func (l *UpdatesMonitoringConfig) Validate() error {
@@ -207,6 +278,160 @@ type JobMonitoringConfig struct {
 	Severity     jobmon.Severity `toml:"severity" comment:"Failed jobs will be processed as alerts. Possible values alert, warning or none. Default: alert"`
 }
 
+type PrometheusConfig struct {
+	Listen string `toml:"listen" comment:"Address to listen on. Use 127.0.0.1 to restrict access to the local host. Default: 127.0.0.1:9909"`
+	Path   string `toml:"path" comment:"URL path to serve the metrics at. Default: /metrics"`
+}
+
+func (p *PrometheusConfig) Validate() error {
+	if len(p.Listen) == 0 {
+		return errors.New("listen is empty")
+	}
+
+	if !strings.HasPrefix(p.Path, "/") {
+		return errors.New("path must start with /")
+	}
+
+	return nil
+}
+
+type OutputConfig struct {
+	Type          string            `toml:"type" comment:"\"hub\", \"file\", \"stdout\", \"webhook\", \"tcp\", \"udp\" or \"prometheus\" (see the [prometheus] section)"`
+	Enabled       *bool             `toml:"enabled,omitempty" comment:"Set 'false' to disable the output. Default: true"`
+	Format        string            `toml:"format,omitempty" comment:"\"json\", \"json_pretty\", \"influx\" (InfluxDB line protocol) or \"graphite\" (Graphite plaintext).\nDefault: json. Ignored for hub and prometheus"`
+	Prefix        string            `toml:"prefix,omitempty" comment:"Prefix of the metric paths in the graphite format. Default: cagent"`
+	Path          string            `toml:"path,omitempty" comment:"File to append the results to. Required for type = \"file\""`
+	URL           string            `toml:"url,omitempty" comment:"URL to POST the results to. Required for type = \"webhook\""`
+	Address       string            `toml:"address,omitempty" comment:"host:port to send the results to. Required for type = \"tcp\" and \"udp\""`
+	Headers       map[string]string `toml:"headers,omitempty" comment:"Additional HTTP headers sent to the webhook"`
+	Timeout       float64           `toml:"timeout,omitempty" comment:"Time limit in seconds for a webhook request or a tcp/udp connection. Default: 30"`
+	Retries       int               `toml:"retries,omitempty" comment:"Number of retries if the delivery failed. For the hub on_http_5xx_retries applies"`
+	RetryInterval float64           `toml:"retry_interval,omitempty" comment:"Interval in seconds between retries"`
+}
+
+func (o *OutputConfig) Validate() error {
+	switch o.Type {
+	case OutputTypeHub, OutputTypeStdout, OutputTypePrometheus:
+	case OutputTypeFile:
+		if len(o.Path) == 0 {
+			return errors.New("path is required for file output")
+		}
+	case OutputTypeWebhook:
+		u, err := url.Parse(o.URL)
+		if err != nil {
+			return fmt.Errorf("invalid url: %s", err.Error())
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return errors.New("url must start with http:// or https://")
+		}
+	case OutputTypeTCP, OutputTypeUDP:
+		if _, _, err := net.SplitHostPort(o.Address); err != nil {
+			return fmt.Errorf("invalid address: %s", err.Error())
+		}
+	default:
+		return fmt.Errorf("unknown type '%s'", o.Type)
+	}
+
+	if err := validateOutputFormat(o.Format); err != nil {
+		return err
+	}
+
+	if o.Retries < 0 || o.RetryInterval < 0 || o.Timeout < 0 {
+		return errors.New("retries, retry_interval and timeout can't be negative")
+	}
+
+	return nil
+}
+
+func (o *OutputConfig) IsEnabled() bool {
+	return o.Enabled == nil || *o.Enabled
+}
+
+func (o *OutputConfig) GetFormat() string {
+	if o.Format == "" {
+		return OutputFormatJSON
+	}
+	return o.Format
+}
+
+func (o *OutputConfig) GetPrefix() string {
+	if o.Prefix == "" {
+		return defaultGraphitePrefix
+	}
+	return o.Prefix
+}
+
+func (o *OutputConfig) GetTimeout() time.Duration {
+	if o.Timeout == 0 {
+		return 30 * time.Second
+	}
+	return secToDuration(o.Timeout)
+}
+
+func validateOutputFormat(format string) error {
+	switch format {
+	case "", OutputFormatJSON, OutputFormatJSONPretty, OutputFormatInflux, OutputFormatGraphite:
+		return nil
+	}
+	return fmt.Errorf("unknown format '%s'", format)
+}
+
+type StatusAPIConfig struct {
+	Enabled bool   `toml:"enabled" comment:"Set 'true' to enable the status API. Default: false"`
+	Listen  string `toml:"listen" comment:"Address to listen on. Only loopback addresses are allowed. Default: 127.0.0.1:9908"`
+	Socket  string `toml:"socket" comment:"Path to a unix socket to listen on instead of the address. The socket is accessible by the user and the group of cagent"`
+	Token   string `toml:"token" comment:"If set, requests must contain the header 'Authorization: Bearer <token>'"`
+}
+
+func (s *StatusAPIConfig) Validate() error {
+	if !s.Enabled || s.Socket != "" {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(s.Listen)
+	if err != nil {
+		return fmt.Errorf("invalid listen address: %s", err.Error())
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("listen address must be a loopback address, got '%s'", host)
+	}
+
+	return nil
+}
+
+type OutboxConfig struct {
+	Enabled   bool   `toml:"enabled" comment:"Set 'false' to drop measurements that failed to reach the Hub"`
+	DirPath   string `toml:"dir" comment:"Path to the outbox dir"`
+	MaxSizeMB uint32 `toml:"max_size_mb" comment:"Maximum total size of the outbox in megabytes. The oldest measurements are dropped first. Default: 50"`
+	MaxAge    uint32 `toml:"max_age" comment:"Measurements older than N seconds are dropped. Default: 86400"`
+}
+
+func (o *OutboxConfig) Validate() error {
+	if !o.Enabled {
+		return nil
+	}
+
+	if len(o.DirPath) == 0 {
+		return errors.New("dir is empty")
+	}
+
+	if !filepath.IsAbs(o.DirPath) {
+		return errors.New("dir path must be absolute")
+	}
+
+	return nil
+}
+
+func (o *OutboxConfig) GetMaxAge() time.Duration {
+	return time.Duration(int64(o.MaxAge) * int64(time.Second))
+}
+
 func (j *JobMonitoringConfig) Validate() error {
 	if len(j.SpoolDirPath) == 0 {
 		return errors.New("spool_dir is empty")
@@ -250,6 +475,8 @@ func NewConfig() *Config {
 		Interval:                         90,
 		Sleep:                            0,
 		HeartbeatInterval:                15,
+		CollectorIntervals:               map[string]float64{"storcli": 1800},
+		CollectorTimeout:                 30,
 		HubGzip:                          true,
 		HubRequestTimeout:                30,
 		CPULoadDataGather:                []string{"avg1"},
@@ -275,6 +502,7 @@ func NewConfig() *Config {
 			GatheringMode:                  "avg1",
 			ReportProcesses:                5,
 			TrailingProcessAnalysisMinutes: 5,
+			PSIMetric:                      "some.avg10",
 		},
 		SMARTMonitoring:        false,
 		TemperatureMonitoring:  true,
@@ -295,19 +523,72 @@ func NewConfig() *Config {
 			FetchTimeout:  30,
 			CheckInterval: 14400,
 		},
+		MysqlMonitoring: mysql.Config{
+			QueryTimeout:          10,
+			MaxConnectionsPercent: 90,
+			MaxReplicationLag:     300,
+		},
+		PostgresqlMonitoring: postgresql.Config{
+			Connect:                  "127.0.0.1:5432",
+			Database:                 "postgres",
+			SSLMode:                  "disable",
+			ConnectTimeout:           5,
+			QueryTimeout:             10,
+			MaxConnectionsPercent:    90,
+			MaxReplicationLag:        300,
+			LongTransactionThreshold: 300,
+		},
+		RedisMonitoring: redis.Config{
+			Connect:        "127.0.0.1:6379",
+			ConnectTimeout: 5,
+		},
+		NginxMonitoring: webstatus.NginxConfig{
+			URL:               "http://127.0.0.1/nginx_status",
+			Timeout:           5,
+			SaturationPercent: 90,
+		},
+		ApacheMonitoring: webstatus.ApacheConfig{
+			URL:               "http://127.0.0.1/server-status?auto",
+			Timeout:           5,
+			SaturationPercent: 90,
+		},
 		ProcessMonitoring: processes.GetDefaultConfig(),
+		PSIMonitoring:     psi.Config{Enabled: true},
+		ListeningPortsPolicy: portpolicy.Config{
+			StateFile: "/var/lib/cagent/listeningports.json",
+		},
 		Updates: UpdatesConfig{
 			Enabled:       false,
 			CheckInterval: 21600,
 		},
-		DockerMonitoring: DockerMonitoringConfig{Enabled: true},
-		MemMonitoring:    true,
-		CPUMonitoring:    true,
-		FSMonitoring:     true,
-		NetMonitoring:    true,
+		DockerMonitoring: DockerMonitoringConfig{
+			Enabled:              true,
+			RestartLoopThreshold: 3,
+		},
+		MemMonitoring: true,
+		CPUMonitoring: true,
+		FSMonitoring:  true,
+		NetMonitoring: true,
 
 		OnHTTP5xxRetries:       4,
 		OnHTTP5xxRetryInterval: 2.0,
+
+		Prometheus: PrometheusConfig{
+			Listen: "127.0.0.1:9909",
+			Path:   "/metrics",
+		},
+
+		StatusAPI: StatusAPIConfig{
+			Enabled: false,
+			Listen:  "127.0.0.1:9908",
+		},
+
+		Outbox: OutboxConfig{
+			Enabled:   true,
+			DirPath:   "/var/lib/cagent/outbox",
+			MaxSizeMB: 50,
+			MaxAge:    86400,
+		},
 	}
 
 	cfg.MinValuableConfig = *(defaultMinValuableConfig())
@@ -319,10 +600,14 @@ func NewConfig() *Config {
 		cfg.CPUUtilTypes = []string{"user", "system", "idle"}
 		cfg.VirtualMachinesStat = []string{"hyper-v"}
 		cfg.JobMonitoring.SpoolDirPath = "C:\\ProgramData\\cagent\\jobmon"
+		cfg.Outbox.DirPath = "C:\\ProgramData\\cagent\\outbox"
+		cfg.ListeningPortsPolicy.StateFile = "C:\\ProgramData\\cagent\\listeningports.json"
 		cfg.Updates.Enabled = true
 		cfg.Updates.URL = SelfUpdatesFeedURL
 	case "darwin":
 		cfg.JobMonitoring.SpoolDirPath = "/usr/local/var/lib/cagent/jobmon"
+		cfg.Outbox.DirPath = "/usr/local/var/lib/cagent/outbox"
+		cfg.ListeningPortsPolicy.StateFile = "/usr/local/var/lib/cagent/listeningports.json"
 	default:
 		cfg.FSMetrics = append(cfg.FSMetrics, "inodes_used_percent")
 	}
@@ -390,28 +675,12 @@ func TryUpdateConfigFromFile(cfg *Config, configFilePath string) error {
 		return err
 	}
 
-	cfgFile, err := os.Open(configFilePath)
+	meta, err := decodeConfigFile(cfg, configFilePath)
 	if err != nil {
 		return err
 	}
 
-	_, err = toml.DecodeReader(cfgFile, cfg)
-	if err != nil {
-		return err
-	}
-
-	_, err = cfgFile.Seek(0, 0)
-	if err != nil {
-		return err
-	}
-
-	var deprecatedCfg ConfigDeprecated
-	meta, err := toml.DecodeReader(cfgFile, &deprecatedCfg)
-	if err != nil {
-		return err
-	}
-
-	cfg.migrate(&deprecatedCfg, meta)
+	cfg.setSources(meta, configFilePath)
 
 	return nil
 }
@@ -479,6 +748,78 @@ func GenerateDefaultConfigFile(mvc *MinValuableConfig, configFilePath string) er
 	return err
 }
 
+func validateCollectorIntervals(intervals map[string]float64) error {
+	known := make(map[string]bool)
+	for _, name := range append(CollectorNames(), ModuleNames()...) {
+		known[name] = true
+	}
+
+	for name, interval := range intervals {
+		if !known[name] {
+			return fmt.Errorf("unknown collector '%s'", name)
+		}
+		if interval < minCollectorIntervalValue {
+			return fmt.Errorf("%s: interval value must be >= %.1f", name, minCollectorIntervalValue)
+		}
+	}
+
+	return nil
+}
+
+func validateCollectorTimeouts(timeouts map[string]float64) error {
+	known := make(map[string]bool)
+	for _, name := range append(CollectorNames(), ModuleNames()...) {
+		known[name] = true
+	}
+
+	for name, timeout := range timeouts {
+		if !known[name] {
+			return fmt.Errorf("unknown collector '%s'", name)
+		}
+		if timeout < minCollectorTimeoutValue {
+			return fmt.Errorf("%s: timeout value must be >= %.1f", name, minCollectorTimeoutValue)
+		}
+	}
+
+	return nil
+}
+
+// validateCheck validates the settings common to all checks of a [[*_checks]] section
+func validateCheck(names map[string]bool, name string, interval float64) error {
+	if interval > 0 && interval < minCollectorIntervalValue {
+		return fmt.Errorf("interval value must be >= %.1f", minCollectorIntervalValue)
+	}
+
+	if names[name] {
+		return fmt.Errorf("duplicate name '%s'", name)
+	}
+	names[name] = true
+
+	return nil
+}
+
+// GetOutFormat returns the format of results written to out_file
+func (cfg *Config) GetOutFormat() string {
+	if cfg.OutFormat == "" {
+		return OutputFormatJSON
+	}
+	return cfg.OutFormat
+}
+
+// usesPrometheus reports whether the measurements are served to Prometheus by io_mode or one of the outputs
+func (cfg *Config) usesPrometheus() bool {
+	if cfg.IOMode == IOModePrometheus {
+		return true
+	}
+
+	for _, o := range cfg.Outputs {
+		if o.Type == OutputTypePrometheus && o.IsEnabled() {
+			return true
+		}
+	}
+	return false
+}
+
 func (cfg *Config) GetParsedNetInterfaceMaxSpeed() (uint64, error) {
 	v := cfg.NetInterfaceMaxSpeed
 	if v == "" {
@@ -546,6 +887,128 @@ func (cfg *Config) validate() error {
 		return fmt.Errorf("invalid [jobmon] config: %s", err.Error())
 	}
 
+	if err = validateOutputFormat(cfg.OutFormat); err != nil {
+		return fmt.Errorf("invalid out_format: %s", err.Error())
+	}
+
+	checkNames := make(map[string]bool)
+	for i := range cfg.NagiosChecks {
+		err = cfg.NagiosChecks[i].Validate()
+		if err == nil {
+			err = validateCheck(checkNames, cfg.NagiosChecks[i].Name, cfg.NagiosChecks[i].Interval)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid [[nagios_checks]] config #%d: %s", i+1, err.Error())
+		}
+	}
+
+	checkNames = make(map[string]bool)
+	for i := range cfg.HTTPChecks {
+		err = cfg.HTTPChecks[i].Validate()
+		if err == nil {
+			err = validateCheck(checkNames, cfg.HTTPChecks[i].Name, cfg.HTTPChecks[i].Interval)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid [[http_checks]] config #%d: %s", i+1, err.Error())
+		}
+	}
+
+	checkNames = make(map[string]bool)
+	for i := range cfg.CertChecks {
+		err = cfg.CertChecks[i].Validate()
+		if err == nil {
+			err = validateCheck(checkNames, cfg.CertChecks[i].Name, cfg.CertChecks[i].Interval)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid [[cert_checks]] config #%d: %s", i+1, err.Error())
+		}
+	}
+
+	checkNames = make(map[string]bool)
+	for i := range cfg.NetChecks {
+		err = cfg.NetChecks[i].Validate()
+		if err == nil {
+			err = validateCheck(checkNames, cfg.NetChecks[i].Name, cfg.NetChecks[i].Interval)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid [[net_checks]] config #%d: %s", i+1, err.Error())
+		}
+	}
+
+	watchedNames := make(map[string]bool)
+	for i := range cfg.ProcessWatchlist {
+		err = cfg.ProcessWatchlist[i].Validate()
+		if err == nil && watchedNames[cfg.ProcessWatchlist[i].Name] {
+			err = fmt.Errorf("duplicate name '%s'", cfg.ProcessWatchlist[i].Name)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid [[process_watchlist]] config #%d: %s", i+1, err.Error())
+		}
+		watchedNames[cfg.ProcessWatchlist[i].Name] = true
+	}
+
+	for i := range cfg.Rules {
+		err = cfg.Rules[i].Validate()
+		if err != nil {
+			return fmt.Errorf("invalid [[rules]] config #%d: %s", i+1, err.Error())
+		}
+	}
+
+	for i := range cfg.Outputs {
+		err = cfg.Outputs[i].Validate()
+		if err != nil {
+			return fmt.Errorf("invalid [[outputs]] config #%d: %s", i+1, err.Error())
+		}
+	}
+
+	if cfg.usesPrometheus() {
+		err = cfg.Prometheus.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid [prometheus] config: %s", err.Error())
+		}
+	}
+
+	err = cfg.StatusAPI.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid [status_api] config: %s", err.Error())
+	}
+
+	err = validateCollectorIntervals(cfg.CollectorIntervals)
+	if err != nil {
+		return fmt.Errorf("invalid [collector_intervals] config: %s", err.Error())
+	}
+
+	if cfg.CollectorTimeout < minCollectorTimeoutValue {
+		return fmt.Errorf("collector_timeout value must be >= %.1f", minCollectorTimeoutValue)
+	}
+
+	err = validateCollectorTimeouts(cfg.CollectorTimeouts)
+	if err != nil {
+		return fmt.Errorf("invalid [collector_timeouts] config: %s", err.Error())
+	}
+
+	err = cfg.Outbox.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid [outbox] config: %s", err.Error())
+	}
+
+	if cfg.CPUUtilisationAnalysis.PSIThreshold > 0 {
+		err = psi.ValidateMetric(cfg.CPUUtilisationAnalysis.PSIMetric)
+		if err != nil {
+			return fmt.Errorf("invalid [cpu_utilisation_analysis] psi_metric: %s", err.Error())
+		}
+	}
+
+	err = cfg.ProcessMonitoring.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid [process_monitoring] config: %s", err.Error())
+	}
+
+	err = cfg.ListeningPortsPolicy.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid [listening_ports_policy] config: %s", err.Error())
+	}
+
 	err = cfg.SystemUpdatesChecks.Validate()
 	if err != nil {
 		return fmt.Errorf("invalid [system_updates_checks] config: %s", err.Error())
@@ -556,6 +1019,26 @@ func (cfg *Config) validate() error {
 		return fmt.Errorf("invalid [mysql_monitoring] config: %s", err.Error())
 	}
 
+	err = cfg.PostgresqlMonitoring.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid [postgresql_monitoring] config: %s", err.Error())
+	}
+
+	err = cfg.RedisMonitoring.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid [redis_monitoring] config: %s", err.Error())
+	}
+
+	err = cfg.NginxMonitoring.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid [nginx_monitoring] config: %s", err.Error())
+	}
+
+	err = cfg.ApacheMonitoring.Validate()
+	if err != nil {
+		return fmt.Errorf("invalid [apache_monitoring] config: %s", err.Error())
+	}
+
 	err = cfg.Updates.Validate()
 	if err != nil {
 		return fmt.Errorf("invalid [updates] config: %s", err.Error())
@@ -595,6 +1078,14 @@ func HandleAllConfigSetup(configFilePath string) (*Config, error) {
 		return nil, fmt.Errorf("Config load error: %s", err.Error())
 	}
 
+	if err = cfg.applyConfigDropIns(configFilePath); err != nil {
+		return nil, fmt.Errorf("Config load error: %s", err.Error())
+	}
+
+	if err = cfg.applyEnvOverrides(); err != nil {
+		return nil, fmt.Errorf("Config load error: %s", err.Error())
+	}
+
 	if err = cfg.validate(); err != nil {
 		return nil, err
 	}
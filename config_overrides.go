@@ -0,0 +1,215 @@
+package cagent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/troian/toml"
+)
+
+const (
+	configDropInDirName = "cagent.conf.d"
+	configEnvPrefix     = "CAGENT_"
+)
+
+// ConfigDropInDir returns the path of the directory with config fragments for the config file
+func ConfigDropInDir(configFilePath string) string {
+	return filepath.Join(filepath.Dir(configFilePath), configDropInDirName)
+}
+
+// applyConfigDropIns merges *.toml fragments from the drop-in dir into cfg in lexical order.
+// Values set in a fragment override the values from the main config file and previous fragments, arrays are replaced
+func (cfg *Config) applyConfigDropIns(configFilePath string) error {
+	files, err := filepath.Glob(filepath.Join(ConfigDropInDir(configFilePath), "*.toml"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, f := range files {
+		meta, err := decodeConfigFile(cfg, f)
+		if err != nil {
+			return fmt.Errorf("%s: %s", f, err.Error())
+		}
+		cfg.setSources(meta, f)
+	}
+
+	return nil
+}
+
+// decodeConfigFile applies values from the file to cfg and returns the metadata about the keys defined in the file
+func decodeConfigFile(cfg *Config, configFilePath string) (toml.MetaData, error) {
+	cfgFile, err := os.Open(configFilePath)
+	if err != nil {
+		return toml.MetaData{}, err
+	}
+	defer cfgFile.Close()
+
+	meta, err := toml.DecodeReader(cfgFile, cfg)
+	if err != nil {
+		return meta, err
+	}
+
+	_, err = cfgFile.Seek(0, 0)
+	if err != nil {
+		return meta, err
+	}
+
+	var deprecatedCfg ConfigDeprecated
+	deprecatedMeta, err := toml.DecodeReader(cfgFile, &deprecatedCfg)
+	if err != nil {
+		return meta, err
+	}
+
+	cfg.migrate(&deprecatedCfg, deprecatedMeta)
+
+	return meta, nil
+}
+
+func (cfg *Config) setSources(meta toml.MetaData, source string) {
+	if cfg.sources == nil {
+		cfg.sources = make(map[string]string)
+	}
+
+	for _, key := range meta.Keys() {
+		switch meta.Type(key...) {
+		case "Hash", "ArrayHash":
+			// tables themselves are not values
+			continue
+		}
+		cfg.sources[key.String()] = source
+	}
+}
+
+// applyEnvOverrides sets config values from CAGENT_<SECTION>_<KEY> environment variables, e.g.
+// CAGENT_INTERVAL=30 or CAGENT_OUTBOX_MAX_SIZE_MB=100. Lists are comma separated.
+// Environment variables have a precedence over all config files
+func (cfg *Config) applyEnvOverrides() error {
+	return applyEnvToStruct(reflect.ValueOf(cfg).Elem(), nil, func(key []string, envName string) {
+		if cfg.sources == nil {
+			cfg.sources = make(map[string]string)
+		}
+		cfg.sources[strings.Join(key, ".")] = "env " + envName
+	})
+}
+
+func applyEnvToStruct(v reflect.Value, parentKey []string, onApplied func(key []string, envName string)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		fieldValue := v.Field(i)
+		if field.Anonymous && field.Tag.Get("toml") == "" && fieldValue.Kind() == reflect.Struct {
+			// embedded struct fields are on the same level
+			if err := applyEnvToStruct(fieldValue, parentKey, onApplied); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("toml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		key := append(append([]string{}, parentKey...), name)
+
+		if fieldValue.Kind() == reflect.Struct {
+			if err := applyEnvToStruct(fieldValue, key, onApplied); err != nil {
+				return err
+			}
+			continue
+		}
+
+		envName := configEnvPrefix + strings.ToUpper(strings.Join(key, "_"))
+		val, exists := os.LookupEnv(envName)
+		if !exists {
+			continue
+		}
+
+		applied, err := setFromString(fieldValue, val)
+		if err != nil {
+			return fmt.Errorf("invalid value of %s: %s", envName, err.Error())
+		}
+		if applied {
+			onApplied(key, envName)
+		}
+	}
+
+	return nil
+}
+
+// setFromString parses the string according to the kind of v. It returns false if the kind is not supported
+func setFromString(v reflect.Value, s string) (bool, error) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return false, err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return false, err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return false, err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return false, err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return false, nil
+		}
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		list := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			list.Index(i).SetString(item)
+		}
+		v.Set(list)
+	default:
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// DumpSources returns the origin of every value set in a config file or an environment variable as TOML comments
+func (cfg *Config) DumpSources() string {
+	keys := make([]string, 0, len(cfg.sources))
+	for k := range cfg.sources {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("# Sources of the values. All values not listed here are defaults\n")
+	for _, k := range keys {
+		b.WriteString(fmt.Sprintf("#   %s: %s\n", k, cfg.sources[k]))
+	}
+	return b.String()
+}
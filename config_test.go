@@ -3,6 +3,7 @@ package cagent
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
 
@@ -267,3 +268,51 @@ func TestGetParsedNetworkInterfaceMaxSpeed(t *testing.T) {
 		assert.Equal(t, expected.val, val, "for input %s: %d vs %d", strVal, expected.val, val)
 	}
 }
+
+func TestHandleAllConfigSetupOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cagent")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	configFilePath := filepath.Join(dir, "cagent.conf")
+	err = ioutil.WriteFile(configFilePath, []byte("interval = 100.0\nheartbeat = 10.0\n[outbox]\n  max_size_mb = 10\n"), 0600)
+	assert.Nil(t, err)
+
+	dropInDir := ConfigDropInDir(configFilePath)
+	assert.Nil(t, os.Mkdir(dropInDir, 0755))
+	// fragments are applied in lexical order
+	err = ioutil.WriteFile(filepath.Join(dropInDir, "20-interval.toml"), []byte("interval = 30.0\n"), 0600)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(dropInDir, "10-interval.toml"), []byte("interval = 20.0\nheartbeat = 20.0\n"), 0600)
+	assert.Nil(t, err)
+	err = ioutil.WriteFile(filepath.Join(dropInDir, "ignored.conf"), []byte("interval = 40.0\n"), 0600)
+	assert.Nil(t, err)
+
+	os.Setenv("CAGENT_OUTBOX_MAX_SIZE_MB", "25")
+	os.Setenv("CAGENT_FS_TYPE_INCLUDE", "ext4, xfs")
+	defer os.Unsetenv("CAGENT_OUTBOX_MAX_SIZE_MB")
+	defer os.Unsetenv("CAGENT_FS_TYPE_INCLUDE")
+
+	config, err := HandleAllConfigSetup(configFilePath)
+	assert.Nil(t, err)
+
+	assert.Equal(t, 30.0, config.Interval)
+	assert.Equal(t, 20.0, config.HeartbeatInterval)
+	assert.Equal(t, uint32(25), config.Outbox.MaxSizeMB)
+	assert.Equal(t, []string{"ext4", "xfs"}, config.FSTypeInclude)
+
+	assert.Equal(t, map[string]string{
+		"interval":           filepath.Join(dropInDir, "20-interval.toml"),
+		"heartbeat":          filepath.Join(dropInDir, "10-interval.toml"),
+		"outbox.max_size_mb": "env CAGENT_OUTBOX_MAX_SIZE_MB",
+		"fs_type_include":    "env CAGENT_FS_TYPE_INCLUDE",
+	}, config.sources)
+
+	t.Run("invalid-env-value", func(t *testing.T) {
+		os.Setenv("CAGENT_INTERVAL", "often")
+		defer os.Unsetenv("CAGENT_INTERVAL")
+
+		_, err := HandleAllConfigSetup(configFilePath)
+		assert.Error(t, err)
+	})
+}
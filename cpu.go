@@ -15,6 +15,7 @@ import (
 	log "github.com/sirupsen/logrus"
 
 	"github.com/cloudradar-monitoring/cagent/pkg/common"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/psi"
 )
 
 const measureInterval = time.Second * 10
@@ -51,6 +52,12 @@ type thresholdNotifier struct {
 	Chan                 chan float64
 }
 
+type psiThresholdNotifier struct {
+	Percentage float64
+	Metric     string // e.g. some.avg10
+	Chan       chan float64
+}
+
 type CPUWatcher struct {
 	LoadAvg1  bool
 	LoadAvg5  bool
@@ -59,7 +66,10 @@ type CPUWatcher struct {
 	UtilAvg   TimeSeriesAverage
 	UtilTypes []string
 
-	ThresholdNotifiers []thresholdNotifier
+	// notifiersMu guards the notifiers, they are added while the watcher is running
+	notifiersMu           sync.Mutex
+	ThresholdNotifiers    []thresholdNotifier
+	PSIThresholdNotifiers []psiThresholdNotifier
 }
 
 var utilisationMetricsByOSMap = make(map[string]map[string]struct{})
@@ -309,10 +319,17 @@ func (cw *CPUWatcher) Once() error {
 
 	cw.UtilAvg.Add(time.Now(), values)
 	cw.UtilAvg.mu.Unlock()
-	if cw.ThresholdNotifiers != nil {
+
+	// copy the notifiers to not hold the lock while sending to the chans
+	cw.notifiersMu.Lock()
+	thresholdNotifiers := append([]thresholdNotifier(nil), cw.ThresholdNotifiers...)
+	psiThresholdNotifiers := append([]psiThresholdNotifier(nil), cw.PSIThresholdNotifiers...)
+	cw.notifiersMu.Unlock()
+
+	if len(thresholdNotifiers) > 0 {
 		avg, _ := cw.UtilAvg.Percentage()
 
-		for _, tm := range cw.ThresholdNotifiers {
+		for _, tm := range thresholdNotifiers {
 			var values ValuesMap
 			var exists bool
 			if values, exists = avg[tm.GatheringModeMinutes]; !exists {
@@ -324,6 +341,20 @@ func (cw *CPUWatcher) Once() error {
 			}
 		}
 	}
+
+	if len(psiThresholdNotifiers) > 0 {
+		p, err := psi.SystemPressure("cpu")
+		if err != nil {
+			log.WithError(err).Debug("[CPU] failed to read the CPU pressure")
+			return nil
+		}
+
+		for _, tm := range psiThresholdNotifiers {
+			if val, err := p.Value(tm.Metric); err == nil && val >= tm.Percentage {
+				tm.Chan <- val
+			}
+		}
+	}
 	return nil
 }
 
@@ -455,7 +486,30 @@ func (cw *CPUWatcher) AddThresholdNotifier(percentage float64, metric string, op
 		return fmt.Errorf("gathering mode %s is not presented at cpu_utilisation_gathering_mode", gatheringMode)
 	}
 
+	cw.notifiersMu.Lock()
 	cw.ThresholdNotifiers = append(cw.ThresholdNotifiers, tn)
+	cw.notifiersMu.Unlock()
+
+	return nil
+}
+
+// AddPSIThresholdNotifier sends the CPU pressure stall information to the chan when it reaches the percentage
+func (cw *CPUWatcher) AddPSIThresholdNotifier(percentage float64, metric string, ch chan float64) error {
+	if ch == nil {
+		return fmt.Errorf("ch should be non-nil chan")
+	}
+
+	if percentage <= 0 || percentage > 100 {
+		return fmt.Errorf("percentage should be more >0 and <=100")
+	}
+
+	if err := psi.ValidateMetric(metric); err != nil {
+		return err
+	}
+
+	cw.notifiersMu.Lock()
+	cw.PSIThresholdNotifiers = append(cw.PSIThresholdNotifiers, psiThresholdNotifier{Percentage: percentage, Metric: metric, Chan: ch})
+	cw.notifiersMu.Unlock()
 
 	return nil
 }
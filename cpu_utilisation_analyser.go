@@ -32,7 +32,6 @@ func (ca *Cagent) CPUUtilisationAnalyser() *CPUUtilisationAnalyser {
 
 	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc,
-		syscall.SIGHUP,
 		syscall.SIGINT,
 		syscall.SIGTERM)
 
@@ -47,6 +46,14 @@ func (ca *Cagent) CPUUtilisationAnalyser() *CPUUtilisationAnalyser {
 		return ca.cpuUtilisationAnalyser
 	}
 
+	if cfg.PSIThreshold > 0 {
+		// the CPU pressure starts the analysis as well
+		err = ca.cpuWatcher.AddPSIThresholdNotifier(cfg.PSIThreshold, cfg.PSIMetric, thresholdChan)
+		if err != nil {
+			log.Error("[CPU_ANALYSIS] addPSIThresholdNotifier error", err.Error())
+		}
+	}
+
 	go func() {
 		for {
 			select {
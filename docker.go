@@ -0,0 +1,13 @@
+package cagent
+
+import (
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/docker"
+)
+
+func (ca *Cagent) DockerWatcher() *docker.Watcher {
+	if ca.dockerWatcher == nil {
+		ca.dockerWatcher = docker.NewWatcher(ca.Config.DockerMonitoring.RestartLoopThreshold)
+	}
+
+	return ca.dockerWatcher
+}
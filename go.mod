@@ -14,6 +14,7 @@ require (
 	github.com/jaypipes/ghw v0.7.0
 	github.com/kardianos/service v1.0.1-0.20190622144052-5da1f538b7fe
 	github.com/konsorten/go-windows-terminal-sequences v1.0.2 // indirect
+	github.com/lib/pq v1.9.0
 	github.com/lxn/walk v0.0.0-20190515104301-6cf0bf1359a5
 	github.com/lxn/win v0.0.0-20190514122436-6f00d814e89c
 	github.com/mitchellh/go-homedir v1.1.0 // indirect
@@ -5,23 +5,14 @@ import (
 	"encoding/json"
 	"net/http"
 	"os"
-	"runtime"
 	"time"
 
 	"github.com/cloudradar-monitoring/selfupdate"
 	"github.com/pkg/errors"
-	"github.com/shirou/gopsutil/mem"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/cloudradar-monitoring/cagent/pkg/common"
-	"github.com/cloudradar-monitoring/cagent/pkg/hwinfo"
-	"github.com/cloudradar-monitoring/cagent/pkg/jobmon"
-	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/docker"
-	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/networking"
-	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/processes"
-	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/sensors"
-	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/services"
-	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/updates"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
 )
 
 type Cleaner interface {
@@ -65,34 +56,78 @@ func (ca *Cagent) Run(outputFile *os.File, interrupt chan struct{}) {
 	}()
 
 	retries := 0
-	retryIn := secToDuration(ca.Config.Interval)
+	var retryIn time.Duration
 	var firstRetry time.Time
 	var measurements common.MeasurementsMap
+	var collectedAt time.Time
 	var cleaner Cleaner
+	var pending []Sink
+	// set when the collection is triggered on demand
+	var forced bool
+	// the backoff after HTTP 401 grows with every failed attempt
+	sleep := ca.currentConfig().Sleep
 
 	for {
+		ca.configMu.RLock()
 		if retries == 0 {
 			log.Debug("Run: collectMeasurements")
-			measurements, cleaner = ca.collectMeasurements(ca.Config.OperationMode == OperationModeFull)
+			collectedAt = time.Now()
+			measurements, cleaner = ca.collectMeasurements(ca.Config.OperationMode == OperationModeFull, forced)
+			forced = false
+			ca.runState.setCollected(&Result{Timestamp: collectedAt.Unix(), Measurements: measurements})
+			pending = ca.outputSinks(outputFile)
+		}
+		ca.configMu.RUnlock()
+
+		// the sinks keep the config they were created with, so the config can be reloaded while sending
+		err, sinksErr := ca.reportMeasurements(&Result{Timestamp: time.Now().Unix(), Measurements: measurements}, pending)
+		if sinksErr != nil {
+			// other sinks retry on their own, the pull-based prometheus one has nothing to deliver later
+			log.Error(sinksErr)
 		}
-		err := ca.reportMeasurements(measurements, outputFile)
 		if err == nil {
-			err = cleaner.Cleanup()
+			// the measurements are delivered to the Hub already, so they must not be kept or sent again if the cleanup fails
+			if cleanupErr := cleaner.Cleanup(); cleanupErr != nil {
+				log.WithError(cleanupErr).Error("Run: cleanup after sending measurements failed")
+			}
 		}
+		// only the Hub delivery is retried with the same measurements
+		pending = hubSinks(pending)
 
+		ca.configMu.RLock()
+		// the loop wakes up at the shortest of the collector intervals, only the due collectors run then
+		retryIn = ca.collectionTick()
 		if err != nil {
+			// measurements are about to be discarded unless the same batch is retried
+			discarded := false
 			if err == ErrHubTooManyRequests {
-				// for error code 429, wait 10 seconds and try again
+				// for error code 429, wait 10 seconds and try again with the same measurements
+				// until the next collection is due, then keep them in the outbox
 				retryIn = 10 * time.Second
-				log.Infof("Run: HTTP 429, too many requests, retrying in %v", retryIn)
+				if retries == 0 {
+					firstRetry = time.Now()
+				}
+				retries++
+				if time.Since(firstRetry)+retryIn > ca.collectionTick() {
+					retries = 0
+					discarded = true
+					retryIn = ca.collectionTick() - time.Since(firstRetry)
+					if retryIn < 0 {
+						retryIn = 0
+					}
+					log.Infof("Run: HTTP 429, too many requests, next run in %v", retryIn)
+				} else {
+					log.Infof("Run: HTTP 429, too many requests, retrying in %v", retryIn)
+				}
 			} else if err == ErrHubUnauthorized {
 				// increase sleep time by 30 seconds until it is 1 hour
-				if ca.Config.Sleep < 60*60 {
-					ca.Config.Sleep += 30
+				if sleep < 60*60 {
+					sleep += 30
 				}
 				retries = 0
-				retryIn = time.Duration(ca.Config.Sleep) * time.Second
-				log.Infof("Run: failed to send measurements to hub. unable to authorize with provided Hub credentials (HTTP 401). waiting %v seconds until next attempt", ca.Config.Sleep)
+				discarded = true
+				retryIn = time.Duration(sleep) * time.Second
+				log.Infof("Run: failed to send measurements to hub. unable to authorize with provided Hub credentials (HTTP 401). waiting %v seconds until next attempt", sleep)
 			} else if err == ErrHubServerError {
 				// for error codes 5xx, wait for configured amount of time and try again
 				retryIn = time.Duration(ca.Config.OnHTTP5xxRetryInterval) * time.Second
@@ -102,22 +137,42 @@ func (ca *Cagent) Run(outputFile *os.File, interrupt chan struct{}) {
 				retries++
 				if retries > ca.Config.OnHTTP5xxRetries {
 					retries = 0
-					retryIn = secToDuration(ca.Config.Interval) - time.Since(firstRetry)
+					discarded = true
+					retryIn = ca.collectionTick() - time.Since(firstRetry)
 					if retryIn < 0 {
 						retryIn = 0
 					}
-					log.Errorf("Run: hub connection error, next run in %v s (out of %v s)", retryIn, secToDuration(ca.Config.Interval))
+					log.Errorf("Run: hub connection error, next run in %v s (out of %v s)", retryIn, ca.collectionTick())
 				} else {
 					log.Infof("Run: hub connection error %d/%d, retrying in %v s", retries, ca.Config.OnHTTP5xxRetries, ca.Config.OnHTTP5xxRetryInterval)
 				}
 			} else {
+				discarded = true
 				log.Error(err)
 			}
+
+			if discarded {
+				ca.keepUndeliveredMeasurements(measurements, collectedAt, cleaner)
+			}
 		}
 
+		ca.configMu.RUnlock()
+		ca.runState.setSchedule(retries, retryIn)
+
 		select {
 		case <-interrupt:
 			return
+		case <-ca.collectNow:
+			log.Info("Run: collection triggered by the status API")
+			forced = true
+			if retries > 0 {
+				// the batch which is being retried is superseded by the new one
+				ca.configMu.RLock()
+				ca.keepUndeliveredMeasurements(measurements, collectedAt, cleaner)
+				ca.configMu.RUnlock()
+				retries = 0
+			}
+			continue
 		case <-time.After(retryIn):
 			continue
 		}
@@ -125,148 +180,86 @@ func (ca *Cagent) Run(outputFile *os.File, interrupt chan struct{}) {
 }
 
 func (ca *Cagent) RunOnce(outputFile *os.File, fullMode bool) error {
-	measurements, cleaner := ca.collectMeasurements(fullMode)
-	err := ca.reportMeasurements(measurements, outputFile)
-	if err == nil {
-		err = cleaner.Cleanup()
+	measurements, cleaner := ca.collectMeasurements(fullMode, true)
+	hubErr, sinksErr := ca.reportMeasurements(&Result{Timestamp: time.Now().Unix(), Measurements: measurements}, ca.outputSinks(outputFile))
+	if hubErr != nil {
+		return hubErr
+	}
+
+	err := cleaner.Cleanup()
+	if sinksErr != nil {
+		return sinksErr
 	}
 	return err
 }
 
-func (ca *Cagent) collectMeasurements(fullMode bool) (common.MeasurementsMap, Cleaner) {
+// collectMeasurements runs the collectors which are due. With force all collectors run regardless of their intervals,
+// e.g. for a collection triggered on demand
+func (ca *Cagent) collectMeasurements(fullMode, force bool) (common.MeasurementsMap, Cleaner) {
 	var errCollector = common.ErrorCollector{}
 	var cleanupCommand = &cleanupCommand{}
 	var measurements = make(common.MeasurementsMap)
 	var cfg = ca.Config
 
-	if ca.Config.CPUMonitoring {
-		cpum, err := ca.CPUWatcher().Results()
-		errCollector.Add(err)
-		measurements = measurements.AddWithPrefix("cpu.", cpum)
-	}
-
-	if ca.Config.FSMonitoring {
-		fsResults, err := ca.GetFileSystemWatcher().Results()
-		errCollector.Add(err)
-		measurements = measurements.AddWithPrefix("fs.", fsResults)
-	}
-
-	var memStat *mem.VirtualMemoryStat
-	if ca.Config.MemMonitoring {
-		var mem common.MeasurementsMap
-		var err error
-		mem, memStat, err = ca.MemResults()
-		errCollector.Add(err)
-		measurements = measurements.AddWithPrefix("mem.", mem)
+	list := collectors
+	if fullMode {
+		list = append(append([]collector{}, collectors...), ca.moduleCollectors()...)
 	}
 
-	if ca.Config.CPUMonitoring {
-		cpuUtilisationAnalysisResult, cpuUtilisationAnalysisIsActive, err := ca.CPUUtilisationAnalyser().Results()
-		errCollector.Add(err)
-		measurements = measurements.AddWithPrefix("cpu_utilisation_analysis.", cpuUtilisationAnalysisResult)
-		if cpuUtilisationAnalysisIsActive {
-			measurements = measurements.AddWithPrefix(
-				"cpu_utilisation_analysis.",
-				common.MeasurementsMap{"settings": cfg.CPUUtilisationAnalysis},
-			)
+	now := time.Now()
+	var due []collector
+	for _, c := range list {
+		if !fullMode && !c.minimal {
+			continue
 		}
-	}
-
-	if fullMode {
-		info, err := ca.HostInfoResults()
-		errCollector.Add(err)
-		measurements = measurements.AddWithPrefix("system.", info)
-
-		ipResults, err := networking.IPAddresses()
-		errCollector.Add(err)
-		measurements = measurements.AddWithPrefix("system.", ipResults)
-
-		if ca.Config.NetMonitoring {
-			netResults, err := ca.GetNetworkWatcher().Results()
-			errCollector.Add(err)
-			measurements = measurements.AddWithPrefix("net.", netResults)
+		if c.enabled != nil && !c.enabled(cfg) {
+			continue
 		}
-
-		proc, processList, err := processes.GetMeasurements(memStat, &ca.Config.ProcessMonitoring)
-		errCollector.Add(err)
-		measurements = measurements.AddWithPrefix("proc.", proc)
-
-		ports, err := ca.PortsResult(processList)
-		errCollector.Add(err)
-		measurements = measurements.AddWithPrefix("listeningports.", ports)
-
-		if ca.Config.MemMonitoring {
-			swap, err := ca.SwapResults()
-			errCollector.Add(err)
-			measurements = measurements.AddWithPrefix("swap.", swap)
+		interval := c.interval
+		if interval == 0 {
+			interval = ca.collectorInterval(c.name)
 		}
-
-		ca.getVMStatMeasurements(func(name string, meas common.MeasurementsMap, err error) {
-			if err == nil {
-				measurements = measurements.AddWithPrefix("virt."+name+".", meas)
-			}
-			errCollector.Add(err)
-		})
-
-		ca.hwInventory.Do(func() {
-			hwInfo, err := hwinfo.Inventory()
-			errCollector.Add(err)
-			if hwInfo != nil {
-				measurements = measurements.AddInnerWithPrefix("hw.inventory", hwInfo)
-			}
-		})
-
-		if cfg.SystemUpdatesChecks.Enabled && cfg.SystemUpdatesChecks.CheckInterval > 0 {
-			watcher := updates.GetWatcher(cfg.SystemUpdatesChecks.FetchTimeout, cfg.SystemUpdatesChecks.CheckInterval)
-			u, err := watcher.GetSystemUpdatesInfo()
-			if err != updates.ErrorDisabledOnHost {
-				errCollector.Add(err)
-				var prefix string
-				if runtime.GOOS == "windows" {
-					prefix = "windows_update."
-				} else {
-					prefix = "linux_update."
-				}
-				measurements = measurements.AddWithPrefix(prefix, u)
-			}
-		}
-
-		servicesList, err := services.ListServices(cfg.DiscoverAutostartingServicesOnly)
-		if err != services.ErrorNotImplementedForOS {
-			errCollector.Add(err)
+		// sections which are not due are omitted from the measurements
+		if !force && !ca.schedule.due(c.name, interval, now) {
+			continue
 		}
-		measurements = measurements.AddWithPrefix("services.", servicesList)
+		due = append(due, c)
+	}
 
-		if cfg.DockerMonitoring.Enabled {
-			containersList, err := docker.ListContainers()
-			if err != docker.ErrorNotImplementedForOS && err != docker.ErrorDockerNotAvailable {
-				errCollector.Add(err)
+	for _, res := range ca.runCollectors(due, now) {
+		errCollector.Add(res.err)
+		for k, v := range res.measurements {
+			if reports, isReports := v.([]*monitoring.ModuleReport); isReports && k == "modules" {
+				existing, _ := measurements["modules"].([]*monitoring.ModuleReport)
+				measurements["modules"] = append(existing, reports...)
+				continue
 			}
-			measurements = measurements.AddWithPrefix("docker.", containersList)
+			measurements[k] = v
+		}
+		if res.cleanup != nil {
+			cleanupCommand.steps = append(cleanupCommand.steps, res.cleanup.steps...)
 		}
 
-		if cfg.TemperatureMonitoring {
-			temperatures, err := sensors.ReadTemperatureSensors()
-			errCollector.Add(err)
-			measurements = measurements.AddWithPrefix("temperatures.", common.MeasurementsMap{"list": temperatures})
+		prefix := "cagent.collector." + res.name + "."
+		measurements[prefix+"duration_ms"] = res.duration.Milliseconds()
+		if res.err != nil {
+			measurements[prefix+"success"] = 0
+		} else {
+			measurements[prefix+"success"] = 1
 		}
+	}
 
-		moduleReports, err := ca.collectModulesMeasurements()
-		errCollector.Add(err)
-		measurements = measurements.AddWithPrefix("", common.MeasurementsMap{"modules": moduleReports})
+	if _, exists := measurements["modules"]; !exists && fullMode && len(ca.modules) == 0 {
+		// the section is sent even without any modules enabled, it's omitted only while none of the modules is due
+		measurements["modules"] = []*monitoring.ModuleReport(nil)
+	}
 
-		smartMeas := ca.getSMARTMeasurements()
-		if len(smartMeas) > 0 {
-			measurements = measurements.AddInnerWithPrefix("smartmon", smartMeas)
-		}
+	if ports, ok := measurements["listeningports.list"].([]PortStat); ok && cfg.ListeningPortsPolicy.Enabled {
+		ca.evaluatePortsPolicy(measurements, ports, now)
+	}
 
-		spool := jobmon.NewSpoolManager(cfg.JobMonitoring.SpoolDirPath, log.StandardLogger())
-		ids, jobs, err := spool.GetFinishedJobs()
-		errCollector.Add(err)
-		measurements = measurements.AddWithPrefix("", common.MeasurementsMap{"jobmon": jobs})
-		cleanupCommand.AddStep(func() error {
-			return spool.RemoveJobs(ids)
-		})
+	if len(cfg.Rules) > 0 {
+		ca.evaluateRules(measurements, now)
 	}
 
 	measurements["operation_mode"] = cfg.OperationMode
@@ -281,35 +274,59 @@ func (ca *Cagent) collectMeasurements(fullMode bool) (common.MeasurementsMap, Cl
 	return measurements, cleanupCommand
 }
 
-func (ca *Cagent) reportMeasurements(measurements common.MeasurementsMap, outputFile *os.File) error {
-	result := &Result{
-		Timestamp:    time.Now().Unix(),
-		Measurements: measurements,
-	}
-	if outputFile != nil {
-		err := json.NewEncoder(outputFile).Encode(result)
-		if err != nil {
-			return errors.Wrap(err, "failed to JSON encode measurement result")
+// reportMeasurements delivers the result to all sinks. The error of the Hub sink is returned apart from the errors
+// of the other sinks, because only the Hub delivery is retried and decides whether the cleanup steps can be performed
+func (ca *Cagent) reportMeasurements(result *Result, sinks []Sink) (hubErr error, sinksErr error) {
+	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancelFn()
+
+	errs := common.ErrorCollector{}
+	var delivered []*hubSink
+	for _, sink := range sinks {
+		err := sink.Write(ctx, result)
+		hub, isHub := sink.(*hubSink)
+		if err == nil {
+			if isHub {
+				delivered = append(delivered, hub)
+			}
+			continue
+		}
+
+		if isHub {
+			hubErr = err
+			continue
 		}
-		return nil
+		errs.Add(errors.Wrapf(err, "output %s", sink.String()))
 	}
 
-	if ca.Config.Logs.HubFile != "" {
-		ca.prettyPrintMeasurementsToFile(measurements, ca.Config.Logs.HubFile)
+	// the Hub is reachable again, so it's time to deliver what was stored during the outage.
+	// It's done once the current result was written to all sinks, so the backlog doesn't hold them up
+	for _, hub := range delivered {
+		hub.replayOutbox()
 	}
 
-	ctx, cancelFn := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancelFn()
+	return hubErr, errs.Combine()
+}
 
-	err := ca.PostResultToHub(ctx, result)
+// keepUndeliveredMeasurements stores measurements in the outbox instead of discarding them.
+// Once stored, the cleanup steps are performed as the data is not going to be lost anymore
+func (ca *Cagent) keepUndeliveredMeasurements(measurements common.MeasurementsMap, collectedAt time.Time, cleaner Cleaner) {
+	if !ca.Config.Outbox.Enabled {
+		return
+	}
+
+	err := ca.storeInOutbox(&Result{
+		Timestamp:    collectedAt.Unix(),
+		Measurements: measurements,
+	})
 	if err != nil {
-		if err == ErrHubTooManyRequests || err == ErrHubServerError || err == ErrHubUnauthorized {
-			return err
-		}
-		err = errors.Wrap(err, "failed to POST measurement result to Hub")
+		log.WithError(err).Error("Run: measurements will be lost")
+		return
 	}
 
-	return err
+	if err = cleaner.Cleanup(); err != nil {
+		log.WithError(err).Error("Run: cleanup after storing measurements in outbox failed")
+	}
 }
 
 func (ca *Cagent) RunHeartbeat(interrupt chan struct{}) {
@@ -319,10 +336,17 @@ func (ca *Cagent) RunHeartbeat(interrupt chan struct{}) {
 
 	var firstRetry time.Time
 	retries := 0
-	retryIn := secToDuration(ca.Config.HeartbeatInterval)
+	retryIn := secToDuration(ca.currentConfig().HeartbeatInterval)
+	// the backoff after HTTP 401 grows with every failed attempt
+	sleep := ca.currentConfig().Sleep
 
 	for {
-		err := ca.sendHeartbeat()
+		ca.configMu.RLock()
+		ca.initHubClientOnce()
+		cfg, client := ca.Config, ca.hubClient
+		ca.configMu.RUnlock()
+
+		err := ca.sendHeartbeat(cfg, client)
 		if err != nil {
 			if err == ErrHubTooManyRequests {
 				// for error code 429, wait 10 seconds and try again
@@ -330,28 +354,28 @@ func (ca *Cagent) RunHeartbeat(interrupt chan struct{}) {
 				log.Infof("RunHeartbeat: HTTP 429, too many requests, retrying in %v", retryIn)
 			} else if err == ErrHubUnauthorized {
 				// increase sleep time by 30 seconds until it is 1 hour
-				if ca.Config.Sleep < 60*60 {
-					ca.Config.Sleep += 30
+				if sleep < 60*60 {
+					sleep += 30
 				}
 				retries = 0
-				retryIn = time.Duration(ca.Config.Sleep) * time.Second
-				log.Infof("Run: failed to send heartbeat to hub. unable to authorize with provided Hub credentials (HTTP 401). waiting %v seconds until next attempt", ca.Config.Sleep)
+				retryIn = time.Duration(sleep) * time.Second
+				log.Infof("Run: failed to send heartbeat to hub. unable to authorize with provided Hub credentials (HTTP 401). waiting %v seconds until next attempt", sleep)
 			} else if err == ErrHubServerError {
 				// for error codes 5xx, wait for configured amount of time and try again
-				retryIn = time.Duration(ca.Config.OnHTTP5xxRetryInterval) * time.Second
+				retryIn = time.Duration(cfg.OnHTTP5xxRetryInterval) * time.Second
 				if retries == 0 {
 					firstRetry = time.Now()
 				}
 				retries++
-				if retries > ca.Config.OnHTTP5xxRetries {
+				if retries > cfg.OnHTTP5xxRetries {
 					retries = 0
-					retryIn = secToDuration(ca.Config.HeartbeatInterval) - time.Since(firstRetry)
+					retryIn = secToDuration(cfg.HeartbeatInterval) - time.Since(firstRetry)
 					if retryIn < 0 {
 						retryIn = 0
 					}
-					log.Errorf("RunHeartbeat: hub connection error, next run in %v s (out of %v s)", retryIn, secToDuration(ca.Config.HeartbeatInterval))
+					log.Errorf("RunHeartbeat: hub connection error, next run in %v s (out of %v s)", retryIn, secToDuration(cfg.HeartbeatInterval))
 				} else {
-					log.Infof("RunHeartbeat: hub connection error %d/%d, retrying in %v s", retries, ca.Config.OnHTTP5xxRetries, ca.Config.OnHTTP5xxRetryInterval)
+					log.Infof("RunHeartbeat: hub connection error %d/%d, retrying in %v s", retries, cfg.OnHTTP5xxRetries, cfg.OnHTTP5xxRetryInterval)
 				}
 			} else {
 				log.WithError(err).Error("failed to send heartbeat to Hub")
@@ -367,27 +391,27 @@ func (ca *Cagent) RunHeartbeat(interrupt chan struct{}) {
 	}
 }
 
-func (ca *Cagent) sendHeartbeat() error {
-	ca.initHubClientOnce()
-	err := ca.validateHubURL("hub_url")
+// sendHeartbeat uses the config and the client taken under the config lock, so the config can be reloaded meanwhile
+func (ca *Cagent) sendHeartbeat(cfg *Config, client *http.Client) error {
+	err := validateHubURL(cfg.HubURL, "hub_url")
 	if err != nil {
 		return err
 	}
 
 	// no need to wait more than heartbeat interval
-	ctx, cancelFn := context.WithTimeout(context.Background(), secToDuration(ca.Config.HeartbeatInterval))
+	ctx, cancelFn := context.WithTimeout(context.Background(), secToDuration(cfg.HeartbeatInterval))
 	defer cancelFn()
 
-	req, err := http.NewRequest("GET", ca.Config.HubURL, nil)
+	req, err := http.NewRequest("GET", cfg.HubURL, nil)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 	req.Header.Add("User-Agent", ca.userAgent())
-	if len(ca.Config.HubUser) > 0 {
-		req.SetBasicAuth(ca.Config.HubUser, ca.Config.HubPassword)
+	if len(cfg.HubUser) > 0 {
+		req.SetBasicAuth(cfg.HubUser, cfg.HubPassword)
 	}
 	req = req.WithContext(ctx)
-	resp, err := ca.hubClient.Do(req)
+	resp, err := client.Do(req)
 	if resp != nil {
 		if resp.StatusCode == http.StatusTooManyRequests {
 			return ErrHubTooManyRequests
@@ -399,7 +423,7 @@ func (ca *Cagent) sendHeartbeat() error {
 			return ErrHubServerError
 		}
 	}
-	if err = ca.checkClientError(resp, err, "hub_user", "hub_password"); err != nil {
+	if err = checkClientError(cfg, resp, err, "hub_user", "hub_password"); err != nil {
 		return errors.WithStack(err)
 	}
 	log.Debugf("Heartbeat sent. Status: %d", resp.StatusCode)
@@ -5,6 +5,7 @@ import (
 	"compress/gzip"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -25,40 +26,15 @@ func (ca *Cagent) initHubClientOnce() {
 		transport := *(http.DefaultTransport.(*http.Transport))
 		transport.ResponseHeaderTimeout = 15 * time.Second
 
-		rootCAs, err := common.CustomRootCertPool()
-		if err != nil {
-			if err != common.ErrorCustomRootCertPoolNotImplementedForOS {
-				logrus.Errorf("failed to add root certs: %s", err.Error())
-			}
-		} else if rootCAs != nil {
+		if rootCAs := hubRootCAs(); rootCAs != nil {
 			transport.TLSClientConfig = &tls.Config{
 				RootCAs: rootCAs,
 			}
 		}
 
-		transport.Proxy = proxydetect.GetProxyForRequest
 		proxydetect.UserAgent = ca.userAgent()
+		transport.Proxy = ca.hubProxy()
 
-		if len(ca.Config.HubProxy) > 0 {
-			// in case we have proxy set in the config
-			// it will override the proxy from the system
-			if !strings.HasPrefix(ca.Config.HubProxy, "http://") {
-				ca.Config.HubProxy = "http://" + ca.Config.HubProxy
-			}
-			proxyURL, err := url.Parse(ca.Config.HubProxy)
-			if err != nil {
-				logrus.WithFields(logrus.Fields{
-					"url": ca.Config.HubProxy,
-				}).Warningln("failed to parse hub_proxy URL")
-			} else {
-				if len(ca.Config.HubProxyUser) > 0 {
-					proxyURL.User = url.UserPassword(ca.Config.HubProxyUser, ca.Config.HubProxyPassword)
-				}
-				transport.Proxy = func(_ *http.Request) (*url.URL, error) {
-					return proxyURL, nil
-				}
-			}
-		}
 		ca.hubClient = &http.Client{
 			Timeout:   time.Duration(ca.Config.HubRequestTimeout) * time.Second,
 			Transport: &transport,
@@ -66,11 +42,50 @@ func (ca *Cagent) initHubClientOnce() {
 	})
 }
 
+// hubRootCAs returns the custom root certificates used for the Hub requests or nil to use the system ones
+func hubRootCAs() *x509.CertPool {
+	rootCAs, err := common.CustomRootCertPool()
+	if err != nil {
+		if err != common.ErrorCustomRootCertPoolNotImplementedForOS {
+			logrus.Errorf("failed to add root certs: %s", err.Error())
+		}
+		return nil
+	}
+	return rootCAs
+}
+
+// hubProxy returns the proxy func used for the Hub requests
+func (ca *Cagent) hubProxy() func(*http.Request) (*url.URL, error) {
+	if len(ca.Config.HubProxy) > 0 {
+		// in case we have proxy set in the config
+		// it will override the proxy from the system
+		hubProxy := ca.Config.HubProxy
+		if !strings.HasPrefix(hubProxy, "http://") {
+			hubProxy = "http://" + hubProxy
+		}
+		proxyURL, err := url.Parse(hubProxy)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"url": hubProxy,
+			}).Warningln("failed to parse hub_proxy URL")
+		} else {
+			if len(ca.Config.HubProxyUser) > 0 {
+				proxyURL.User = url.UserPassword(ca.Config.HubProxyUser, ca.Config.HubProxyPassword)
+			}
+			return func(_ *http.Request) (*url.URL, error) {
+				return proxyURL, nil
+			}
+		}
+	}
+
+	return proxydetect.GetProxyForRequest
+}
+
 // validateHubURL performs Hub URL validation, that reference field name as in source config.
-func (ca *Cagent) validateHubURL(fieldHubURL string) error {
-	if len(ca.Config.HubURL) == 0 {
+func validateHubURL(hubURL, fieldHubURL string) error {
+	if len(hubURL) == 0 {
 		return newEmptyFieldError(fieldHubURL)
-	} else if u, err := url.Parse(ca.Config.HubURL); err != nil {
+	} else if u, err := url.Parse(hubURL); err != nil {
 		err = errors.WithStack(err)
 		return newFieldError(fieldHubURL, err)
 	} else if u.Scheme != "http" && u.Scheme != "https" {
@@ -89,7 +104,7 @@ func (ca *Cagent) validateHubURL(fieldHubURL string) error {
 // * for WinUI: CheckHubCredentials(ctx, "URL", "User", "Password")
 func (ca *Cagent) CheckHubCredentials(ctx context.Context, fieldHubURL, fieldHubUser, fieldHubPassword string) error {
 	ca.initHubClientOnce()
-	err := ca.validateHubURL(fieldHubURL)
+	err := validateHubURL(ca.Config.HubURL, fieldHubURL)
 	if err != nil {
 		return err
 	}
@@ -104,14 +119,14 @@ func (ca *Cagent) CheckHubCredentials(ctx context.Context, fieldHubURL, fieldHub
 	req = req.WithContext(ctx)
 	resp, err := ca.hubClient.Do(req)
 	cancelFn()
-	if err = ca.checkClientError(resp, err, fieldHubUser, fieldHubPassword); err != nil {
+	if err = checkClientError(ca.Config, resp, err, fieldHubUser, fieldHubPassword); err != nil {
 		return errors.WithStack(err)
 	}
 
 	return nil
 }
 
-func (ca *Cagent) checkClientError(resp *http.Response, err error, fieldHubUser, fieldHubPassword string) error {
+func checkClientError(cfg *Config, resp *http.Response, err error, fieldHubUser, fieldHubPassword string) error {
 	if err != nil {
 		if errors.Cause(err) == context.DeadlineExceeded {
 			err = errors.New("connection timeout, please check your proxy or firewall settings")
@@ -128,9 +143,9 @@ func (ca *Cagent) checkClientError(resp *http.Response, err error, fieldHubUser,
 
 	_ = resp.Body.Close()
 	if resp.StatusCode == http.StatusUnauthorized {
-		if len(ca.Config.HubUser) == 0 {
+		if len(cfg.HubUser) == 0 {
 			return newEmptyFieldError(fieldHubUser)
-		} else if len(ca.Config.HubPassword) == 0 {
+		} else if len(cfg.HubPassword) == 0 {
 			return newEmptyFieldError(fieldHubPassword)
 		}
 		return errors.Errorf("unable to authorize with provided Hub credentials (HTTP %d). %s", resp.StatusCode, responseBody)
@@ -151,7 +166,13 @@ func newFieldError(name string, err error) error {
 
 func (ca *Cagent) PostResultToHub(ctx context.Context, result *Result) error {
 	ca.initHubClientOnce()
-	err := ca.validateHubURL("hub_url")
+	return ca.postResultToHub(ctx, ca.Config, ca.hubClient, result)
+}
+
+// postResultToHub sends the result with the config and the client taken before,
+// so the config can be reloaded while the request is in progress
+func (ca *Cagent) postResultToHub(ctx context.Context, cfg *Config, client *http.Client, result *Result) error {
+	err := validateHubURL(cfg.HubURL, "hub_url")
 	if err != nil {
 		return err
 	}
@@ -163,7 +184,7 @@ func (ca *Cagent) PostResultToHub(ctx context.Context, result *Result) error {
 	}
 
 	var req *http.Request
-	if ca.Config.HubGzip {
+	if cfg.HubGzip {
 		buf := new(bytes.Buffer)
 		gzipped := gzip.NewWriter(buf)
 		if _, err := gzipped.Write(b); err != nil {
@@ -174,23 +195,23 @@ func (ca *Cagent) PostResultToHub(ctx context.Context, result *Result) error {
 			err = errors.Wrap(err, "failed to finalize gzipped buffer")
 			return err
 		}
-		req, err = http.NewRequest("POST", ca.Config.HubURL, buf)
+		req, err = http.NewRequest("POST", cfg.HubURL, buf)
 		if req != nil {
 			req.Header.Set("Content-Encoding", "gzip")
 		}
 	} else {
-		req, err = http.NewRequest("POST", ca.Config.HubURL, bytes.NewBuffer(b))
+		req, err = http.NewRequest("POST", cfg.HubURL, bytes.NewBuffer(b))
 	}
 	if err != nil {
 		return errors.WithStack(err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Add("User-Agent", ca.userAgent())
-	if len(ca.Config.HubUser) > 0 {
-		req.SetBasicAuth(ca.Config.HubUser, ca.Config.HubPassword)
+	if len(cfg.HubUser) > 0 {
+		req.SetBasicAuth(cfg.HubUser, cfg.HubPassword)
 	}
 	req = req.WithContext(ctx)
-	resp, err := ca.hubClient.Do(req)
+	resp, err := client.Do(req)
 
 	if resp != nil {
 		if resp.StatusCode == http.StatusTooManyRequests {
@@ -203,7 +224,7 @@ func (ca *Cagent) PostResultToHub(ctx context.Context, result *Result) error {
 			return ErrHubServerError
 		}
 	}
-	if err = ca.checkClientError(resp, err, "hub_user", "hub_password"); err != nil {
+	if err = checkClientError(cfg, resp, err, "hub_user", "hub_password"); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -1,59 +1,237 @@
 package cagent
 
 import (
+	"io"
+	"time"
+
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
 	"github.com/cloudradar-monitoring/cagent/pkg/common"
 	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/certcheck"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/httpcheck"
 	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/mysql"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/nagios"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/netcheck"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/postgresql"
 	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/raid"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/redis"
 	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/storcli"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/webstatus"
 )
 
-var modules []monitoring.Module
+const (
+	// modulesCollectorName is used in collector_intervals and collector_timeouts for all modules
+	modulesCollectorName = "modules"
+	// nagiosTimeoutGrace is the time to report a plugin which was killed after its timeout
+	nagiosTimeoutGrace = time.Second
+)
 
-func (ca *Cagent) initModules() {
-	if len(modules) > 0 {
-		return
-	}
+// namedModule binds a module to the name used in collector_intervals
+type namedModule struct {
+	name string
+	// interval overrides the interval from collector_intervals if set
+	interval time.Duration
+	// minTimeout extends the time limit from collector_timeouts, e.g. so a plugin is killed by its own timeout
+	minTimeout time.Duration
+	monitoring.Module
+}
 
-	l := []func() monitoring.Module{
-		func() monitoring.Module {
-			return storcli.CreateModule(ca.Config.StorCLI.BinaryPath)
+// moduleFactories are the modules which can be enabled in the config, by name
+var moduleFactories = []struct {
+	name   string
+	create func(cfg *Config) monitoring.Module
+}{
+	{
+		name: "storcli",
+		create: func(cfg *Config) monitoring.Module {
+			return storcli.CreateModule(cfg.StorCLI.BinaryPath)
 		},
-		func() monitoring.Module {
-			return raid.CreateModule(ca.Config.SoftwareRAIDMonitoring)
+	},
+	{
+		name: "raid",
+		create: func(cfg *Config) monitoring.Module {
+			return raid.CreateModule(cfg.SoftwareRAIDMonitoring)
 		},
-		func() monitoring.Module {
-			return mysql.CreateModule(&ca.Config.MysqlMonitoring)
+	},
+	{
+		name: "mysql",
+		create: func(cfg *Config) monitoring.Module {
+			return mysql.CreateModule(&cfg.MysqlMonitoring)
 		},
+	},
+	{
+		name: "postgresql",
+		create: func(cfg *Config) monitoring.Module {
+			return postgresql.CreateModule(&cfg.PostgresqlMonitoring)
+		},
+	},
+	{
+		name: "redis",
+		create: func(cfg *Config) monitoring.Module {
+			return redis.CreateModule(&cfg.RedisMonitoring)
+		},
+	},
+	{
+		name: "nginx",
+		create: func(cfg *Config) monitoring.Module {
+			return webstatus.CreateNginxModule(&cfg.NginxMonitoring)
+		},
+	},
+	{
+		name: "apache",
+		create: func(cfg *Config) monitoring.Module {
+			return webstatus.CreateApacheModule(&cfg.ApacheMonitoring)
+		},
+	},
+}
+
+// ModuleNames returns the names of all modules which can be used in collector_intervals
+func ModuleNames() []string {
+	names := make([]string, 0, len(moduleFactories))
+	for _, f := range moduleFactories {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+func (ca *Cagent) initModules() {
+	if len(ca.modules) > 0 {
+		return
 	}
 
-	for _, f := range l {
-		m := f()
+	for _, f := range moduleFactories {
+		m := f.create(ca.Config)
 		if m.IsEnabled() {
-			modules = append(modules, m)
+			ca.modules = append(ca.modules, namedModule{name: f.name, Module: m})
+		}
+	}
+
+	for i := range ca.Config.NagiosChecks {
+		check := &ca.Config.NagiosChecks[i]
+		ca.modules = append(ca.modules, namedModule{
+			name:       "nagios:" + check.Name,
+			interval:   secToDuration(check.Interval),
+			minTimeout: check.GetTimeout() + nagiosTimeoutGrace,
+			Module:     nagios.CreateModule(check),
+		})
+	}
+
+	if len(ca.Config.HTTPChecks) > 0 {
+		hub := httpcheck.HubTransport{
+			Proxy:     ca.hubProxy(),
+			RootCAs:   hubRootCAs(),
+			UserAgent: ca.userAgent(),
+		}
+		for i := range ca.Config.HTTPChecks {
+			check := &ca.Config.HTTPChecks[i]
+			ca.modules = append(ca.modules, namedModule{
+				name:     "http:" + check.Name,
+				interval: secToDuration(check.Interval),
+				Module:   httpcheck.CreateModule(check, hub),
+			})
 		}
 	}
+
+	for i := range ca.Config.CertChecks {
+		check := &ca.Config.CertChecks[i]
+		ca.modules = append(ca.modules, namedModule{
+			name:     "cert:" + check.Name,
+			interval: secToDuration(check.Interval),
+			Module:   certcheck.CreateModule(check),
+		})
+	}
+
+	for i := range ca.Config.NetChecks {
+		check := &ca.Config.NetChecks[i]
+		ca.modules = append(ca.modules, namedModule{
+			name:     "net:" + check.Name,
+			interval: secToDuration(check.Interval),
+			Module:   netcheck.CreateModule(check),
+		})
+	}
 }
 
-func (ca *Cagent) collectModulesMeasurements() ([]*monitoring.ModuleReport, error) {
-	var result []*monitoring.ModuleReport
-	var errs common.ErrorCollector
+// checkIntervals returns the intervals of the individually configured checks
+func (ca *Cagent) checkIntervals() []float64 {
+	var intervals []float64
+	for _, check := range ca.Config.NagiosChecks {
+		intervals = append(intervals, check.Interval)
+	}
+	for _, check := range ca.Config.HTTPChecks {
+		intervals = append(intervals, check.Interval)
+	}
+	for _, check := range ca.Config.CertChecks {
+		intervals = append(intervals, check.Interval)
+	}
+	for _, check := range ca.Config.NetChecks {
+		intervals = append(intervals, check.Interval)
+	}
+	return intervals
+}
 
-	ca.initModules()
+// moduleInterval returns the interval configured for the module,
+// falling back to the interval of all modules and then to the global interval
+func (ca *Cagent) moduleInterval(name string) time.Duration {
+	if _, exists := ca.Config.CollectorIntervals[name]; exists {
+		return ca.collectorInterval(name)
+	}
+	return ca.collectorInterval(modulesCollectorName)
+}
 
+// closeModules releases the resources held by the modules, e.g. the connection pools of the databases
+func closeModules(modules []namedModule) {
 	for _, m := range modules {
-		reports, err := m.Run()
-		if err != nil {
-			err = errors.Wrapf(err, "while executing module '%s'", m.GetDescription())
-			logrus.WithError(err).Debug()
-			errs.Add(err)
+		c, ok := m.Module.(io.Closer)
+		if !ok {
 			continue
 		}
-		result = append(result, reports...)
+		if err := c.Close(); err != nil {
+			logrus.WithError(err).Debugf("failed to close module '%s'", m.name)
+		}
+	}
+}
+
+// moduleTimeout returns the time limit for the module, falling back to the timeout of all modules
+func (ca *Cagent) moduleTimeout(name string) time.Duration {
+	if _, exists := ca.Config.CollectorTimeouts[name]; exists {
+		return ca.collectorTimeout(name)
 	}
+	return ca.collectorTimeout(modulesCollectorName)
+}
 
-	return result, errors.Wrap(errs.Combine(), "while collecting modules measurements")
+// moduleCollectors returns a collector for each enabled module. Every module runs with its own interval and timeout,
+// so a slow or hanging module doesn't hold up the reports of the others
+func (ca *Cagent) moduleCollectors() []collector {
+	ca.initModules()
+
+	list := make([]collector, 0, len(ca.modules))
+	for _, m := range ca.modules {
+		m := m
+		interval := m.interval
+		if interval == 0 {
+			interval = ca.moduleInterval(m.name)
+		}
+		timeout := ca.moduleTimeout(m.name)
+		if timeout < m.minTimeout {
+			timeout = m.minTimeout
+		}
+
+		list = append(list, collector{
+			name:     m.name,
+			interval: interval,
+			timeout:  timeout,
+			collect: func(_ *Cagent, _ *cleanupCommand) (common.MeasurementsMap, error) {
+				reports, err := m.Run()
+				if err != nil {
+					err = errors.Wrapf(err, "while executing module '%s'", m.GetDescription())
+					logrus.WithError(err).Debug()
+					return nil, err
+				}
+				return common.MeasurementsMap{"modules": reports}, nil
+			},
+		})
+	}
+	return list
 }
@@ -0,0 +1,113 @@
+package cagent
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/outbox"
+)
+
+const (
+	// maxOutboxReplayEntries limits the stored results sent per run, so a long backlog doesn't delay the next runs
+	maxOutboxReplayEntries = 10
+	outboxReplayTimeout    = time.Minute
+)
+
+func (ca *Cagent) getOutbox() *outbox.Outbox {
+	if !ca.Config.Outbox.Enabled {
+		return nil
+	}
+
+	if ca.outbox == nil {
+		ca.outbox = outbox.New(
+			ca.Config.Outbox.DirPath,
+			int64(ca.Config.Outbox.MaxSizeMB)*1024*1024,
+			ca.Config.Outbox.GetMaxAge(),
+		)
+	}
+
+	return ca.outbox
+}
+
+// storeInOutbox keeps the result on disk to deliver it with one of the next successful runs
+func (ca *Cagent) storeInOutbox(result *Result) error {
+	o := ca.getOutbox()
+	if o == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize result")
+	}
+
+	err = o.Put(result.Timestamp, b)
+	if err != nil {
+		return errors.Wrap(err, "failed to store result in outbox")
+	}
+
+	log.Infof("Run: measurements collected at %d stored in outbox", result.Timestamp)
+	return nil
+}
+
+// replayOutbox sends up to maxOutboxReplayEntries stored results in the order of collection. It stops on the first
+// failed attempt, so the remaining results are kept in the outbox until one of the next successful runs
+func (s *hubSink) replayOutbox() {
+	o := s.outbox
+	if o == nil {
+		return
+	}
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), outboxReplayTimeout)
+	defer cancelFn()
+
+	entries, err := o.Entries()
+	if err != nil {
+		log.WithError(err).Error("failed to list outbox entries")
+		return
+	}
+
+	if len(entries) == 0 {
+		return
+	}
+
+	left := len(entries)
+	if len(entries) > maxOutboxReplayEntries {
+		entries = entries[:maxOutboxReplayEntries]
+	}
+
+	log.Infof("sending %d of %d measurements from outbox", len(entries), left)
+	for _, e := range entries {
+		b, err := o.Read(e.ID)
+		if err != nil {
+			log.WithError(err).Error("failed to read outbox entry")
+			return
+		}
+
+		var result Result
+		if err = json.Unmarshal(b, &result); err != nil {
+			log.WithError(err).Errorf("dropping malformed outbox entry %s", e.ID)
+			if err = o.Remove(e.ID); err != nil {
+				log.WithError(err).Error()
+				return
+			}
+			continue
+		}
+
+		err = s.ca.postResultToHub(ctx, s.cfg, s.client, &result)
+		if err != nil {
+			log.WithError(err).Infof("failed to send measurements from outbox, %d entries left", left)
+			return
+		}
+
+		if err = o.Remove(e.ID); err != nil {
+			log.WithError(err).Error()
+			return
+		}
+		left--
+	}
+}
@@ -8,4 +8,13 @@ fi
 # check that user exists
 if [ -z `getent passwd cagent` ]; then
   useradd  --gid cagent --system -d /nonexistent --shell /bin/false cagent
-fi
\ No newline at end of file
+fi
+
+# the socket of the Docker Engine API is accessible by the docker group, which is root-equivalent.
+# The membership is opt-in: install with CAGENT_DOCKER_GROUP=1 in the environment.
+# Hosts upgraded from a version which ran docker via sudo had the same privilege, so they keep the docker monitoring
+if [ "$CAGENT_DOCKER_GROUP" = "1" ] || [ -f /etc/sudoers.d/cagent-docker ]; then
+  if [ -n "`getent group docker`" ]; then
+    usermod -a -G docker cagent
+  fi
+fi
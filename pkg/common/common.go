@@ -11,6 +11,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"time"
 
@@ -87,6 +88,45 @@ func FloatToIntRoundUP(f float64) int {
 	return int(f + 0.5)
 }
 
+// FormatPerSec returns the rate of a counter rounded to two decimal places.
+// A counter which decreased, e.g. reset by a restart of the server, is reported as 0
+func FormatPerSec(new int64, old int64, seconds float64) float64 {
+	v := float64(new-old) / seconds
+	if v < 0 {
+		return 0
+	}
+
+	return RoundToTwoDecimalPlaces(v)
+}
+
+// SecToDuration converts the seconds set in the config to time.Duration
+func SecToDuration(seconds float64) time.Duration {
+	return time.Duration(int64(float64(time.Second) * seconds))
+}
+
+// ToFloat converts numeric and boolean measurements including the named types, e.g. true is 1
+func ToFloat(val interface{}) (float64, bool) {
+	if val == nil {
+		return 0, false
+	}
+
+	v := reflect.ValueOf(val)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.Bool:
+		if v.Bool() {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
 // GetEnv retrieves the environment variable key. If it does not exist it returns the default.
 func GetEnv(key string, dfault string, combineWith ...string) string {
 	value := os.Getenv(key)
@@ -115,6 +155,11 @@ func HostSys(combineWith ...string) string {
 	return GetEnv("HOST_SYS", "/sys", combineWith...)
 }
 
+// HostRoot returns the path on the host filesystem, e.g. when cagent runs in a container with the host root mounted
+func HostRoot(combineWith ...string) string {
+	return GetEnv("HOST_ROOT", "/", combineWith...)
+}
+
 // ReadLines reads contents from a file and splits them by new lines.
 // A convenience wrapper to ReadLinesOffsetN(filename, 0, -1).
 // from github.com/shriou/gopsutil/internal/common.go
@@ -0,0 +1,19 @@
+// +build !windows
+
+package common
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// SetProcessGroup makes the command run in its own process group, so KillProcessGroup reaches its children as well
+func SetProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pgid: 0}
+}
+
+// KillProcessGroup sends the signal to the process group of the command started after SetProcessGroup.
+// The group ID equals the PID of the command, so the children are reached even if the command itself was reaped already
+func KillProcessGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	return syscall.Kill(-cmd.Process.Pid, sig)
+}
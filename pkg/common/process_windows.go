@@ -0,0 +1,17 @@
+// +build windows
+
+package common
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// SetProcessGroup does nothing on Windows
+func SetProcessGroup(cmd *exec.Cmd) {
+}
+
+// KillProcessGroup kills the command. There are no process groups on Windows, so the signal is ignored
+func KillProcessGroup(cmd *exec.Cmd, _ syscall.Signal) error {
+	return cmd.Process.Kill()
+}
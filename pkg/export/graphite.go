@@ -0,0 +1,71 @@
+package export
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WriteGraphite writes samples in the Graphite plaintext protocol
+// The path follows the measurement key: prefix, group, field and the label values ordered by label name
+// e.g. cagent.fs.free_B._var 1024 1546300800
+func WriteGraphite(w io.Writer, samples []Sample, prefix string, timestamp int64) error {
+	bw := bufio.NewWriter(w)
+	ts := strconv.FormatInt(timestamp, 10)
+
+	written := make(map[string]bool)
+	for i := range samples {
+		s := &samples[i]
+		if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+			continue
+		}
+
+		path := GraphitePath(prefix, s)
+		if written[path] {
+			continue
+		}
+		written[path] = true
+
+		if _, err := bw.WriteString(path + " " + strconv.FormatFloat(s.Value, 'f', -1, 64) + " " + ts + "\n"); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// GraphitePath returns the dot separated path of the sample
+func GraphitePath(prefix string, s *Sample) string {
+	parts := make([]string, 0, len(s.Labels)+3)
+	if prefix != "" {
+		parts = append(parts, strings.Trim(prefix, "."))
+	}
+	parts = append(parts, sanitizeGraphite(s.Group))
+	if s.Field != "" {
+		parts = append(parts, sanitizeGraphite(s.Field))
+	}
+	for _, l := range s.Labels {
+		parts = append(parts, sanitizeGraphite(l.Value))
+	}
+	return strings.Join(parts, ".")
+}
+
+// sanitizeGraphite replaces dots, which separate path nodes, and all characters unsafe for Graphite
+func sanitizeGraphite(s string) string {
+	if s == "" {
+		return "_"
+	}
+
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package export
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WriteInflux writes samples in the InfluxDB line protocol. Samples of the same group and labels are written as a single line
+// e.g. cagent_fs,mountpoint=/var free_B=1024,total_B=4096 1546300800000000000
+// timestamp is in seconds, it's converted to the default nanoseconds precision
+func WriteInflux(w io.Writer, samples []Sample, timestamp int64) error {
+	type line struct {
+		series string
+		fields []string
+	}
+
+	var lines []*line
+	seriesLines := make(map[string]*line)
+	for i := range samples {
+		s := &samples[i]
+		if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+			continue
+		}
+
+		series := escapeInflux(prometheusNamespace+"_"+sanitize(s.Group), ", ") + formatInfluxTags(s.Labels)
+		l, exists := seriesLines[series]
+		if !exists {
+			l = &line{series: series}
+			seriesLines[series] = l
+			lines = append(lines, l)
+		}
+
+		field := s.Field
+		if field == "" {
+			field = "value"
+		}
+		l.fields = append(l.fields, escapeInflux(field, ",= ")+"="+strconv.FormatFloat(s.Value, 'f', -1, 64))
+	}
+
+	bw := bufio.NewWriter(w)
+	ts := strconv.FormatInt(timestamp*1e9, 10)
+	for _, l := range lines {
+		if _, err := bw.WriteString(l.series + " " + strings.Join(l.fields, ",") + " " + ts + "\n"); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+func formatInfluxTags(labels []Label) string {
+	var b strings.Builder
+	for _, l := range labels {
+		// empty tag values are not allowed by the protocol
+		if l.Value == "" {
+			continue
+		}
+		b.WriteString("," + escapeInflux(l.Name, ",= ") + "=" + escapeInflux(l.Value, ",= "))
+	}
+	return b.String()
+}
+
+// escapeInflux escapes the special characters with a backslash. Newlines can't be escaped, so they are replaced
+func escapeInflux(s, special string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r == '\n' {
+			r = ' '
+		}
+		if r == '\\' || strings.ContainsRune(special, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package export
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const prometheusNamespace = "cagent"
+
+// PrometheusName returns the metric name for the sample, e.g. cagent_fs_free_B
+func PrometheusName(s *Sample) string {
+	if s.Field == "" {
+		return prometheusNamespace + "_" + sanitize(s.Group)
+	}
+	return prometheusNamespace + "_" + sanitize(s.Group) + "_" + s.Field
+}
+
+// WritePrometheus writes samples in the Prometheus text exposition format
+// samples must be sorted as returned by Samples(). All metrics are exposed as gauges
+func WritePrometheus(w io.Writer, samples []Sample) error {
+	bw := bufio.NewWriter(w)
+
+	var lastName string
+	written := make(map[string]bool)
+	for i := range samples {
+		name := PrometheusName(&samples[i])
+		series := name + formatPrometheusLabels(samples[i].Labels)
+		// duplicated series are not allowed by the format
+		if written[series] {
+			continue
+		}
+		written[series] = true
+
+		if name != lastName {
+			if _, err := bw.WriteString("# TYPE " + name + " gauge\n"); err != nil {
+				return err
+			}
+			lastName = name
+		}
+
+		if _, err := bw.WriteString(series + " " + strconv.FormatFloat(samples[i].Value, 'g', -1, 64) + "\n"); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+func formatPrometheusLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	parts := make([]string, 0, len(labels))
+	for _, l := range labels {
+		parts = append(parts, l.Name+`="`+escapePrometheusLabelValue(l.Value)+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var prometheusLabelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapePrometheusLabelValue(v string) string {
+	return prometheusLabelValueReplacer.Replace(v)
+}
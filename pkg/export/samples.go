@@ -0,0 +1,369 @@
+package export
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+)
+
+// Label is a name/value pair identifying a sample, e.g. mountpoint="/"
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single numeric value extracted from the measurements
+// Group is the first segment of the measurement key (e.g. "fs") and Field is the name of the value within that group (e.g. "free_B")
+type Sample struct {
+	Group  string
+	Field  string
+	Labels []Label
+	Value  float64
+}
+
+// listSpec describes how the elements of a list of objects are turned into samples
+type listSpec struct {
+	labels []string // element fields used as labels
+	ignore []string // element fields neither used as labels nor as values
+}
+
+// for lists not mentioned here all string fields become labels
+var listSpecs = map[string]listSpec{
+	"proc.list": {
+		labels: []string{"pid", "name", "state", "container"},
+		ignore: []string{"parent_pid", "cmdline"},
+	},
+	"docker.containers": {
+		labels: []string{"id", "name", "image", "state"},
+		ignore: []string{"status"},
+	},
+	"temperatures.list": {
+		labels: []string{"sensor_name", "unit"},
+	},
+	"listeningports.list": {
+		labels: []string{"proto", "addr", "program"},
+		ignore: []string{"pid"},
+	},
+	"cpu_utilisation_analysis.top": {
+		labels: []string{"pid", "name"},
+		ignore: []string{"command"},
+	},
+}
+
+// nestedLabels lists the names of labels for the first levels of nested maps
+var nestedLabels = map[string][]string{
+	"smartmon": {"disk"},
+}
+
+// skipKeys contains measurements which are not suitable for the export
+var skipKeys = map[string]bool{
+	"message":              true,
+	"jobmon":               true,
+	"hw.inventory":         true,
+	"proc.possible_states": true,
+}
+
+// groupsWithPrefix contains the groups which flat keys continue with a single field name followed by the object name
+var groupsWithPrefix = map[string]string{
+	"fs":  "mountpoint",
+	"net": "interface",
+}
+
+// Samples converts the measurements into the list of samples sorted by group, field and labels
+// Non-numeric values are exposed as labels of the "<group>_info" sample with value 1
+func Samples(measurements common.MeasurementsMap) []Sample {
+	var samples []Sample
+	infoLabels := make(map[string][]Label)
+
+	for key, val := range measurements {
+		if skipKeys[key] || val == nil {
+			continue
+		}
+
+		if key == "modules" {
+			samples = append(samples, moduleSamples(normalize(val))...)
+			continue
+		}
+
+		group, rest := splitKey(key)
+		switch v := normalize(val).(type) {
+		case []interface{}:
+			if !strings.Contains(key, ".") {
+				group, rest = key, ""
+			}
+			samples = append(samples, listSamples(key, group, rest, v)...)
+		case map[string]interface{}:
+			if !strings.Contains(key, ".") {
+				group, rest = key, ""
+			}
+			samples = append(samples, mapSamples(group, rest, nestedLabels[key], nil, v)...)
+		case string:
+			infoLabels[group] = append(infoLabels[group], Label{Name: sanitize(rest), Value: v})
+		default:
+			value, ok := common.ToFloat(v)
+			if !ok {
+				continue
+			}
+			field, labels := parseFlatKey(group, rest)
+			samples = append(samples, Sample{Group: group, Field: field, Labels: labels, Value: value})
+		}
+	}
+
+	for group, labels := range infoLabels {
+		samples = append(samples, Sample{Group: group, Field: "info", Labels: sortLabels(labels), Value: 1})
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		if samples[i].Group != samples[j].Group {
+			return samples[i].Group < samples[j].Group
+		}
+		if samples[i].Field != samples[j].Field {
+			return samples[i].Field < samples[j].Field
+		}
+		return labelsString(samples[i].Labels) < labelsString(samples[j].Labels)
+	})
+
+	return samples
+}
+
+func splitKey(key string) (group, rest string) {
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) == 1 {
+		// top-level keys like "operation_mode" belong to the agent itself
+		return "cagent", key
+	}
+	return parts[0], parts[1]
+}
+
+// parseFlatKey extracts the field name and labels from the rest of a flat key, e.g.
+// fs:  "free_B./var/lib"    -> free_B{mountpoint="/var/lib"}
+// net: "in_B_per_s.eth0"    -> in_B_per_s{interface="eth0"}
+// cpu: "util.idle.1.total"  -> util{mode="idle",period="avg1",core="total"}
+// cpu: "load.avg.5"         -> load{period="avg5"}
+// cagent: "collector.docker.duration_ms" -> collector_duration_ms{collector="docker"}
+func parseFlatKey(group, rest string) (string, []Label) {
+	if name, exists := groupsWithPrefix[group]; exists {
+		parts := strings.SplitN(rest, ".", 2)
+		if len(parts) == 2 {
+			return parts[0], []Label{{Name: name, Value: parts[1]}}
+		}
+		return rest, nil
+	}
+
+	if group == "cagent" && strings.HasPrefix(rest, "collector.") {
+		// the names of the module collectors may contain dots, e.g. "http:example.com"
+		name := strings.TrimPrefix(rest, "collector.")
+		if i := strings.LastIndex(name, "."); i > 0 {
+			return "collector_" + sanitize(name[i+1:]), []Label{{Name: "collector", Value: name[:i]}}
+		}
+	}
+
+	if group == "cpu" {
+		parts := strings.Split(rest, ".")
+		switch {
+		case len(parts) == 4 && parts[0] == "util":
+			return "util", []Label{
+				{Name: "core", Value: parts[3]},
+				{Name: "mode", Value: parts[1]},
+				{Name: "period", Value: "avg" + parts[2]},
+			}
+		case len(parts) == 3 && parts[0] == "load" && parts[1] == "avg":
+			return "load", []Label{{Name: "period", Value: "avg" + parts[2]}}
+		}
+	}
+
+	return sanitize(rest), nil
+}
+
+func listSamples(key, group, rest string, list []interface{}) []Sample {
+	spec, hasSpec := listSpecs[key]
+
+	var samples []Sample
+	for _, item := range list {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var labels []Label
+		values := make(map[string]float64)
+		for k, v := range obj {
+			if common.StrInSlice(k, spec.ignore) || v == nil {
+				continue
+			}
+
+			if hasSpec {
+				if common.StrInSlice(k, spec.labels) {
+					labels = append(labels, Label{Name: sanitize(k), Value: labelValue(v)})
+				} else if f, ok := common.ToFloat(v); ok {
+					values[k] = f
+				}
+				continue
+			}
+
+			if s, isString := v.(string); isString {
+				labels = append(labels, Label{Name: sanitize(k), Value: s})
+			} else if f, ok := common.ToFloat(v); ok {
+				values[k] = f
+			}
+		}
+
+		labels = sortLabels(labels)
+		if len(values) == 0 {
+			samples = append(samples, Sample{Group: group, Field: joinField(rest, "info"), Labels: labels, Value: 1})
+			continue
+		}
+
+		for k, v := range values {
+			samples = append(samples, Sample{Group: group, Field: joinField(rest, sanitize(k)), Labels: labels, Value: v})
+		}
+	}
+
+	return samples
+}
+
+// mapSamples flattens nested maps. The keys of the first nesting levels become labels if names are provided
+// the remaining keys are joined into the field name
+func mapSamples(group, field string, labelNames []string, labels []Label, m map[string]interface{}) []Sample {
+	var samples []Sample
+	for k, v := range m {
+		if v == nil {
+			continue
+		}
+
+		childField := field
+		childLabels := labels
+		childLabelNames := labelNames
+		if len(labelNames) > 0 {
+			childLabels = append(append([]Label{}, labels...), Label{Name: labelNames[0], Value: k})
+			childLabelNames = labelNames[1:]
+		} else {
+			childField = joinField(field, sanitize(k))
+		}
+
+		switch child := v.(type) {
+		case map[string]interface{}:
+			samples = append(samples, mapSamples(group, childField, childLabelNames, childLabels, child)...)
+		case []interface{}, string:
+			continue
+		default:
+			if f, ok := common.ToFloat(child); ok {
+				samples = append(samples, Sample{Group: group, Field: childField, Labels: sortLabels(childLabels), Value: f})
+			}
+		}
+	}
+	return samples
+}
+
+// moduleSamples exposes the number of alerts and warnings and the numeric measurements of each module report
+func moduleSamples(val interface{}) []Sample {
+	reports, ok := val.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var samples []Sample
+	for _, r := range reports {
+		report, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		name, _ := report["name"].(string)
+		moduleLabel := []Label{{Name: "module", Value: name}}
+
+		alerts, _ := report["alerts"].([]interface{})
+		warnings, _ := report["warnings"].([]interface{})
+		samples = append(samples,
+			Sample{Group: "module", Field: "alerts", Labels: moduleLabel, Value: float64(len(alerts))},
+			Sample{Group: "module", Field: "warnings", Labels: moduleLabel, Value: float64(len(warnings))},
+		)
+
+		measurements, _ := report["measurements"].(map[string]interface{})
+		for _, s := range mapSamples("module", "", nil, nil, measurements) {
+			samples = append(samples, Sample{
+				Group:  "module",
+				Field:  "measurement",
+				Labels: sortLabels(append([]Label{{Name: "measurement", Value: s.Field}}, moduleLabel...)),
+				Value:  s.Value,
+			})
+		}
+	}
+
+	return samples
+}
+
+// normalize converts structs and typed slices/maps into the generic JSON representation
+// so the measurements produced by different collectors can be traversed in the same way
+func normalize(val interface{}) interface{} {
+	switch val.(type) {
+	case string, bool, int, int32, int64, uint, uint32, uint64, float32, float64:
+		return val
+	}
+
+	b, err := json.Marshal(val)
+	if err != nil {
+		return nil
+	}
+
+	var res interface{}
+	if err = json.Unmarshal(b, &res); err != nil {
+		return nil
+	}
+	return res
+}
+
+func labelValue(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	b, _ := json.Marshal(val)
+	return string(b)
+}
+
+// sanitize replaces all characters which can't be used in metric and label names
+func sanitize(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+func joinField(prefix, field string) string {
+	if prefix == "" || prefix == "list" {
+		return field
+	}
+	return sanitize(prefix) + "_" + field
+}
+
+func sortLabels(labels []Label) []Label {
+	sort.SliceStable(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+	return labels
+}
+
+func labelsString(labels []Label) string {
+	parts := make([]string, 0, len(labels))
+	for _, l := range labels {
+		parts = append(parts, l.Name+"="+l.Value)
+	}
+	return strings.Join(parts, ",")
+}
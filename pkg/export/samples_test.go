@@ -0,0 +1,113 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+)
+
+func TestSamplesFlatKeys(t *testing.T) {
+	samples := Samples(common.MeasurementsMap{
+		"fs.free_B./var/lib":    uint64(1024),
+		"net.in_B_per_s.eth0":   float64(12.5),
+		"cpu.util.idle.1.total": float64(97.3),
+		"cpu.load.avg.5":        float64(0.25),
+		"operation_mode":        "full",
+		"message":               "ignored",
+
+		"cagent.collector.docker.duration_ms":           int64(15),
+		"cagent.collector.http:example.com.duration_ms": int64(20),
+	})
+
+	expected := []Sample{
+		{Group: "cagent", Field: "collector_duration_ms", Labels: []Label{{Name: "collector", Value: "docker"}}, Value: 15},
+		{Group: "cagent", Field: "collector_duration_ms", Labels: []Label{{Name: "collector", Value: "http:example.com"}}, Value: 20},
+		{Group: "cagent", Field: "info", Labels: []Label{{Name: "operation_mode", Value: "full"}}, Value: 1},
+		{Group: "cpu", Field: "load", Labels: []Label{{Name: "period", Value: "avg5"}}, Value: 0.25},
+		{Group: "cpu", Field: "util", Labels: []Label{
+			{Name: "core", Value: "total"},
+			{Name: "mode", Value: "idle"},
+			{Name: "period", Value: "avg1"},
+		}, Value: 97.3},
+		{Group: "fs", Field: "free_B", Labels: []Label{{Name: "mountpoint", Value: "/var/lib"}}, Value: 1024},
+		{Group: "net", Field: "in_B_per_s", Labels: []Label{{Name: "interface", Value: "eth0"}}, Value: 12.5},
+	}
+	assert.Equal(t, expected, samples)
+}
+
+func TestSamplesLists(t *testing.T) {
+	samples := Samples(common.MeasurementsMap{
+		"temperatures.list": []map[string]interface{}{
+			{"sensor_name": "coretemp_core0", "temperature": 45.0, "unit": "celsius"},
+		},
+	})
+
+	assert.Equal(t, []Sample{
+		{Group: "temperatures", Field: "temperature", Labels: []Label{
+			{Name: "sensor_name", Value: "coretemp_core0"},
+			{Name: "unit", Value: "celsius"},
+		}, Value: 45},
+	}, samples)
+}
+
+func TestWritePrometheus(t *testing.T) {
+	samples := Samples(common.MeasurementsMap{
+		"fs.free_B./":      uint64(10),
+		"fs.free_B./home":  uint64(20),
+		"system.os_kernel": "linux \"5.4\"",
+		"cagent.success":   1,
+	})
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WritePrometheus(buf, samples))
+
+	expected := `# TYPE cagent_cagent_success gauge
+cagent_cagent_success 1
+# TYPE cagent_fs_free_B gauge
+cagent_fs_free_B{mountpoint="/"} 10
+cagent_fs_free_B{mountpoint="/home"} 20
+# TYPE cagent_system_info gauge
+cagent_system_info{os_kernel="linux \"5.4\""} 1
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestWriteInflux(t *testing.T) {
+	samples := Samples(common.MeasurementsMap{
+		"fs.free_B./mnt/my disk":  uint64(10),
+		"fs.total_B./mnt/my disk": uint64(40),
+		"temperatures.list": []map[string]interface{}{
+			{"sensor_name": "acpitz,1", "temperature": 27.8, "unit": ""},
+		},
+	})
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WriteInflux(buf, samples, 1546300800))
+
+	expected := `cagent_fs,mountpoint=/mnt/my\ disk free_B=10,total_B=40 1546300800000000000
+cagent_temperatures,sensor_name=acpitz\,1 temperature=27.8 1546300800000000000
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestWriteGraphite(t *testing.T) {
+	samples := Samples(common.MeasurementsMap{
+		"fs.free_B./var/lib":    uint64(10),
+		"cpu.util.idle.1.total": float64(97.3),
+		"smartmon": map[string]interface{}{
+			"sda": map[string]interface{}{"Temperature_Celsius": 35},
+		},
+	})
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WriteGraphite(buf, samples, "servers.web1", 1546300800))
+
+	expected := `servers.web1.cpu.util.total.idle.avg1 97.3 1546300800
+servers.web1.fs.free_B._var_lib 10 1546300800
+servers.web1.smartmon.Temperature_Celsius.sda 35 1546300800
+`
+	assert.Equal(t, expected, buf.String())
+}
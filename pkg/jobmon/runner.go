@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"os/user"
+	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -96,7 +97,7 @@ func (r *Runner) waitForInterruptionSignal(ch chan os.Signal, cmd *exec.Cmd, run
 	if isProcessFinished(cmd) {
 		return
 	}
-	osSpecificCommandTermination(cmd)
+	_ = common.KillProcessGroup(cmd, syscall.SIGTERM)
 	msg := "Jobmon has received an interruption signal and all subprocesses have been terminated. This normally means someone has ended jobmon."
 	runResult.AddError(msg)
 }
@@ -107,7 +108,7 @@ func (r *Runner) createMaxExecutionTimeoutHandler(cmd *exec.Cmd, runResult *JobR
 		if isProcessFinished(cmd) {
 			return
 		}
-		osSpecificCommandTermination(cmd)
+		_ = common.KillProcessGroup(cmd, syscall.SIGTERM)
 		msg := fmt.Sprintf(
 			"Command has been terminated by jobmon because the maximum execution time of %s exceeded.",
 			timeout.String(),
@@ -123,7 +124,8 @@ func (r *Runner) createJobCommand() *exec.Cmd {
 		commandArgs = r.cfg.Command[1:]
 	}
 	cmd := exec.Command(commandName, commandArgs...)
-	osSpecificCommandConfig(cmd)
+	// create a job in a different process group
+	common.SetProcessGroup(cmd)
 	return cmd
 }
 
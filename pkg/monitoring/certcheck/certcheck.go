@@ -0,0 +1,246 @@
+package certcheck
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+)
+
+const (
+	StartTLSSMTP     = "smtp"
+	StartTLSIMAP     = "imap"
+	StartTLSPostgres = "postgres"
+
+	defaultTimeout     = 10 * time.Second
+	defaultWarningDays = 30
+	defaultAlertDays   = 7
+)
+
+var log = logrus.WithField("package", "certcheck")
+
+// Check monitors the certificates of a TLS endpoint or of the files on disk
+type Check struct {
+	Name        string  `toml:"name" comment:"Name of the check used in the module report"`
+	Address     string  `toml:"address" comment:"host:port of the TLS endpoint"`
+	ServerName  string  `toml:"server_name" comment:"Server name sent with SNI and used to verify the certificate. Default: the host of the address"`
+	StartTLS    string  `toml:"starttls" comment:"Upgrade a plain connection with STARTTLS. Possible values: 'smtp', 'imap', 'postgres'"`
+	Path        string  `toml:"path" comment:"PEM or DER certificate file or a directory searched recursively for *.pem, *.crt, *.cer and *.der files"`
+	IncludeCA   bool    `toml:"include_ca" comment:"Also report the CA certificates found in the files, e.g. the intermediates of a fullchain.pem. Default: false"`
+	WarningDays float64 `toml:"warning_days" comment:"Warn if a certificate expires in less than N days. Default: 30"`
+	AlertDays   float64 `toml:"alert_days" comment:"Alert if a certificate expires in less than N days. Default: 7"`
+	Timeout     float64 `toml:"timeout" comment:"Time limit in seconds to connect to the endpoint and complete the handshake. Default: 10"`
+	Interval    float64 `toml:"interval" comment:"Run the check every N seconds. Default: the interval of the modules"`
+}
+
+func (c *Check) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("name is empty")
+	}
+
+	if (c.Address == "") == (c.Path == "") {
+		return fmt.Errorf("either address or path should be set")
+	}
+
+	if c.Address != "" {
+		if _, _, err := net.SplitHostPort(c.Address); err != nil {
+			return fmt.Errorf("invalid address: %s", err.Error())
+		}
+	}
+
+	switch c.StartTLS {
+	case "", StartTLSSMTP, StartTLSIMAP, StartTLSPostgres:
+	default:
+		return fmt.Errorf("unknown starttls '%s'. Possible values: %s, %s, %s", c.StartTLS, StartTLSSMTP, StartTLSIMAP, StartTLSPostgres)
+	}
+
+	if c.WarningDays < 0 || c.AlertDays < 0 || c.Timeout < 0 || c.Interval < 0 {
+		return fmt.Errorf("warning_days, alert_days, timeout and interval should be equal or greater than 0")
+	}
+
+	return nil
+}
+
+func (c *Check) GetTimeout() time.Duration {
+	if c.Timeout == 0 {
+		return defaultTimeout
+	}
+	return time.Duration(int64(float64(time.Second) * c.Timeout))
+}
+
+func (c *Check) GetWarningDays() float64 {
+	if c.WarningDays == 0 {
+		return defaultWarningDays
+	}
+	return c.WarningDays
+}
+
+func (c *Check) GetAlertDays() float64 {
+	if c.AlertDays == 0 {
+		return defaultAlertDays
+	}
+	return c.AlertDays
+}
+
+func (c *Check) getServerName() string {
+	if c.ServerName != "" {
+		return c.ServerName
+	}
+	host, _, _ := net.SplitHostPort(c.Address)
+	return host
+}
+
+type CertCheck struct {
+	check *Check
+	// roots is nil to verify with the system roots
+	roots *x509.CertPool
+}
+
+func CreateModule(check *Check) monitoring.Module {
+	return &CertCheck{check: check}
+}
+
+func (c *CertCheck) GetDescription() string {
+	return fmt.Sprintf("certificate check '%s'", c.check.Name)
+}
+
+func (c *CertCheck) IsEnabled() bool {
+	return c.check.Address != "" || c.check.Path != ""
+}
+
+func (c *CertCheck) Run() ([]*monitoring.ModuleReport, error) {
+	now := time.Now()
+	target := c.check.Address
+	if target == "" {
+		target = c.check.Path
+	}
+	report := monitoring.NewReport(fmt.Sprintf("certificate check %s", c.check.Name), now, target)
+	report.Measurements = map[string]interface{}{}
+
+	if c.check.Address != "" {
+		chain, err := c.fetchChain()
+		if err != nil {
+			report.AddAlert(fmt.Sprintf("%s: %s", c.check.Address, err.Error()))
+			return []*monitoring.ModuleReport{&report}, nil
+		}
+
+		info := c.certInfo(chain, c.check.getServerName(), now)
+		report.Measurements[c.check.Address] = info
+		c.addExpiryAlerts(&report, c.check.Address, info)
+		if !info.ChainValid {
+			report.AddAlert(fmt.Sprintf("%s: certificate chain is not valid: %s", c.check.Address, info.ChainError))
+		}
+
+		return []*monitoring.ModuleReport{&report}, nil
+	}
+
+	files, err := certFiles(c.check.Path)
+	if err != nil {
+		report.AddAlert(err.Error())
+		return []*monitoring.ModuleReport{&report}, nil
+	}
+
+	for _, f := range files {
+		certs, err := readCertFile(f)
+		if err != nil {
+			log.WithError(err).Debugf("skipping %s", f)
+			continue
+		}
+
+		var indexes []int
+		for i, cert := range certs {
+			if cert.IsCA && !c.check.IncludeCA {
+				continue
+			}
+			indexes = append(indexes, i)
+		}
+
+		for _, i := range indexes {
+			// files with several certificates, e.g. bundles, are reported by the position of the certificate
+			key := f
+			if len(indexes) > 1 {
+				key = fmt.Sprintf("%s#%d", f, i+1)
+			}
+
+			// the other certificates of the file are used as intermediates.
+			// Local files often don't contain the intermediates, so the chain validity is informational only
+			chain := append([]*x509.Certificate{certs[i]}, certs[:i]...)
+			chain = append(chain, certs[i+1:]...)
+			info := c.certInfo(chain, "", now)
+			report.Measurements[key] = info
+			c.addExpiryAlerts(&report, key, info)
+		}
+	}
+
+	if len(report.Measurements) == 0 {
+		report.AddWarning(fmt.Sprintf("no certificates found in %s", c.check.Path))
+	}
+
+	return []*monitoring.ModuleReport{&report}, nil
+}
+
+func (c *CertCheck) addExpiryAlerts(report *monitoring.ModuleReport, target string, info *CertInfo) {
+	switch {
+	case info.DaysToExpiry <= 0:
+		report.AddAlert(fmt.Sprintf("%s: certificate '%s' expired on %s", target, info.Subject, info.NotAfter.Format("2006-01-02")))
+	case info.DaysToExpiry < c.check.GetAlertDays():
+		report.AddAlert(fmt.Sprintf("%s: certificate '%s' expires in %.0f days", target, info.Subject, info.DaysToExpiry))
+	case info.DaysToExpiry < c.check.GetWarningDays():
+		report.AddWarning(fmt.Sprintf("%s: certificate '%s' expires in %.0f days", target, info.Subject, info.DaysToExpiry))
+	}
+}
+
+// CertInfo describes the leaf certificate
+type CertInfo struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SANs         []string  `json:"sans"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	DaysToExpiry float64   `json:"days_to_expiry"`
+	ChainValid   bool      `json:"chain_valid"`
+	ChainError   string    `json:"chain_error,omitempty"`
+}
+
+// certInfo describes the first certificate of the chain, the others are used as intermediates
+func (c *CertCheck) certInfo(chain []*x509.Certificate, serverName string, now time.Time) *CertInfo {
+	leaf := chain[0]
+
+	sans := append([]string{}, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, leaf.EmailAddresses...)
+
+	info := &CertInfo{
+		Subject:      leaf.Subject.String(),
+		Issuer:       leaf.Issuer.String(),
+		SANs:         sans,
+		NotBefore:    leaf.NotBefore,
+		NotAfter:     leaf.NotAfter,
+		DaysToExpiry: common.RoundToTwoDecimalPlaces(leaf.NotAfter.Sub(now).Hours() / 24),
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Intermediates: intermediates,
+		Roots:         c.roots,
+		CurrentTime:   now,
+	})
+	info.ChainValid = err == nil
+	if err != nil {
+		info.ChainError = err.Error()
+	}
+
+	return info
+}
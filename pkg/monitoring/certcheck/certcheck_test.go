@@ -0,0 +1,232 @@
+package certcheck
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/moduletest"
+)
+
+type testPKI struct {
+	ca      *x509.Certificate
+	caKey   *ecdsa.PrivateKey
+	roots   *x509.CertPool
+	leaf    *x509.Certificate
+	leafKey *ecdsa.PrivateKey
+}
+
+func newTestPKI(t *testing.T, leafValidFor time.Duration) *testPKI {
+	p := &testPKI{}
+	var err error
+
+	p.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &p.caKey.PublicKey, p.caKey)
+	require.NoError(t, err)
+	p.ca, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+	p.roots = x509.NewCertPool()
+	p.roots.AddCert(p.ca)
+
+	p.leafKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(leafValidFor),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err = x509.CreateCertificate(rand.Reader, leafTemplate, p.ca, &p.leafKey.PublicKey, p.caKey)
+	require.NoError(t, err)
+	p.leaf, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return p
+}
+
+func (p *testPKI) tlsConfig() *tls.Config {
+	return &tls.Config{Certificates: []tls.Certificate{{
+		Certificate: [][]byte{p.leaf.Raw, p.ca.Raw},
+		PrivateKey:  p.leafKey,
+	}}}
+}
+
+func pemEncode(certs ...*x509.Certificate) []byte {
+	var res []byte
+	for _, c := range certs {
+		res = append(res, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	return res
+}
+
+func TestCheckValidate(t *testing.T) {
+	assert.NoError(t, (&Check{Name: "web", Address: "example.com:443"}).Validate())
+	assert.NoError(t, (&Check{Name: "files", Path: "/etc/ssl"}).Validate())
+	assert.Error(t, (&Check{Name: "both", Address: "example.com:443", Path: "/etc/ssl"}).Validate())
+	assert.Error(t, (&Check{Name: "no port", Address: "example.com"}).Validate())
+	assert.Error(t, (&Check{Name: "ftp", Address: "example.com:21", StartTLS: "ftp"}).Validate())
+}
+
+func TestFiles(t *testing.T) {
+	p := newTestPKI(t, 20*24*time.Hour)
+	other := newTestPKI(t, 60*24*time.Hour)
+
+	dir, err := ioutil.TempDir("", "certcheck")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "live"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "live", "fullchain.pem"), pemEncode(p.leaf, p.ca), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "bundle.crt"), pemEncode(p.leaf, other.ca, other.leaf), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ca.der"), p.ca.Raw, 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "privkey.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{1}}), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a cert"), 0644))
+
+	t.Run("leaf certificates", func(t *testing.T) {
+		measurements, alerts, warnings := moduletest.Run(t, &CertCheck{check: &Check{Name: "files", Path: dir}, roots: p.roots})
+		assert.Len(t, measurements, 3)
+		assert.Empty(t, alerts)
+		if assert.Len(t, warnings, 2) {
+			assert.Contains(t, warnings[0], "bundle.crt#1: certificate 'CN=localhost' expires in 20 days")
+			assert.Contains(t, warnings[1], "fullchain.pem: certificate 'CN=localhost' expires in 20 days")
+		}
+
+		info := measurements[filepath.Join(dir, "live", "fullchain.pem")].(*CertInfo)
+		assert.Equal(t, "CN=Test CA", info.Issuer)
+		assert.Equal(t, []string{"localhost", "127.0.0.1"}, info.SANs)
+		assert.True(t, info.ChainValid)
+
+		info = measurements[filepath.Join(dir, "bundle.crt#3")].(*CertInfo)
+		assert.Equal(t, other.leaf.NotAfter, info.NotAfter)
+	})
+
+	t.Run("include CA", func(t *testing.T) {
+		measurements, _, _ := moduletest.Run(t, &CertCheck{check: &Check{Name: "files", Path: dir, IncludeCA: true}, roots: p.roots})
+		assert.Len(t, measurements, 6)
+
+		info := measurements[filepath.Join(dir, "ca.der")].(*CertInfo)
+		assert.Equal(t, "CN=Test CA", info.Subject)
+		assert.Contains(t, measurements, filepath.Join(dir, "live", "fullchain.pem#2"))
+	})
+}
+
+func TestEndpoint(t *testing.T) {
+	p := newTestPKI(t, 3*24*time.Hour)
+
+	t.Run("tls", func(t *testing.T) {
+		l, err := tls.Listen("tcp", "127.0.0.1:0", p.tlsConfig())
+		require.NoError(t, err)
+		defer l.Close()
+		go serve(l, func(conn net.Conn) {
+			_ = conn.(*tls.Conn).Handshake()
+		})
+
+		measurements, alerts, _ := moduletest.Run(t, &CertCheck{check: &Check{Name: "tls", Address: l.Addr().String(), ServerName: "localhost"}, roots: p.roots})
+		if assert.Len(t, alerts, 1) {
+			assert.Contains(t, alerts[0], "certificate 'CN=localhost' expires in 3 days")
+		}
+		info := measurements[l.Addr().String()].(*CertInfo)
+		assert.True(t, info.ChainValid)
+
+		_, alerts, _ = moduletest.Run(t, &CertCheck{check: &Check{Name: "tls", Address: l.Addr().String(), ServerName: "example.com"}, roots: p.roots})
+		assert.Len(t, alerts, 2, "the name doesn't match")
+	})
+
+	for _, tc := range []struct {
+		startTLS string
+		server   func(conn net.Conn) net.Conn
+	}{
+		{StartTLSSMTP, func(conn net.Conn) net.Conn {
+			r := bufio.NewReader(conn)
+			_, _ = io.WriteString(conn, "220 mail.example.com ESMTP\r\n")
+			line, _ := r.ReadString('\n')
+			if !strings.HasPrefix(line, "EHLO") {
+				return nil
+			}
+			_, _ = io.WriteString(conn, "250-mail.example.com\r\n250-PIPELINING\r\n250 STARTTLS\r\n")
+			if line, _ = r.ReadString('\n'); line != "STARTTLS\r\n" {
+				return nil
+			}
+			_, _ = io.WriteString(conn, "220 Ready to start TLS\r\n")
+			return conn
+		}},
+		{StartTLSIMAP, func(conn net.Conn) net.Conn {
+			r := bufio.NewReader(conn)
+			_, _ = io.WriteString(conn, "* OK IMAP4rev1 ready\r\n")
+			if line, _ := r.ReadString('\n'); line != "a1 STARTTLS\r\n" {
+				return nil
+			}
+			_, _ = io.WriteString(conn, "a1 OK Begin TLS negotiation now\r\n")
+			return conn
+		}},
+		{StartTLSPostgres, func(conn net.Conn) net.Conn {
+			req := make([]byte, 8)
+			if _, err := io.ReadFull(conn, req); err != nil {
+				return nil
+			}
+			_, _ = conn.Write([]byte("S"))
+			return conn
+		}},
+	} {
+		t.Run(tc.startTLS, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer l.Close()
+
+			server := tc.server
+			go serve(l, func(conn net.Conn) {
+				if conn = server(conn); conn != nil {
+					_ = tls.Server(conn, p.tlsConfig()).Handshake()
+				}
+			})
+
+			measurements, _, _ := moduletest.Run(t, &CertCheck{check: &Check{Name: tc.startTLS, Address: l.Addr().String(), ServerName: "localhost", StartTLS: tc.startTLS}, roots: p.roots})
+			if assert.Contains(t, measurements, l.Addr().String()) {
+				assert.Equal(t, "CN=localhost", measurements[l.Addr().String()].(*CertInfo).Subject)
+			}
+		})
+	}
+}
+
+func serve(l net.Listener, handle func(conn net.Conn)) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			handle(conn)
+		}()
+	}
+}
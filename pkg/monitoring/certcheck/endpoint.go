@@ -0,0 +1,140 @@
+package certcheck
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// postgresSSLRequestCode is sent by a client to request the encryption
+const postgresSSLRequestCode = 80877103
+
+// fetchChain connects to the endpoint and returns the certificates presented by the server
+func (c *CertCheck) fetchChain() ([]*x509.Certificate, error) {
+	timeout := c.check.GetTimeout()
+	conn, err := net.DialTimeout("tcp", c.check.Address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	switch c.check.StartTLS {
+	case StartTLSSMTP:
+		err = startTLSSMTP(conn)
+	case StartTLSIMAP:
+		err = startTLSIMAP(conn)
+	case StartTLSPostgres:
+		err = startTLSPostgres(conn)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("starttls: %s", err.Error())
+	}
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName: c.check.getServerName(),
+		// the chain is verified separately to report the details even for invalid certificates
+		InsecureSkipVerify: true,
+	})
+	if err = tlsConn.Handshake(); err != nil {
+		return nil, fmt.Errorf("tls handshake: %s", err.Error())
+	}
+
+	chain := tlsConn.ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificates presented")
+	}
+
+	return chain, nil
+}
+
+func startTLSSMTP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if err := expectSMTPReply(r, "220"); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(conn, "EHLO cagent\r\n"); err != nil {
+		return err
+	}
+	if err := expectSMTPReply(r, "250"); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(conn, "STARTTLS\r\n"); err != nil {
+		return err
+	}
+	return expectSMTPReply(r, "220")
+}
+
+// expectSMTPReply reads a possibly multiline reply and checks its code
+func expectSMTPReply(r *bufio.Reader, code string) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(line, code) {
+			return fmt.Errorf("unexpected reply: %s", strings.TrimSpace(line))
+		}
+		// "250-" continues a multiline reply, "250 " ends it
+		if len(line) < 4 || line[3] != '-' {
+			return nil
+		}
+	}
+}
+
+func startTLSIMAP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	greeting, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		return fmt.Errorf("unexpected greeting: %s", strings.TrimSpace(greeting))
+	}
+
+	if _, err = io.WriteString(conn, "a1 STARTTLS\r\n"); err != nil {
+		return err
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "a1 ") {
+			if !strings.HasPrefix(line, "a1 OK") {
+				return fmt.Errorf("unexpected reply: %s", strings.TrimSpace(line))
+			}
+			return nil
+		}
+	}
+}
+
+func startTLSPostgres(conn net.Conn) error {
+	req := make([]byte, 8)
+	binary.BigEndian.PutUint32(req[0:4], 8)
+	binary.BigEndian.PutUint32(req[4:8], postgresSSLRequestCode)
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	resp := make([]byte, 1)
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return err
+	}
+	if resp[0] != 'S' {
+		return fmt.Errorf("server doesn't support SSL")
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package certcheck
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var certFileExtensions = map[string]bool{".pem": true, ".crt": true, ".cer": true, ".der": true}
+
+// certFiles returns the path itself if it's a file or the certificate files found in the directory
+func certFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			// unreadable entries are skipped
+			return nil
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			// e.g. /etc/letsencrypt/live contains symlinks to the archive
+			if info, err = os.Stat(p); err != nil {
+				return nil
+			}
+		}
+
+		if !info.IsDir() && certFileExtensions[strings.ToLower(filepath.Ext(p))] {
+			files = append(files, p)
+		}
+		return nil
+	})
+	sort.Strings(files)
+
+	return files, err
+}
+
+// readCertFile parses all PEM encoded certificates of the file or a single DER encoded one
+func readCertFile(path string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			// e.g. private keys
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) > 0 {
+		return certs, nil
+	}
+
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, fmt.Errorf("no certificates found")
+	}
+
+	return []*x509.Certificate{cert}, nil
+}
@@ -0,0 +1,197 @@
+// +build !windows
+
+package docker
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHost       = "unix:///var/run/docker.sock"
+	apiRequestTimeout = 10 * time.Second
+)
+
+var errContainerNotFound = errors.New("container not found")
+
+// apiClient talks to the Docker Engine API at DOCKER_HOST or the default socket
+type apiClient struct {
+	http    *http.Client
+	baseURL string
+}
+
+var (
+	defaultClient    *apiClient
+	defaultClientErr error
+	defaultClientMu  sync.Mutex
+)
+
+func getClient() (*apiClient, error) {
+	defaultClientMu.Lock()
+	defer defaultClientMu.Unlock()
+
+	if defaultClient == nil && defaultClientErr == nil {
+		defaultClient, defaultClientErr = newAPIClient(os.Getenv("DOCKER_HOST"))
+	}
+	return defaultClient, defaultClientErr
+}
+
+func newAPIClient(host string) (*apiClient, error) {
+	if host == "" {
+		host = defaultHost
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCKER_HOST '%s': %s", host, err.Error())
+	}
+
+	transport := &http.Transport{
+		MaxIdleConns:    2,
+		IdleConnTimeout: time.Minute,
+	}
+	c := &apiClient{http: &http.Client{Transport: transport, Timeout: apiRequestTimeout}}
+
+	switch u.Scheme {
+	case "unix":
+		socketPath := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			d := net.Dialer{}
+			return d.DialContext(ctx, "unix", socketPath)
+		}
+		// the host is ignored when connecting to a unix socket
+		c.baseURL = "http://docker"
+	case "tcp":
+		c.baseURL = "http://" + u.Host
+		if os.Getenv("DOCKER_TLS_VERIFY") != "" {
+			transport.TLSClientConfig, err = clientTLSConfig()
+			if err != nil {
+				return nil, err
+			}
+			c.baseURL = "https://" + u.Host
+		}
+	default:
+		return nil, fmt.Errorf("unsupported DOCKER_HOST '%s', use unix:// or tcp://", host)
+	}
+
+	return c, nil
+}
+
+// clientTLSConfig loads the certificates from DOCKER_CERT_PATH the same way the docker CLI does
+func clientTLSConfig() (*tls.Config, error) {
+	certPath := os.Getenv("DOCKER_CERT_PATH")
+	if certPath == "" {
+		certPath = filepath.Join(os.Getenv("HOME"), ".docker")
+	}
+
+	caPEM, err := ioutil.ReadFile(filepath.Join(certPath, "ca.pem"))
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", filepath.Join(certPath, "ca.pem"))
+	}
+
+	cert, err := tls.LoadX509KeyPair(filepath.Join(certPath, "cert.pem"), filepath.Join(certPath, "key.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{cert}}, nil
+}
+
+func (c *apiClient) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return errContainerNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("GET %s: %s %s", path, resp.Status, apiErr.Message)
+	}
+
+	if v == nil {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+type containerSummary struct {
+	ID     string `json:"Id"`
+	Names  []string
+	Image  string
+	State  string
+	Status string
+}
+
+type containerInspect struct {
+	Name         string
+	RestartCount int
+	State        struct {
+		Status    string
+		OOMKilled bool
+		Health    *struct {
+			Status        string
+			FailingStreak int
+		}
+	}
+}
+
+type cpuStats struct {
+	CPUUsage struct {
+		TotalUsage  uint64   `json:"total_usage"`
+		PercpuUsage []uint64 `json:"percpu_usage"`
+	} `json:"cpu_usage"`
+	SystemUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs  uint32 `json:"online_cpus"`
+}
+
+type containerStats struct {
+	CPUStats    cpuStats `json:"cpu_stats"`
+	PreCPUStats cpuStats `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+	BlkioStats struct {
+		IOServiceBytesRecursive []struct {
+			Op    string `json:"op"`
+			Value uint64 `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+}
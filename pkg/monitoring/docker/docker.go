@@ -8,6 +8,31 @@ import (
 )
 
 var ErrorNotImplementedForOS = errors.New("docker support not implemented for " + runtime.GOOS)
-var ErrorDockerNotAvailable = errors.New("docker executable not found on the system or the service is stopped")
+var ErrorDockerNotAvailable = errors.New("docker daemon not found on the system or the service is stopped")
+var ErrorDockerPermissionDenied = errors.New("no permission to access the Docker daemon, add the cagent user to the docker group")
 
 var log = logrus.WithField("package", "docker")
+
+// Watcher lists the containers with their resource usage. It keeps the previous samples to calculate
+// the CPU usage and to detect restart loops
+type Watcher struct {
+	restartLoopThreshold int
+
+	restartCounts map[string]int
+	cpuSamples    map[string]cpuSample
+}
+
+type cpuSample struct {
+	total  uint64
+	system uint64
+}
+
+// NewWatcher returns a watcher which alerts if a container was restarted at least restartLoopThreshold times
+// between two runs. 0 disables the check
+func NewWatcher(restartLoopThreshold int) *Watcher {
+	return &Watcher{
+		restartLoopThreshold: restartLoopThreshold,
+		restartCounts:        make(map[string]int),
+		cpuSamples:           make(map[string]cpuSample),
+	}
+}
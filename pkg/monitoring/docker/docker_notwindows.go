@@ -3,148 +3,329 @@
 package docker
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
-	"os/exec"
-	"runtime"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloudradar-monitoring/cagent/pkg/common"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
 )
 
-type dockerPsOutput struct {
-	ID     string
-	Image  string
-	Status string
-	Names  string
-}
-
 const dockerAvailabilityCheckCacheExpiration = 1 * time.Minute
-const cmdExecTimeout = 10 * time.Second
+
+// the group membership of the running process doesn't change, so the missing permission is checked less often
+const dockerPermissionDeniedCacheExpiration = 10 * time.Minute
+
+// maxParallelRequests limits the concurrent requests for the details of the containers
+const maxParallelRequests = 8
+
+// containerDetailsTimeout bounds the time of all requests for the details of the containers below the collector timeout.
+// Containers not reached in time are reported without the resource usage
+var containerDetailsTimeout = 20 * time.Second
 
 var dockerIsAvailable bool
+var dockerAvailabilityErr error
 var dockerAvailabilityLastRequestedAt *time.Time
+var dockerPermissionDeniedLogged bool
+var dockerAvailabilityMu sync.Mutex
+
+// isDockerAvailable maintains a simple cache to prevent pinging the Docker daemon too often.
+// It returns ErrorDockerPermissionDenied if the daemon is running but not accessible
+func isDockerAvailable() (bool, error) {
+	dockerAvailabilityMu.Lock()
+	defer dockerAvailabilityMu.Unlock()
 
-// isDockerAvailable maintains a simple cache to prevent executing shell commands too often
-func isDockerAvailable() bool {
 	now := time.Now()
-	if dockerAvailabilityLastRequestedAt != nil &&
-		now.Sub(*dockerAvailabilityLastRequestedAt) < dockerAvailabilityCheckCacheExpiration {
-		return dockerIsAvailable
+	expiration := dockerAvailabilityCheckCacheExpiration
+	if dockerAvailabilityErr == ErrorDockerPermissionDenied {
+		expiration = dockerPermissionDeniedCacheExpiration
+	}
+	if dockerAvailabilityLastRequestedAt != nil && now.Sub(*dockerAvailabilityLastRequestedAt) < expiration {
+		return dockerIsAvailable, dockerAvailabilityErr
 	}
 
-	_, err := exec.LookPath("docker")
-	dockerIsAvailable = err == nil
-
-	if dockerIsAvailable {
-		dockerPrefix := ""
-		if runtime.GOOS == "linux" {
-			dockerPrefix = "sudo "
-		}
-
-		_, err := common.RunCommandWithTimeout(cmdExecTimeout, "/bin/sh", "-c", dockerPrefix+"docker info")
-		if err != nil {
-			log.WithError(err).Debug("while executing 'docker info' to check if docker is available")
+	dockerIsAvailable, dockerAvailabilityErr = false, nil
+	client, err := getClient()
+	if err != nil {
+		dockerAvailabilityErr = err
+	} else if err = client.get(context.Background(), "/_ping", nil); err == nil {
+		dockerIsAvailable = true
+		dockerPermissionDeniedLogged = false
+	} else if errors.Is(err, os.ErrPermission) {
+		dockerAvailabilityErr = ErrorDockerPermissionDenied
+		if !dockerPermissionDeniedLogged {
+			log.WithError(err).Warn(ErrorDockerPermissionDenied.Error())
+			dockerPermissionDeniedLogged = true
 		}
-		dockerIsAvailable = dockerIsAvailable && (err == nil)
+	} else {
+		log.WithError(err).Debug("while pinging the Docker daemon to check if docker is available")
 	}
 
 	dockerAvailabilityLastRequestedAt = &now
-	return dockerIsAvailable
+	return dockerIsAvailable, dockerAvailabilityErr
+}
+
+func containerStateToState(state string) string {
+	switch state {
+	case "exited":
+		return "stopped"
+	case "":
+		// just in case we got empty state somehow
+		return "unknown"
+	}
+
+	// As of docker 20.10 it can be one of: created, running, paused, restarting, removing, dead
+	return state
 }
 
-func containerStatusToState(status string) string {
-	status = strings.ToLower(status)
+// ListContainers returns the containers with their resource usage and the report with the alerts
+// about unhealthy and restart-looping containers
+func (w *Watcher) ListContainers() (map[string]interface{}, *monitoring.ModuleReport, error) {
+	available, err := isDockerAvailable()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !available {
+		return nil, nil, ErrorDockerNotAvailable
+	}
 
-	if strings.HasPrefix(status, "up") {
-		if strings.HasSuffix(status, "(paused)") {
-			return "paused"
+	client, _ := getClient()
+	now := time.Now()
+
+	var summaries []containerSummary
+	if err = client.get(context.Background(), "/containers/json?all=1", &summaries); err != nil {
+		log.WithError(err).Error("can't list containers")
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), containerDetailsTimeout)
+	defer cancel()
+
+	containers := make([]*containerInfo, len(summaries))
+	wg := sync.WaitGroup{}
+	semaphore := make(chan struct{}, maxParallelRequests)
+	for i, s := range summaries {
+		wg.Add(1)
+		go func(i int, s containerSummary) {
+			defer wg.Done()
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+				containers[i] = getContainerInfo(ctx, client, s)
+			case <-ctx.Done():
+				containers[i] = &containerInfo{summary: s}
+			}
+		}(i, s)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		incomplete := 0
+		for _, c := range containers {
+			if c.inspect == nil || (c.summary.State == "running" && c.stats == nil) {
+				incomplete++
+			}
 		}
+		log.Warnf("the details of %d of %d containers were not received within %s", incomplete, len(containers), containerDetailsTimeout)
+	}
 
-		return "running"
+	report := monitoring.NewReport("docker containers health", now, "")
+	var containersResults []map[string]interface{}
+	restartCounts := make(map[string]int, len(containers))
+	cpuSamples := make(map[string]cpuSample, len(containers))
+	unhealthy := 0
+	for _, c := range containers {
+		result := map[string]interface{}{
+			"id":     c.summary.ID,
+			"image":  c.summary.Image,
+			"name":   c.name(),
+			"state":  containerStateToState(c.summary.State),
+			"status": c.summary.Status,
+		}
+
+		if c.inspect != nil {
+			result["restart_count"] = c.inspect.RestartCount
+			result["oom_killed"] = c.inspect.State.OOMKilled
+			result["health"] = ""
+			if h := c.inspect.State.Health; h != nil {
+				result["health"] = h.Status
+				if h.Status == "unhealthy" {
+					unhealthy++
+					report.AddAlert(fmt.Sprintf("container '%s' is unhealthy, %d health checks failed in a row", c.name(), h.FailingStreak))
+				}
+			}
+
+			restartCounts[c.summary.ID] = c.inspect.RestartCount
+			if msg := w.restartLoopMessage(c); msg != "" {
+				report.AddAlert(msg)
+			}
+		}
+
+		if c.stats != nil {
+			sample := w.fillStats(c, result)
+			cpuSamples[c.summary.ID] = sample
+		}
+
+		containersResults = append(containersResults, result)
 	}
 
-	if strings.HasPrefix(status, "exited") {
-		return "stopped"
+	// removed containers are forgotten
+	w.restartCounts = restartCounts
+	w.cpuSamples = cpuSamples
+
+	report.Measurements = map[string]interface{}{
+		"containers": len(containers),
+		"unhealthy":  unhealthy,
+	}
+
+	return map[string]interface{}{"containers": containersResults}, &report, nil
+}
+
+func (w *Watcher) restartLoopMessage(c *containerInfo) string {
+	if c.summary.State == "restarting" {
+		return fmt.Sprintf("container '%s' is restarting, restarted %d times", c.name(), c.inspect.RestartCount)
 	}
 
-	// in other cases just use the first word
-	// As of docker 18.09 it can be one of: created, restarting, dead, removing
-	p := strings.Split(status, " ")
-	if len(p) > 0 {
-		return p[0]
+	previous, exists := w.restartCounts[c.summary.ID]
+	if !exists || w.restartLoopThreshold <= 0 {
+		return ""
 	}
 
-	// just in case we got empty status somehow
-	return "unknown"
+	restarts := c.inspect.RestartCount - previous
+	if restarts >= w.restartLoopThreshold {
+		return fmt.Sprintf("container '%s' is restart-looping, restarted %d times since the last check", c.name(), restarts)
+	}
+	return ""
 }
 
-// ListContainers returns the parsed output of 'docker ps' command
-func ListContainers() (map[string]interface{}, error) {
-	if !isDockerAvailable() {
-		return nil, ErrorDockerNotAvailable
+// fillStats adds the resource usage to the result and returns the CPU sample for the next run
+func (w *Watcher) fillStats(c *containerInfo, result map[string]interface{}) cpuSample {
+	stats := c.stats
+	sample := cpuSample{total: stats.CPUStats.CPUUsage.TotalUsage, system: stats.CPUStats.SystemUsage}
+
+	// the previous sample of the daemon is missing for one-shot stats, the own previous sample is used then
+	previous := cpuSample{total: stats.PreCPUStats.CPUUsage.TotalUsage, system: stats.PreCPUStats.SystemUsage}
+	if own, exists := w.cpuSamples[c.summary.ID]; exists && previous.system == 0 {
+		previous = own
 	}
+	result["cpu_usage_percent"] = cpuPercent(sample, previous, stats.CPUStats)
 
-	out, err := common.RunCommandWithTimeout(cmdExecTimeout, "/bin/sh", "-c", "sudo docker ps -a --format \"{{ json . }}\"")
-	if err != nil {
-		if ee, ok := err.(*exec.ExitError); ok {
-			err = errors.New(ee.Error() + ": " + string(ee.Stderr))
-		}
-		log.WithError(err).Error("can't list containers")
-		return nil, err
+	usage := memoryUsage(stats)
+	result["memory_usage_B"] = usage
+	result["memory_limit_B"] = stats.MemoryStats.Limit
+	if stats.MemoryStats.Limit > 0 {
+		result["memory_usage_percent"] = common.RoundToTwoDecimalPlaces(float64(usage) / float64(stats.MemoryStats.Limit) * 100)
 	}
 
-	lines := strings.Split(string(out), "\n")
-	var containersResults []map[string]interface{}
+	var rx, tx uint64
+	for _, n := range stats.Networks {
+		rx += n.RxBytes
+		tx += n.TxBytes
+	}
+	result["net_rx_B"] = rx
+	result["net_tx_B"] = tx
 
-	for _, line := range lines {
-		// skip empty lines
-		line = strings.TrimSpace(line)
-		if len(line) == 0 {
-			continue
+	var read, write uint64
+	for _, e := range stats.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(e.Op) {
+		case "read":
+			read += e.Value
+		case "write":
+			write += e.Value
 		}
+	}
+	result["block_read_B"] = read
+	result["block_write_B"] = write
+
+	return sample
+}
+
+// cpuPercent is calculated like 'docker stats' does, 100% is one fully used CPU
+func cpuPercent(current, previous cpuSample, stats cpuStats) interface{} {
+	if previous.system == 0 || current.system <= previous.system || current.total < previous.total {
+		// need one more sample to calculate
+		return nil
+	}
 
-		var container dockerPsOutput
-		err := json.Unmarshal([]byte(line), &container)
-		if err != nil {
-			log.WithError(err).Error("container list error: error decoding json output")
-			continue
+	onlineCPUs := float64(stats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(stats.CPUUsage.PercpuUsage))
+	}
+
+	cpuDelta := float64(current.total - previous.total)
+	systemDelta := float64(current.system - previous.system)
+	return common.RoundToTwoDecimalPlaces(cpuDelta / systemDelta * onlineCPUs * 100)
+}
+
+// memoryUsage excludes the page cache like 'docker stats' does
+func memoryUsage(stats *containerStats) uint64 {
+	usage := stats.MemoryStats.Usage
+	for _, key := range []string{"total_inactive_file", "inactive_file"} {
+		// cgroup v1 and v2
+		if v, exists := stats.MemoryStats.Stats[key]; exists && v < usage {
+			return usage - v
 		}
+	}
+	return usage
+}
+
+type containerInfo struct {
+	summary containerSummary
+	inspect *containerInspect
+	stats   *containerStats
+}
+
+func (c *containerInfo) name() string {
+	if len(c.summary.Names) > 0 {
+		return strings.TrimPrefix(c.summary.Names[0], "/")
+	}
+	return c.summary.ID
+}
+
+func getContainerInfo(ctx context.Context, client *apiClient, s containerSummary) *containerInfo {
+	info := &containerInfo{summary: s}
 
-		containersResults = append(containersResults, map[string]interface{}{
-			"id":     container.ID,
-			"image":  container.Image,
-			"name":   container.Names,
-			"state":  containerStatusToState(container.Status),
-			"status": container.Status,
-		})
+	var inspect containerInspect
+	if err := client.get(ctx, "/containers/"+s.ID+"/json", &inspect); err != nil {
+		log.WithError(err).Debugf("failed to inspect container %s", s.ID)
+	} else {
+		info.inspect = &inspect
 	}
 
-	return map[string]interface{}{"containers": containersResults}, nil
+	if s.State != "running" {
+		return info
+	}
+
+	var stats containerStats
+	if err := client.get(ctx, "/containers/"+s.ID+"/stats?stream=false&one-shot=true", &stats); err != nil {
+		log.WithError(err).Debugf("failed to get stats of container %s", s.ID)
+	} else {
+		info.stats = &stats
+	}
+
+	return info
 }
 
 // ContainerNameByID returns the name of a container identified by its id
 func ContainerNameByID(id string) (string, error) {
-	if !isDockerAvailable() {
+	available, err := isDockerAvailable()
+	if err != nil {
+		return "", err
+	}
+	if !available {
 		return "", ErrorDockerNotAvailable
 	}
 
-	out, err := common.RunCommandWithTimeout(cmdExecTimeout, "/bin/sh", "-c", fmt.Sprintf("sudo docker inspect --format \"{{ .Name }}\" %s", id))
-	if err != nil {
-		if ee, ok := err.(*exec.ExitError); ok {
-			err = errors.New(ee.Error() + ": " + string(ee.Stderr))
-		}
-
+	client, _ := getClient()
+	var inspect containerInspect
+	if err = client.get(context.Background(), "/containers/"+id+"/json", &inspect); err != nil {
 		return "", err
 	}
 
-	// remove \n and possible spaces around
-	name := strings.TrimSpace(string(out))
-
 	// remove leading slash from the name
-	name = strings.TrimPrefix(name, "/")
-
-	return name, nil
+	return strings.TrimPrefix(inspect.Name, "/"), nil
 }
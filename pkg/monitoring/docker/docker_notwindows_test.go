@@ -0,0 +1,215 @@
+// +build !windows
+
+package docker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubDaemon struct {
+	containers   []containerSummary
+	inspects     map[string]containerInspect
+	stats        map[string]containerStats
+	restartCount map[string]int
+	statsDelay   time.Duration
+}
+
+func (d *stubDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var res interface{}
+	switch {
+	case r.URL.Path == "/_ping":
+		_, _ = w.Write([]byte("OK"))
+		return
+	case r.URL.Path == "/containers/json":
+		res = d.containers
+	case strings.HasSuffix(r.URL.Path, "/json"):
+		id := strings.Split(r.URL.Path, "/")[2]
+		inspect, exists := d.inspects[id]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"No such container"}`))
+			return
+		}
+		inspect.RestartCount = d.restartCount[id]
+		res = inspect
+	case strings.HasSuffix(r.URL.Path, "/stats"):
+		select {
+		case <-time.After(d.statsDelay):
+		case <-r.Context().Done():
+			return
+		}
+		res = d.stats[strings.Split(r.URL.Path, "/")[2]]
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+// serveStubDaemon makes the package use the stub daemon listening on a unix socket
+func serveStubDaemon(t *testing.T, d *stubDaemon) func() {
+	dir, err := ioutil.TempDir("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socketPath := filepath.Join(dir, "docker.sock")
+
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: d}
+	go func() { _ = srv.Serve(l) }()
+
+	defaultClient, defaultClientErr = newAPIClient("unix://" + socketPath)
+	dockerAvailabilityLastRequestedAt = nil
+
+	return func() {
+		srv.Close()
+		os.RemoveAll(dir)
+		defaultClient, defaultClientErr = nil, nil
+		dockerAvailabilityLastRequestedAt = nil
+	}
+}
+
+func newStats(totalUsage, systemUsage, memUsage uint64) containerStats {
+	var s containerStats
+	s.CPUStats.CPUUsage.TotalUsage = totalUsage
+	s.CPUStats.SystemUsage = systemUsage
+	s.CPUStats.OnlineCPUs = 2
+	s.MemoryStats.Usage = memUsage
+	s.MemoryStats.Limit = 1000
+	s.MemoryStats.Stats = map[string]uint64{"inactive_file": 100}
+	s.Networks = map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	}{
+		"eth0": {RxBytes: 10, TxBytes: 20},
+		"eth1": {RxBytes: 1, TxBytes: 2},
+	}
+	s.BlkioStats.IOServiceBytesRecursive = []struct {
+		Op    string `json:"op"`
+		Value uint64 `json:"value"`
+	}{
+		{Op: "read", Value: 512},
+		{Op: "Write", Value: 1024},
+	}
+	return s
+}
+
+func TestListContainers(t *testing.T) {
+	web := containerInspect{Name: "/web"}
+	db := containerInspect{Name: "/db"}
+	db.State.Health = &struct {
+		Status        string
+		FailingStreak int
+	}{Status: "unhealthy", FailingStreak: 3}
+	worker := containerInspect{Name: "/worker"}
+	worker.State.OOMKilled = true
+
+	d := &stubDaemon{
+		containers: []containerSummary{
+			{ID: "aaa", Names: []string{"/web"}, Image: "nginx", State: "running", Status: "Up 2 hours"},
+			{ID: "bbb", Names: []string{"/db"}, Image: "postgres", State: "running", Status: "Up 2 hours (unhealthy)"},
+			{ID: "ccc", Names: []string{"/worker"}, Image: "worker", State: "exited", Status: "Exited (137) 1 minute ago"},
+		},
+		inspects:     map[string]containerInspect{"aaa": web, "bbb": db, "ccc": worker},
+		stats:        map[string]containerStats{"aaa": newStats(1000, 10000, 600), "bbb": newStats(0, 10000, 0)},
+		restartCount: map[string]int{"ccc": 5},
+	}
+	defer serveStubDaemon(t, d)()
+
+	w := NewWatcher(3)
+	res, report, err := w.ListContainers()
+	assert.NoError(t, err)
+	containers := res["containers"].([]map[string]interface{})
+	if len(containers) != 3 {
+		t.Fatalf("expected 3 containers, got %d", len(containers))
+	}
+
+	assert.Equal(t, "web", containers[0]["name"])
+	assert.Equal(t, "running", containers[0]["state"])
+	assert.Nil(t, containers[0]["cpu_usage_percent"], "the first sample can't be used to calculate the CPU usage")
+	assert.Equal(t, uint64(500), containers[0]["memory_usage_B"])
+	assert.Equal(t, 50.0, containers[0]["memory_usage_percent"])
+	assert.Equal(t, uint64(11), containers[0]["net_rx_B"])
+	assert.Equal(t, uint64(22), containers[0]["net_tx_B"])
+	assert.Equal(t, uint64(512), containers[0]["block_read_B"])
+	assert.Equal(t, uint64(1024), containers[0]["block_write_B"])
+
+	assert.Equal(t, "unhealthy", containers[1]["health"])
+	assert.Equal(t, "stopped", containers[2]["state"])
+	assert.Equal(t, true, containers[2]["oom_killed"])
+	assert.Equal(t, 5, containers[2]["restart_count"])
+	assert.NotContains(t, containers[2], "cpu_usage_percent")
+
+	var alerts []string
+	for _, a := range report.Alerts {
+		alerts = append(alerts, string(a))
+	}
+	assert.Equal(t, []string{"container 'db' is unhealthy, 3 health checks failed in a row"}, alerts)
+
+	// the next run uses the previous samples
+	d.stats["aaa"] = newStats(3000, 20000, 600)
+	d.restartCount["ccc"] = 8
+	res, report, err = w.ListContainers()
+	assert.NoError(t, err)
+	containers = res["containers"].([]map[string]interface{})
+	assert.Equal(t, 40.0, containers[0]["cpu_usage_percent"])
+	assert.Len(t, report.Alerts, 2)
+	assert.Equal(t, "container 'worker' is restart-looping, restarted 3 times since the last check", string(report.Alerts[1]))
+
+	name, err := ContainerNameByID("aaa")
+	assert.NoError(t, err)
+	assert.Equal(t, "web", name)
+
+	_, err = ContainerNameByID("missing")
+	assert.Error(t, err)
+}
+
+func TestListContainersTimeout(t *testing.T) {
+	d := &stubDaemon{
+		containers: []containerSummary{
+			{ID: "aaa", Names: []string{"/web"}, Image: "nginx", State: "running", Status: "Up 2 hours"},
+		},
+		inspects:   map[string]containerInspect{"aaa": {Name: "/web"}},
+		stats:      map[string]containerStats{"aaa": newStats(1000, 10000, 600)},
+		statsDelay: time.Minute,
+	}
+	defer serveStubDaemon(t, d)()
+
+	defer func(timeout time.Duration) { containerDetailsTimeout = timeout }(containerDetailsTimeout)
+	containerDetailsTimeout = 100 * time.Millisecond
+
+	started := time.Now()
+	res, _, err := NewWatcher(3).ListContainers()
+	assert.NoError(t, err)
+	assert.True(t, time.Since(started) < 5*time.Second)
+
+	containers := res["containers"].([]map[string]interface{})
+	assert.Len(t, containers, 1)
+	assert.Equal(t, "web", containers[0]["name"])
+	assert.NotContains(t, containers[0], "cpu_usage_percent")
+}
+
+func TestNotAvailable(t *testing.T) {
+	defaultClient, defaultClientErr = newAPIClient("unix:///nonexistent/docker.sock")
+	dockerAvailabilityLastRequestedAt = nil
+	defer func() {
+		defaultClient, defaultClientErr = nil, nil
+		dockerAvailabilityLastRequestedAt = nil
+	}()
+
+	_, _, err := NewWatcher(3).ListContainers()
+	assert.Equal(t, ErrorDockerNotAvailable, err)
+}
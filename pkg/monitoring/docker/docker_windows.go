@@ -2,8 +2,12 @@
 
 package docker
 
-func ListContainers() (map[string]interface{}, error) {
-	return nil, ErrorNotImplementedForOS
+import (
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+)
+
+func (w *Watcher) ListContainers() (map[string]interface{}, *monitoring.ModuleReport, error) {
+	return nil, nil, ErrorNotImplementedForOS
 }
 
 func ContainerNameByID(_ string) (string, error) {
@@ -0,0 +1,273 @@
+package httpcheck
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+)
+
+const (
+	defaultTimeout     = 10 * time.Second
+	defaultMaxBodySize = 1024 * 1024
+)
+
+var log = logrus.WithField("package", "httpcheck")
+
+// Check is an HTTP or HTTPS endpoint probed from the host
+type Check struct {
+	Name               string            `toml:"name" comment:"Name of the check used in the module report"`
+	URL                string            `toml:"url" comment:"URL to request, http or https"`
+	Method             string            `toml:"method" comment:"HTTP method. Default: GET"`
+	Headers            map[string]string `toml:"headers" comment:"Additional request headers"`
+	Timeout            float64           `toml:"timeout" comment:"Time limit in seconds for the request. Default: 10"`
+	Interval           float64           `toml:"interval" comment:"Run the check every N seconds. Default: the interval of the modules"`
+	ExpectedStatus     []int             `toml:"expected_status" comment:"Alert if the status code is not in the list. Default: alert on status codes >= 400"`
+	BodyRegex          string            `toml:"body_regex" comment:"Alert if the regular expression doesn't match the response body"`
+	MaxBodySize        int64             `toml:"max_body_size" comment:"Number of bytes of the body searched by body_regex. Default: 1048576"`
+	MaxLatency         float64           `toml:"max_latency" comment:"Warn if the request takes longer than N seconds"`
+	InsecureSkipVerify bool              `toml:"insecure_skip_verify" comment:"Don't verify the certificate of the server"`
+	UseHubProxy        bool              `toml:"use_hub_proxy" comment:"Send the request over the proxy used for the Hub. Default: the proxy from the environment"`
+	UseHubRootCerts    bool              `toml:"use_hub_root_certs" comment:"Verify the server certificate with the root certificates used for the Hub"`
+}
+
+func (c *Check) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("name is empty")
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("failed to parse url: %s", err.Error())
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url should start with http:// or https://")
+	}
+
+	if c.BodyRegex != "" {
+		if _, err := regexp.Compile(c.BodyRegex); err != nil {
+			return fmt.Errorf("invalid body_regex: %s", err.Error())
+		}
+	}
+
+	for _, status := range c.ExpectedStatus {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("invalid expected_status %d", status)
+		}
+	}
+
+	if c.Timeout < 0 || c.Interval < 0 || c.MaxLatency < 0 || c.MaxBodySize < 0 {
+		return fmt.Errorf("timeout, interval, max_latency and max_body_size should be equal or greater than 0")
+	}
+
+	return nil
+}
+
+func (c *Check) GetMethod() string {
+	if c.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(c.Method)
+}
+
+func (c *Check) GetTimeout() time.Duration {
+	if c.Timeout == 0 {
+		return defaultTimeout
+	}
+	return common.SecToDuration(c.Timeout)
+}
+
+func (c *Check) getMaxBodySize() int64 {
+	if c.MaxBodySize == 0 {
+		return defaultMaxBodySize
+	}
+	return c.MaxBodySize
+}
+
+// HubTransport carries the settings of the Hub client which checks can reuse
+type HubTransport struct {
+	Proxy     func(*http.Request) (*url.URL, error)
+	RootCAs   *x509.CertPool
+	UserAgent string
+}
+
+type HTTPCheck struct {
+	check     *Check
+	client    *http.Client
+	bodyRegex *regexp.Regexp
+	userAgent string
+}
+
+func CreateModule(check *Check, hub HubTransport) monitoring.Module {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// every run measures the complete connection setup
+	transport.DisableKeepAlives = true
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: check.InsecureSkipVerify}
+	if check.UseHubProxy {
+		transport.Proxy = hub.Proxy
+	}
+	if check.UseHubRootCerts {
+		transport.TLSClientConfig.RootCAs = hub.RootCAs
+	}
+
+	m := &HTTPCheck{
+		check: check,
+		client: &http.Client{
+			Timeout:   check.GetTimeout(),
+			Transport: transport,
+		},
+		userAgent: hub.UserAgent,
+	}
+
+	if check.BodyRegex != "" {
+		var err error
+		m.bodyRegex, err = regexp.Compile(check.BodyRegex)
+		if err != nil {
+			log.WithError(err).Errorf("check '%s': invalid body_regex", check.Name)
+		}
+	}
+
+	return m
+}
+
+func (h *HTTPCheck) GetDescription() string {
+	return fmt.Sprintf("http check '%s'", h.check.Name)
+}
+
+func (h *HTTPCheck) IsEnabled() bool {
+	return h.check.URL != ""
+}
+
+// timings of the request phases
+type timings struct {
+	start        time.Time
+	dnsStart     time.Time
+	dns          time.Duration
+	connectStart time.Time
+	connect      time.Duration
+	tlsStart     time.Time
+	tls          time.Duration
+	ttfb         time.Duration
+}
+
+func (t *timings) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.dnsStart = time.Now() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.dns = time.Since(t.dnsStart) },
+		ConnectStart: func(string, string) {
+			t.connectStart = time.Now()
+		},
+		ConnectDone: func(string, string, error) {
+			t.connect = time.Since(t.connectStart)
+		},
+		TLSHandshakeStart: func() { t.tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.tls = time.Since(t.tlsStart)
+		},
+		GotFirstResponseByte: func() { t.ttfb = time.Since(t.start) },
+	}
+}
+
+func (h *HTTPCheck) Run() ([]*monitoring.ModuleReport, error) {
+	method := h.check.GetMethod()
+	report := monitoring.NewReport(
+		fmt.Sprintf("http check %s", h.check.Name),
+		time.Now(),
+		fmt.Sprintf("%s %s", method, h.check.URL),
+	)
+
+	req, err := http.NewRequest(method, h.check.URL, nil)
+	if err != nil {
+		report.AddAlert(fmt.Sprintf("failed to create the request: %s", err.Error()))
+		return []*monitoring.ModuleReport{&report}, nil
+	}
+	if h.userAgent != "" {
+		req.Header.Set("User-Agent", h.userAgent)
+	}
+	for k, v := range h.check.Headers {
+		req.Header.Set(k, v)
+	}
+
+	t := &timings{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), t.trace()))
+
+	t.start = time.Now()
+	resp, err := h.client.Do(req)
+	if err != nil {
+		report.AddAlert(fmt.Sprintf("request failed: %s", err.Error()))
+		report.Measurements = map[string]interface{}{"success": 0}
+		return []*monitoring.ModuleReport{&report}, nil
+	}
+	defer resp.Body.Close()
+
+	body := bytes.Buffer{}
+	bodySize, err := io.Copy(&body, io.LimitReader(resp.Body, h.check.getMaxBodySize()))
+	if err == nil {
+		var rest int64
+		rest, err = io.Copy(ioutil.Discard, resp.Body)
+		bodySize += rest
+	}
+	total := time.Since(t.start)
+	bodyErr := err
+
+	report.Measurements = map[string]interface{}{
+		"status_code": resp.StatusCode,
+		"body_size_B": bodySize,
+		"dns_ms":      durationMs(t.dns),
+		"connect_ms":  durationMs(t.connect),
+		"tls_ms":      durationMs(t.tls),
+		"ttfb_ms":     durationMs(t.ttfb),
+		"total_ms":    durationMs(total),
+	}
+
+	success := 1
+	if !h.statusExpected(resp.StatusCode) {
+		success = 0
+		report.AddAlert(fmt.Sprintf("unexpected status code %d", resp.StatusCode))
+	}
+
+	if bodyErr != nil {
+		success = 0
+		report.AddAlert(fmt.Sprintf("failed to read the response body: %s", bodyErr.Error()))
+	} else if h.bodyRegex != nil && !h.bodyRegex.Match(body.Bytes()) {
+		success = 0
+		report.AddAlert(fmt.Sprintf("response body doesn't match '%s'", h.check.BodyRegex))
+	}
+
+	if h.check.MaxLatency > 0 && total > common.SecToDuration(h.check.MaxLatency) {
+		report.AddWarning(fmt.Sprintf("request took %v, more than %v", total.Round(time.Millisecond), common.SecToDuration(h.check.MaxLatency)))
+	}
+	report.Measurements["success"] = success
+
+	return []*monitoring.ModuleReport{&report}, nil
+}
+
+func (h *HTTPCheck) statusExpected(status int) bool {
+	if len(h.check.ExpectedStatus) == 0 {
+		return status < 400
+	}
+
+	for _, s := range h.check.ExpectedStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func durationMs(d time.Duration) float64 {
+	return common.RoundToTwoDecimalPlaces(float64(d) / float64(time.Millisecond))
+}
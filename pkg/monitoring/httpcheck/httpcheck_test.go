@@ -0,0 +1,109 @@
+package httpcheck
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+)
+
+func TestCheckValidate(t *testing.T) {
+	assert.NoError(t, (&Check{Name: "api", URL: "https://127.0.0.1/health"}).Validate())
+	assert.Error(t, (&Check{URL: "https://127.0.0.1/health"}).Validate())
+	assert.Error(t, (&Check{Name: "api", URL: "ftp://127.0.0.1/"}).Validate())
+	assert.Error(t, (&Check{Name: "api", URL: "http://127.0.0.1/", BodyRegex: "("}).Validate())
+	assert.Error(t, (&Check{Name: "api", URL: "http://127.0.0.1/", ExpectedStatus: []int{1000}}).Validate())
+}
+
+func TestRun(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		_, _ = w.Write([]byte(`{"status":"healthy"}`))
+	})
+	handler.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	handler.HandleFunc("/truncated", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		_, _ = w.Write([]byte(`{"status":`))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	run := func(check *Check) *monitoring.ModuleReport {
+		reports, err := CreateModule(check, HubTransport{}).Run()
+		assert.NoError(t, err)
+		if assert.Len(t, reports, 1) {
+			return reports[0]
+		}
+		return &monitoring.ModuleReport{}
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		r := run(&Check{
+			Name:      "ok",
+			URL:       server.URL + "/ok",
+			Headers:   map[string]string{"X-Token": "secret"},
+			BodyRegex: `"status":\s*"healthy"`,
+		})
+		assert.Empty(t, r.Alerts)
+		assert.Empty(t, r.Warnings)
+		assert.Equal(t, 200, r.Measurements["status_code"])
+		assert.Equal(t, int64(20), r.Measurements["body_size_B"])
+		assert.Equal(t, 1, r.Measurements["success"])
+		assert.Contains(t, r.Measurements, "ttfb_ms")
+		assert.Equal(t, "GET "+server.URL+"/ok", r.ExecutedCommand)
+	})
+
+	t.Run("assertions", func(t *testing.T) {
+		r := run(&Check{
+			Name:       "slow",
+			URL:        server.URL + "/slow",
+			BodyRegex:  "healthy",
+			MaxLatency: 0.01,
+		})
+		assert.Equal(t, []monitoring.Alert{
+			"unexpected status code 503",
+			"response body doesn't match 'healthy'",
+		}, r.Alerts)
+		assert.Len(t, r.Warnings, 1)
+		assert.Equal(t, 0, r.Measurements["success"])
+	})
+
+	t.Run("expected status", func(t *testing.T) {
+		r := run(&Check{Name: "slow", URL: server.URL + "/slow", ExpectedStatus: []int{503}})
+		assert.Empty(t, r.Alerts)
+	})
+
+	t.Run("truncated body", func(t *testing.T) {
+		r := run(&Check{Name: "truncated", URL: server.URL + "/truncated"})
+		if assert.Len(t, r.Alerts, 1) {
+			assert.Contains(t, string(r.Alerts[0]), "failed to read the response body")
+		}
+		assert.Equal(t, 0, r.Measurements["success"])
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		r := run(&Check{Name: "down", URL: "http://127.0.0.1:1/", Timeout: 1})
+		assert.Len(t, r.Alerts, 1)
+		assert.Equal(t, 0, r.Measurements["success"])
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		tlsServer := httptest.NewTLSServer(handler)
+		defer tlsServer.Close()
+
+		r := run(&Check{Name: "tls", URL: tlsServer.URL + "/ok", Headers: map[string]string{"X-Token": "secret"}})
+		assert.Len(t, r.Alerts, 1, "the certificate is not trusted")
+
+		r = run(&Check{Name: "tls", URL: tlsServer.URL + "/ok", Headers: map[string]string{"X-Token": "secret"}, InsecureSkipVerify: true})
+		assert.Empty(t, r.Alerts)
+		assert.True(t, r.Measurements["tls_ms"].(float64) > 0)
+	})
+}
@@ -0,0 +1,29 @@
+// Package moduletest contains the helpers shared by the tests of the monitoring modules
+package moduletest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+)
+
+// Run runs the module and fails the test unless it succeeds with exactly one report.
+// It returns the measurements, the alerts and the warnings of the report
+func Run(t *testing.T, m monitoring.Module) (map[string]interface{}, []string, []string) {
+	t.Helper()
+
+	reports, err := m.Run()
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+
+	var alerts, warnings []string
+	for _, a := range reports[0].Alerts {
+		alerts = append(alerts, string(a))
+	}
+	for _, w := range reports[0].Warnings {
+		warnings = append(warnings, string(w))
+	}
+	return reports[0].Measurements, alerts, warnings
+}
@@ -1,40 +1,85 @@
 package mysql
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/sirupsen/logrus"
 
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
 	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
 )
 
 const (
-	defaultPort = "3306"
+	defaultPort         = "3306"
+	defaultQueryTimeout = 10 * time.Second
+
+	// the user isn't allowed to run SHOW REPLICA STATUS, e.g. without the REPLICATION CLIENT privilege
+	errAccessDenied         = 1045
+	errSpecificAccessDenied = 1227
+
+	// tlsConfigName is the name of the TLS config with the custom CA registered in the driver
+	tlsConfigName = "cagent"
 )
 
 var log = logrus.WithField("package", "mysql")
 
 type Config struct {
-	Enabled        bool    `toml:"enabled" comment:"Set 'false' to disable checking available updates"`
-	Connect        string  `toml:"connect" comment:"Use 127.0.0.1 or the path to the mysql.socket, connecting to remote databases is not supported"`
-	User           string  `toml:"user" comment:"Create a user with minimal rights\nmysql > GRANT USAGE ON *.* TO cagent@localhost IDENTIFIED BY '<password>';"`
-	Password       string  `toml:"password" comment:"Maximum time the package manager is allowed to spend fetching available updates"`
-	ConnectTimeout float64 `toml:"connect_timeout" comment:"Maximum time to wait for mysql server to connect using provided credentials"`
+	Enabled               bool    `toml:"enabled" comment:"Set 'true' to enable the MySQL/MariaDB monitoring"`
+	Connect               string  `toml:"connect" comment:"host:port of the server or the path to the mysql.socket"`
+	User                  string  `toml:"user" comment:"Create a user with minimal rights\nmysql > GRANT USAGE ON *.* TO cagent@localhost IDENTIFIED BY '<password>';\nmysql > GRANT REPLICATION CLIENT ON *.* TO cagent@localhost; # to monitor the replication"`
+	Password              string  `toml:"password" comment:"Password of the user"`
+	ConnectTimeout        float64 `toml:"connect_timeout" comment:"Maximum time to wait for mysql server to connect using provided credentials"`
+	QueryTimeout          float64 `toml:"query_timeout" comment:"Time limit in seconds to read and write a query and its result. Default: 10"`
+	TLS                   string  `toml:"tls" comment:"Encrypt the connection. Possible values: 'false', 'true' (verify the certificate), 'skip-verify', 'preferred' (use TLS if supported by the server). Default: false"`
+	TLSCA                 string  `toml:"tls_ca" comment:"PEM file with the CA certificates to verify the server, e.g. the RDS CA bundle. Requires tls = 'true'"`
+	MaxConnectionsPercent float64 `toml:"max_connections_percent" comment:"Alert if the connected threads exceed N percent of max_connections. Set to 0 to disable"`
+	MaxReplicationLag     float64 `toml:"max_replication_lag" comment:"Alert if the replica is more than N seconds behind the source. Set to 0 to disable"`
 }
 
 func (cfg *Config) Validate() error {
-	if cfg.ConnectTimeout < 0 {
-		return fmt.Errorf("connect_timeout should be equal or greater than 0.0")
+	if cfg.ConnectTimeout < 0 || cfg.QueryTimeout < 0 {
+		return fmt.Errorf("connect_timeout and query_timeout should be equal or greater than 0.0")
+	}
+
+	switch cfg.TLS {
+	case "", "false", "true", "skip-verify", "preferred":
+	default:
+		return fmt.Errorf("unknown tls value '%s'. Possible values: 'false', 'true', 'skip-verify', 'preferred'", cfg.TLS)
+	}
+
+	if cfg.TLSCA != "" && cfg.TLS != "true" {
+		return fmt.Errorf("tls_ca requires tls = 'true'")
+	}
+
+	if cfg.MaxConnectionsPercent < 0 || cfg.MaxConnectionsPercent > 100 {
+		return fmt.Errorf("max_connections_percent should be between 0 and 100")
+	}
+
+	if cfg.MaxReplicationLag < 0 {
+		return fmt.Errorf("max_replication_lag should be equal or greater than 0.0")
 	}
+
 	return nil
 }
 
+func (cfg *Config) GetQueryTimeout() time.Duration {
+	if cfg.QueryTimeout == 0 {
+		return defaultQueryTimeout
+	}
+	return common.SecToDuration(cfg.QueryTimeout)
+}
+
 func CreateModule(config *Config) monitoring.Module {
 	return &Mysql{
 		config: config,
@@ -43,6 +88,9 @@ func CreateModule(config *Config) monitoring.Module {
 
 type Mysql struct {
 	config *Config
+
+	// mu guards the client, it's closed from another goroutine when the config is reloaded
+	mu     sync.Mutex
 	client *sql.DB
 
 	lastStatus     *Status
@@ -50,70 +98,93 @@ type Mysql struct {
 }
 
 func (r *Mysql) getClient() (*sql.DB, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if r.client != nil {
 		return r.client, nil
 	}
 
+	dsn, err := r.dataSourceName()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect %s: %s", r.config.Connect, err.Error())
+	}
+
+	r.client = db
+	return db, nil
+}
+
+// Close releases the connection pool. It's not opened again, so a run which is still in progress fails
+func (r *Mysql) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.client == nil {
+		return nil
+	}
+	return r.client.Close()
+}
+
+func (r *Mysql) dataSourceName() (string, error) {
 	if len(r.config.Connect) == 0 {
-		return nil, fmt.Errorf("connect address is empty")
+		return "", fmt.Errorf("connect address is empty")
 	}
 
 	if len(r.config.User) == 0 {
-		return nil, fmt.Errorf("user is empty")
+		return "", fmt.Errorf("user is empty")
 	}
 
-	var host, port string
-	portDelimiter := strings.Index(r.config.Connect, ":")
-	if portDelimiter > 0 {
-		if strings.Count(r.config.Connect, ":") > 1 {
-			// probably ipv6
-			return nil, fmt.Errorf("connect: IPv6 address not supported")
-		}
-		host = r.config.Connect[0:portDelimiter]
-		if portDelimiter+1 < len(r.config.Connect) {
-			port = r.config.Connect[portDelimiter+1:]
-		} else {
-			port = defaultPort
+	dsn := mysql.NewConfig()
+	dsn.User = r.config.User
+	dsn.Passwd = r.config.Password
+	dsn.DBName = "information_schema"
+	dsn.Timeout = time.Duration(r.config.ConnectTimeout * float64(time.Second))
+	// a hanging server must not block the module
+	dsn.ReadTimeout = r.config.GetQueryTimeout()
+	dsn.WriteTimeout = r.config.GetQueryTimeout()
+
+	if filepath.IsAbs(r.config.Connect) {
+		if _, err := os.Stat(r.config.Connect); os.IsNotExist(err) {
+			return "", fmt.Errorf("connect: provided unix socket path not found")
+		} else if err != nil {
+			return "", fmt.Errorf("connect: provided unix socket not valid, %s", err.Error())
 		}
+
+		dsn.Net = "unix"
+		dsn.Addr = r.config.Connect
 	} else {
-		host = r.config.Connect
-		port = defaultPort
+		dsn.Net = "tcp"
+		dsn.Addr = r.config.Connect
+		if _, _, err := net.SplitHostPort(r.config.Connect); err != nil {
+			dsn.Addr = net.JoinHostPort(strings.Trim(r.config.Connect, "[]"), defaultPort)
+		}
 	}
 
-	if host == "127.0.0.1" || host == "localhost" {
-		db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%s)/information_schema?timeout=%.2fs", r.config.User, r.config.Password, host, port, r.config.ConnectTimeout))
+	dsn.TLSConfig = r.config.TLS
+	if r.config.TLSCA != "" {
+		pemCerts, err := ioutil.ReadFile(r.config.TLSCA)
 		if err != nil {
-			return nil, fmt.Errorf("failed to connect %s: %s", r.config.Connect, err.Error())
+			return "", fmt.Errorf("failed to read tls_ca: %s", err.Error())
 		}
 
-		r.client = db
-		return db, nil
-	}
-
-	ip := net.ParseIP(host)
-	if ip != nil {
-		return nil, fmt.Errorf("connect: only local mysql server is supported. Please use 127.0.0.1, localhost or unix socket path")
-
-	}
-	// this is probably unix socket filepath
-	absPath, err := filepath.Abs(r.config.Connect)
-	if err != nil {
-		return nil, fmt.Errorf("connect: not a unix socket path: %s", err.Error())
-	}
-
-	if _, err := os.Stat(absPath); err == os.ErrNotExist {
-		return nil, fmt.Errorf("connect: provided unix socket path not found")
-	} else if err != nil {
-		return nil, fmt.Errorf("connect: provided unix socket not valid, %s", err.Error())
-	}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pemCerts) {
+			return "", fmt.Errorf("tls_ca: no certificates found in %s", r.config.TLSCA)
+		}
 
-	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@unix(%s)/information_schema?timeout=%.2fs", r.config.User, r.config.Password, absPath, r.config.ConnectTimeout))
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect %s: %s", r.config.Connect, err.Error())
+		err = mysql.RegisterTLSConfig(tlsConfigName, &tls.Config{RootCAs: roots})
+		if err != nil {
+			return "", err
+		}
+		dsn.TLSConfig = tlsConfigName
 	}
 
-	r.client = db
-	return db, nil
+	return dsn.FormatDSN(), nil
 }
 
 func (r *Mysql) GetDescription() string {
@@ -144,17 +215,86 @@ func (r *Mysql) Run() ([]*monitoring.ModuleReport, error) {
 		return []*monitoring.ModuleReport{&report}, nil
 	}
 
+	report.Measurements = make(map[string]interface{})
 	if r.lastStatus == nil {
-		r.lastStatus = status
-		r.lastStatusTime = statusTime
-
 		// need one more iteration to calculate
 		// but we need to provide nil measurements for consistency
-		report.Measurements = emptyResults()
-		return []*monitoring.ModuleReport{&report}, nil
+		fillEmptyResultsPerSecond(report.Measurements)
+	} else {
+		fillResultsPerSecond(status, r.lastStatus, statusTime.Sub(r.lastStatusTime), report.Measurements)
 	}
+	r.lastStatus = status
+	r.lastStatusTime = statusTime
+
+	r.checkConnections(client, status, &report)
+	r.checkReplication(client, &report)
 
-	report.Measurements = make(map[string]interface{})
-	fillResultsPerSecond(status, r.lastStatus, statusTime.Sub(r.lastStatusTime), report.Measurements)
 	return []*monitoring.ModuleReport{&report}, nil
 }
+
+func (r *Mysql) checkConnections(client *sql.DB, status *Status, report *monitoring.ModuleReport) {
+	report.Measurements["Threads connected"] = status.ThreadsConnected
+	report.Measurements["Threads running"] = status.ThreadsRunning
+	report.Measurements["Innodb row lock current waits"] = status.InnoDBRowLockCurrentWaits
+
+	var maxConnections int64
+	err := client.QueryRow("SELECT @@max_connections").Scan(&maxConnections)
+	if err != nil {
+		report.AddWarning(fmt.Sprintf("failed to get max_connections: %s", err.Error()))
+		return
+	}
+
+	report.Measurements["Max connections"] = maxConnections
+	if maxConnections == 0 {
+		return
+	}
+
+	percent := float64(status.ThreadsConnected) / float64(maxConnections) * 100
+	report.Measurements["Connections percent"] = common.RoundToTwoDecimalPlaces(percent)
+	if r.config.MaxConnectionsPercent > 0 && percent > r.config.MaxConnectionsPercent {
+		report.AddAlert(fmt.Sprintf("%d of %d connections in use (%.2f%%)", status.ThreadsConnected, maxConnections, percent))
+	}
+}
+
+func (r *Mysql) checkReplication(client *sql.DB, report *monitoring.ModuleReport) {
+	channels, err := getReplicationStatus(client)
+	if isAccessDenied(err) {
+		log.WithError(err).Debug("replication is not monitored, the REPLICATION CLIENT privilege is missing")
+		report.Measurements["Is replica"] = nil
+		report.Measurements["Replication"] = nil
+		return
+	}
+	if err != nil {
+		report.AddWarning(fmt.Sprintf("failed to get replication status: %s", err.Error()))
+		return
+	}
+
+	report.Measurements["Is replica"] = len(channels) > 0
+	report.Measurements["Replication"] = channels
+	for _, c := range channels {
+		name := "replication"
+		if c.Channel != "" {
+			name = fmt.Sprintf("replication channel '%s'", c.Channel)
+		}
+
+		if !c.IORunning || !c.SQLRunning {
+			msg := fmt.Sprintf("%s from %s is broken: IO thread running: %s, SQL thread running: %s", name, c.SourceHost, c.IOState, c.SQLState)
+			if c.LastError != "" {
+				msg += ". Last error: " + c.LastError
+			}
+			report.AddAlert(msg)
+			continue
+		}
+
+		if c.SecondsBehind != nil && r.config.MaxReplicationLag > 0 && float64(*c.SecondsBehind) > r.config.MaxReplicationLag {
+			report.AddAlert(fmt.Sprintf("%s is %d seconds behind the source %s", name, *c.SecondsBehind, c.SourceHost))
+		}
+	}
+}
+
+func isAccessDenied(err error) bool {
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok {
+		return mysqlErr.Number == errAccessDenied || mysqlErr.Number == errSpecificAccessDenied
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package mysql
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataSourceName(t *testing.T) {
+	socket, err := ioutil.TempFile("", "mysql.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket.Close()
+	defer os.Remove(socket.Name())
+
+	tests := []struct {
+		name    string
+		config  Config
+		dsn     string
+		invalid bool
+	}{
+		{
+			name:   "local",
+			config: Config{Connect: "127.0.0.1", User: "cagent", Password: "secret", ConnectTimeout: 1, QueryTimeout: 5},
+			dsn:    "cagent:secret@tcp(127.0.0.1:3306)/information_schema?readTimeout=5s&timeout=1s&writeTimeout=5s",
+		},
+		{
+			name:   "remote with tls",
+			config: Config{Connect: "db.example.com:3307", User: "cagent", TLS: "true"},
+			dsn:    "cagent@tcp(db.example.com:3307)/information_schema?readTimeout=10s&tls=true&writeTimeout=10s",
+		},
+		{
+			name:   "ipv6",
+			config: Config{Connect: "[::1]", User: "cagent", TLS: "skip-verify"},
+			dsn:    "cagent@tcp([::1]:3306)/information_schema?readTimeout=10s&tls=skip-verify&writeTimeout=10s",
+		},
+		{
+			name:   "unix socket",
+			config: Config{Connect: socket.Name(), User: "cagent"},
+			dsn:    "cagent@unix(" + socket.Name() + ")/information_schema?readTimeout=10s&writeTimeout=10s",
+		},
+		{
+			name:    "missing socket",
+			config:  Config{Connect: socket.Name() + ".missing", User: "cagent"},
+			invalid: true,
+		},
+		{
+			name:    "missing tls_ca",
+			config:  Config{Connect: "db.example.com", User: "cagent", TLS: "true", TLSCA: socket.Name() + ".missing"},
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn, err := (&Mysql{config: &tt.config}).dataSourceName()
+			if tt.invalid {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.dsn, dsn)
+		})
+	}
+}
+
+func TestClose(t *testing.T) {
+	m := CreateModule(&Config{Connect: "127.0.0.1", User: "cagent", ConnectTimeout: 1, QueryTimeout: 5}).(*Mysql)
+	assert.NoError(t, m.Close(), "nothing to close before the first run")
+
+	client, err := m.getClient()
+	assert.NoError(t, err)
+	assert.NoError(t, m.Close())
+	assert.Error(t, client.Ping(), "the connection pool is released")
+
+	// a run which is still in progress doesn't open a new pool
+	again, err := m.getClient()
+	assert.NoError(t, err)
+	assert.Equal(t, client, again)
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, (&Config{TLS: "preferred"}).Validate())
+	assert.NoError(t, (&Config{TLS: "true", TLSCA: "/etc/ssl/rds.pem"}).Validate())
+	assert.Error(t, (&Config{TLS: "yes"}).Validate())
+	assert.Error(t, (&Config{TLSCA: "/etc/ssl/rds.pem"}).Validate())
+	assert.Error(t, (&Config{MaxConnectionsPercent: 101}).Validate())
+}
+
+func TestIsAccessDenied(t *testing.T) {
+	assert.True(t, isAccessDenied(&mysql.MySQLError{Number: 1227, Message: "Access denied; you need (at least one of) the SUPER, REPLICATION CLIENT privilege(s) for this operation"}))
+	assert.True(t, isAccessDenied(&mysql.MySQLError{Number: 1045, Message: "Access denied for user 'cagent'@'localhost'"}))
+	assert.False(t, isAccessDenied(&mysql.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"}))
+	assert.False(t, isAccessDenied(nil))
+}
+
+func TestParseReplicationChannel(t *testing.T) {
+	str := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+
+	c := parseReplicationChannel(map[string]sql.NullString{
+		"Master_Host":           str("10.0.0.1"),
+		"Slave_IO_Running":      str("Yes"),
+		"Slave_SQL_Running":     str("Yes"),
+		"Seconds_Behind_Master": str("12"),
+		"Last_IO_Error":         str(""),
+		"Last_SQL_Error":        str(""),
+	})
+	assert.Equal(t, "10.0.0.1", c.SourceHost)
+	assert.True(t, c.IORunning)
+	assert.True(t, c.SQLRunning)
+	if assert.NotNil(t, c.SecondsBehind) {
+		assert.Equal(t, int64(12), *c.SecondsBehind)
+	}
+
+	c = parseReplicationChannel(map[string]sql.NullString{
+		"Source_Host":           str("10.0.0.1"),
+		"Replica_IO_Running":    str("Connecting"),
+		"Replica_SQL_Running":   str("Yes"),
+		"Seconds_Behind_Source": {},
+		"Last_IO_Error":         str("error connecting to source"),
+		"Channel_Name":          str("eu"),
+	})
+	assert.Equal(t, "eu", c.Channel)
+	assert.False(t, c.IORunning)
+	assert.True(t, c.SQLRunning)
+	assert.Nil(t, c.SecondsBehind)
+	assert.Equal(t, "error connecting to source", c.LastError)
+}
+
+func TestFillResultsPerSecond(t *testing.T) {
+	old := &Status{Selects: 100, InnoDBReadRequests: 1000, InnoDBReads: 10, SlowQueries: 1}
+	new := &Status{Selects: 200, InnoDBReadRequests: 2000, InnoDBReads: 60, SlowQueries: 11}
+
+	result := make(map[string]interface{})
+	fillResultsPerSecond(new, old, 10*time.Second, result)
+	assert.Equal(t, 10.0, result["Selects per sec"])
+	assert.Equal(t, 1.0, result["Slow queries per sec"])
+	assert.Equal(t, 95.0, result["Innodb buffer pool hit rate percent"])
+
+	fillResultsPerSecond(old, new, 10*time.Second, result)
+	assert.Nil(t, result["Innodb buffer pool hit rate percent"])
+}
@@ -0,0 +1,96 @@
+package mysql
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// ReplicationChannel is a row of SHOW REPLICA STATUS. A replica has one channel unless multi-source replication is used
+type ReplicationChannel struct {
+	Channel    string `json:"channel,omitempty"`
+	SourceHost string `json:"source_host"`
+	IOState    string `json:"io_running"`
+	SQLState   string `json:"sql_running"`
+	IORunning  bool   `json:"-"`
+	SQLRunning bool   `json:"-"`
+	// SecondsBehind is nil if the SQL thread is not running
+	SecondsBehind *int64 `json:"seconds_behind"`
+	LastError     string `json:"last_error,omitempty"`
+}
+
+// getReplicationStatus returns the replication channels, the list is empty if the server isn't a replica.
+// SHOW REPLICA STATUS is available since MySQL 8.0.22 and MariaDB 10.5.1, SHOW SLAVE STATUS is used for older versions
+func getReplicationStatus(db *sql.DB) ([]ReplicationChannel, error) {
+	rows, err := db.Query("SHOW REPLICA STATUS")
+	if err != nil {
+		rows, err = db.Query("SHOW SLAVE STATUS")
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	channels := []ReplicationChannel{}
+	for rows.Next() {
+		// the columns differ between the versions and the vendors, they are mapped by name
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		fields := make(map[string]sql.NullString, len(columns))
+		for i, c := range columns {
+			fields[c] = values[i]
+		}
+
+		channels = append(channels, parseReplicationChannel(fields))
+	}
+
+	return channels, rows.Err()
+}
+
+func parseReplicationChannel(fields map[string]sql.NullString) ReplicationChannel {
+	// the names are changed from Master/Slave to Source/Replica in MySQL 8.0.22
+	field := func(names ...string) sql.NullString {
+		for _, name := range names {
+			if v, exists := fields[name]; exists {
+				return v
+			}
+		}
+		return sql.NullString{}
+	}
+
+	c := ReplicationChannel{
+		Channel:    field("Channel_Name", "Connection_name").String,
+		SourceHost: field("Source_Host", "Master_Host").String,
+		IOState:    field("Replica_IO_Running", "Slave_IO_Running").String,
+		SQLState:   field("Replica_SQL_Running", "Slave_SQL_Running").String,
+	}
+	c.IORunning = strings.EqualFold(c.IOState, "Yes")
+	c.SQLRunning = strings.EqualFold(c.SQLState, "Yes")
+
+	if behind := field("Seconds_Behind_Source", "Seconds_Behind_Master"); behind.Valid {
+		if v, err := strconv.ParseInt(behind.String, 10, 64); err == nil {
+			c.SecondsBehind = &v
+		}
+	}
+
+	for _, names := range [][]string{{"Last_IO_Error"}, {"Last_SQL_Error"}, {"Last_Error"}} {
+		if e := field(names...).String; e != "" {
+			c.LastError = e
+			break
+		}
+	}
+
+	return c
+}
@@ -25,6 +25,19 @@ type Status struct {
 	InnoDBWriteBytes int64
 	ReadBytes        int64
 	WriteBytes       int64
+
+	AbortedConnects int64
+	AbortedClients  int64
+	SlowQueries     int64
+
+	// InnoDBReadRequests are the logical reads, InnoDBReads the reads which were not satisfied from the buffer pool
+	InnoDBReadRequests        int64
+	InnoDBReads               int64
+	InnoDBRowLockWaits        int64
+	InnoDBRowLockCurrentWaits int64
+
+	ThreadsConnected int64
+	ThreadsRunning   int64
 }
 
 func (s *Status) Queries() int64 {
@@ -36,7 +49,9 @@ func (s *Status) Queries() int64 {
 func getStatus(db *sql.DB) (*Status, error) {
 	rows, err := db.Query(`SHOW GLOBAL STATUS WHERE Variable_name IN (
 'Com_select', 'Com_insert', 'Com_update', 'Com_delete', 'Com_replace', 'Com_call_procedure', 
-'Qcache_hits', 'Com_commit', 'Innodb_data_read', 'Innodb_data_write', 'Bytes_received', 'Bytes_sent')`)
+'Qcache_hits', 'Com_commit', 'Innodb_data_read', 'Innodb_data_write', 'Bytes_received', 'Bytes_sent',
+'Aborted_connects', 'Aborted_clients', 'Slow_queries', 'Innodb_buffer_pool_read_requests', 'Innodb_buffer_pool_reads',
+'Innodb_row_lock_waits', 'Innodb_row_lock_current_waits', 'Threads_connected', 'Threads_running')`)
 	if err != nil {
 		return nil, err
 	}
@@ -81,6 +96,24 @@ func getStatus(db *sql.DB) (*Status, error) {
 			total.ReadBytes = valInt
 		case "Bytes_sent":
 			total.WriteBytes = valInt
+		case "Aborted_connects":
+			total.AbortedConnects = valInt
+		case "Aborted_clients":
+			total.AbortedClients = valInt
+		case "Slow_queries":
+			total.SlowQueries = valInt
+		case "Innodb_buffer_pool_read_requests":
+			total.InnoDBReadRequests = valInt
+		case "Innodb_buffer_pool_reads":
+			total.InnoDBReads = valInt
+		case "Innodb_row_lock_waits":
+			total.InnoDBRowLockWaits = valInt
+		case "Innodb_row_lock_current_waits":
+			total.InnoDBRowLockCurrentWaits = valInt
+		case "Threads_connected":
+			total.ThreadsConnected = valInt
+		case "Threads_running":
+			total.ThreadsRunning = valInt
 		}
 	}
 
@@ -89,38 +122,49 @@ func getStatus(db *sql.DB) (*Status, error) {
 
 func fillResultsPerSecond(new *Status, old *Status, durationBetween time.Duration, result map[string]interface{}) {
 	sec := durationBetween.Seconds()
-	result["Selects per sec"] = formatPerSec(new.Selects, old.Selects, sec)
-	result["Updates per sec"] = formatPerSec(new.Updates, old.Updates, sec)
-	result["Inserts per sec"] = formatPerSec(new.Inserts, old.Inserts, sec)
-	result["Deletes per sec"] = formatPerSec(new.Deletes, old.Deletes, sec)
-	result["Commits per sec"] = formatPerSec(new.Commits, old.Commits, sec)
-	result["Innodb data read bps"] = formatPerSec(new.InnoDBReadBytes, old.InnoDBReadBytes, sec)
-	result["Innodb data write bps"] = formatPerSec(new.InnoDBWriteBytes, old.InnoDBWriteBytes, sec)
-	result["Bytes read bps"] = formatPerSec(new.ReadBytes, old.ReadBytes, sec)
-	result["Bytes write bps"] = formatPerSec(new.WriteBytes, old.WriteBytes, sec)
-	result["Queries per sec"] = formatPerSec(new.Queries(), old.Queries(), sec)
-}
+	result["Selects per sec"] = common.FormatPerSec(new.Selects, old.Selects, sec)
+	result["Updates per sec"] = common.FormatPerSec(new.Updates, old.Updates, sec)
+	result["Inserts per sec"] = common.FormatPerSec(new.Inserts, old.Inserts, sec)
+	result["Deletes per sec"] = common.FormatPerSec(new.Deletes, old.Deletes, sec)
+	result["Commits per sec"] = common.FormatPerSec(new.Commits, old.Commits, sec)
+	result["Innodb data read bps"] = common.FormatPerSec(new.InnoDBReadBytes, old.InnoDBReadBytes, sec)
+	result["Innodb data write bps"] = common.FormatPerSec(new.InnoDBWriteBytes, old.InnoDBWriteBytes, sec)
+	result["Bytes read bps"] = common.FormatPerSec(new.ReadBytes, old.ReadBytes, sec)
+	result["Bytes write bps"] = common.FormatPerSec(new.WriteBytes, old.WriteBytes, sec)
+	result["Queries per sec"] = common.FormatPerSec(new.Queries(), old.Queries(), sec)
+	result["Aborted connects per sec"] = common.FormatPerSec(new.AbortedConnects, old.AbortedConnects, sec)
+	result["Aborted clients per sec"] = common.FormatPerSec(new.AbortedClients, old.AbortedClients, sec)
+	result["Slow queries per sec"] = common.FormatPerSec(new.SlowQueries, old.SlowQueries, sec)
+	result["Innodb row lock waits per sec"] = common.FormatPerSec(new.InnoDBRowLockWaits, old.InnoDBRowLockWaits, sec)
 
-func emptyResults() map[string]interface{} {
-	return map[string]interface{}{
-		"Selects per sec":       nil,
-		"Updates per sec":       nil,
-		"Inserts per sec":       nil,
-		"Deletes per sec":       nil,
-		"Commits per sec":       nil,
-		"Innodb data read bps":  nil,
-		"Innodb data write bps": nil,
-		"Bytes read bps":        nil,
-		"Bytes write bps":       nil,
-		"Queries per sec":       nil,
+	readRequests := new.InnoDBReadRequests - old.InnoDBReadRequests
+	reads := new.InnoDBReads - old.InnoDBReads
+	if readRequests > 0 && reads >= 0 && reads <= readRequests {
+		result["Innodb buffer pool hit rate percent"] = common.RoundToTwoDecimalPlaces(float64(readRequests-reads) / float64(readRequests) * 100)
+	} else {
+		// no reads or the counters were reset
+		result["Innodb buffer pool hit rate percent"] = nil
 	}
 }
 
-func formatPerSec(new int64, old int64, seconds float64) float64 {
-	v := float64(new-old) / seconds
-	if v < 0 {
-		return 0
+func fillEmptyResultsPerSecond(result map[string]interface{}) {
+	for _, key := range []string{
+		"Selects per sec",
+		"Updates per sec",
+		"Inserts per sec",
+		"Deletes per sec",
+		"Commits per sec",
+		"Innodb data read bps",
+		"Innodb data write bps",
+		"Bytes read bps",
+		"Bytes write bps",
+		"Queries per sec",
+		"Aborted connects per sec",
+		"Aborted clients per sec",
+		"Slow queries per sec",
+		"Innodb row lock waits per sec",
+		"Innodb buffer pool hit rate percent",
+	} {
+		result[key] = nil
 	}
-
-	return common.RoundToTwoDecimalPlaces(v)
 }
@@ -0,0 +1,169 @@
+package nagios
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+)
+
+const (
+	StatusOK       = "OK"
+	StatusWarning  = "WARNING"
+	StatusCritical = "CRITICAL"
+	StatusUnknown  = "UNKNOWN"
+
+	defaultTimeout = 10 * time.Second
+)
+
+var log = logrus.WithField("package", "nagios")
+
+// Check is a Nagios/Icinga compatible plugin executed by cagent
+type Check struct {
+	Name     string   `toml:"name" comment:"Name of the check used in the module report"`
+	Command  string   `toml:"command" comment:"Path to the plugin executable"`
+	Args     []string `toml:"args" comment:"Arguments passed to the plugin, no shell expansion is done"`
+	Timeout  float64  `toml:"timeout" comment:"The plugin is killed after N seconds and the check reported as UNKNOWN. Default: 10"`
+	Interval float64  `toml:"interval" comment:"Run the check every N seconds. Default: the interval of the modules"`
+}
+
+func (c *Check) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("name is empty")
+	}
+
+	if c.Command == "" {
+		return fmt.Errorf("command is empty")
+	}
+
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout should be equal or greater than 0.0")
+	}
+
+	if c.Interval < 0 {
+		return fmt.Errorf("interval should be equal or greater than 0.0")
+	}
+
+	return nil
+}
+
+func (c *Check) GetTimeout() time.Duration {
+	if c.Timeout == 0 {
+		return defaultTimeout
+	}
+	return time.Duration(int64(float64(time.Second) * c.Timeout))
+}
+
+type Nagios struct {
+	check *Check
+}
+
+func CreateModule(check *Check) monitoring.Module {
+	return &Nagios{check: check}
+}
+
+func (n *Nagios) GetDescription() string {
+	return fmt.Sprintf("nagios check '%s'", n.check.Name)
+}
+
+func (n *Nagios) IsEnabled() bool {
+	return n.check.Command != ""
+}
+
+func (n *Nagios) Run() ([]*monitoring.ModuleReport, error) {
+	report := monitoring.NewReport(
+		fmt.Sprintf("nagios check %s", n.check.Name),
+		time.Now(),
+		strings.Join(append([]string{n.check.Command}, n.check.Args...), " "),
+	)
+
+	out, errOut, err := n.execute()
+	exitCode := 0
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		} else {
+			// the plugin could not be executed or timed out
+			log.WithError(err).Debugf("check '%s' failed", n.check.Name)
+			report.Message = err.Error()
+			report.AddWarning(fmt.Sprintf("%s: %s", StatusUnknown, err.Error()))
+			report.Measurements = map[string]interface{}{"status": StatusUnknown}
+			return []*monitoring.ModuleReport{&report}, nil
+		}
+	}
+
+	text, perfData := parseOutput(string(out))
+	if text == "" {
+		// a plugin which fails early often writes the reason to stderr only
+		text = strings.TrimSpace(string(errOut))
+	}
+	report.Message = text
+
+	status := exitCodeStatus(exitCode)
+	switch status {
+	case StatusWarning, StatusUnknown:
+		report.AddWarning(fmt.Sprintf("%s: %s", status, text))
+	case StatusCritical:
+		report.AddAlert(fmt.Sprintf("%s: %s", status, text))
+	}
+
+	report.Measurements = map[string]interface{}{
+		"status":    status,
+		"exit_code": exitCode,
+	}
+	for _, p := range perfData {
+		p.addTo(report.Measurements)
+	}
+
+	return []*monitoring.ModuleReport{&report}, nil
+}
+
+// execute runs the plugin in its own process group which is killed with all children once the timeout is exceeded.
+// It returns the stdout and the stderr of the plugin
+func (n *Nagios) execute() ([]byte, []byte, error) {
+	cmd := exec.Command(n.check.Command, n.check.Args...)
+	common.SetProcessGroup(cmd)
+
+	var out, errOut bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errOut
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	timer := time.NewTimer(n.check.GetTimeout())
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return out.Bytes(), errOut.Bytes(), err
+	case <-timer.C:
+		// don't wait for the output, a child which escaped the process group may keep it open
+		_ = common.KillProcessGroup(cmd, syscall.SIGKILL)
+		return nil, nil, common.ErrCommandExecutionTimeout
+	}
+}
+
+func exitCodeStatus(exitCode int) string {
+	switch exitCode {
+	case 0:
+		return StatusOK
+	case 1:
+		return StatusWarning
+	case 2:
+		return StatusCritical
+	}
+	return StatusUnknown
+}
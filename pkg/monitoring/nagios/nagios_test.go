@@ -0,0 +1,97 @@
+// +build !windows
+
+package nagios
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+)
+
+func TestRun(t *testing.T) {
+	for _, tc := range []struct {
+		exitCode string
+		status   string
+		alerts   int
+		warnings int
+	}{
+		{"0", StatusOK, 0, 0},
+		{"1", StatusWarning, 0, 1},
+		{"2", StatusCritical, 1, 0},
+		{"3", StatusUnknown, 0, 1},
+		{"127", StatusUnknown, 0, 1},
+	} {
+		t.Run(tc.status+" "+tc.exitCode, func(t *testing.T) {
+			m := CreateModule(&Check{
+				Name:    "test",
+				Command: "/bin/sh",
+				Args:    []string{"-c", "echo 'LOAD '" + tc.exitCode + "' | load1=0.5;1;2;0'; exit " + tc.exitCode},
+			})
+
+			reports, err := m.Run()
+			assert.NoError(t, err)
+			if !assert.Len(t, reports, 1) {
+				return
+			}
+			r := reports[0]
+			assert.Equal(t, "LOAD "+tc.exitCode, r.Message)
+			assert.Len(t, r.Alerts, tc.alerts)
+			assert.Len(t, r.Warnings, tc.warnings)
+			assert.Equal(t, tc.status, r.Measurements["status"])
+			assert.Equal(t, 0.5, r.Measurements["load1"])
+			assert.Equal(t, "1", r.Measurements["load1.warn"])
+		})
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		m := CreateModule(&Check{Name: "test", Command: "/bin/sleep", Args: []string{"5"}, Timeout: 0.1})
+		reports, err := m.Run()
+		assert.NoError(t, err)
+		if assert.Len(t, reports, 1) {
+			assert.Equal(t, StatusUnknown, reports[0].Measurements["status"])
+			assert.Equal(t, common.ErrCommandExecutionTimeout.Error(), reports[0].Message)
+			assert.Len(t, reports[0].Warnings, 1)
+		}
+	})
+	t.Run("stderr", func(t *testing.T) {
+		m := CreateModule(&Check{Name: "test", Command: "/bin/sh", Args: []string{"-c", "echo 'no such device' >&2; exit 2"}})
+		reports, err := m.Run()
+		assert.NoError(t, err)
+		if assert.Len(t, reports, 1) {
+			assert.Equal(t, "no such device", reports[0].Message)
+			assert.Equal(t, []monitoring.Alert{"CRITICAL: no such device"}, reports[0].Alerts)
+		}
+	})
+	t.Run("timeout kills the children", func(t *testing.T) {
+		// the child keeps the stdout of the plugin open
+		m := CreateModule(&Check{Name: "test", Command: "/bin/sh", Args: []string{"-c", "sleep 5; echo done"}, Timeout: 0.1})
+		startedAt := time.Now()
+		reports, err := m.Run()
+		assert.NoError(t, err)
+		assert.True(t, time.Since(startedAt) < 2*time.Second)
+		if assert.Len(t, reports, 1) {
+			assert.Equal(t, StatusUnknown, reports[0].Measurements["status"])
+		}
+	})
+	t.Run("timeout kills the children which outlive the plugin", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "nagios")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		marker := filepath.Join(dir, "marker")
+		m := CreateModule(&Check{Name: "test", Command: "/bin/sh", Args: []string{"-c", "(sleep 0.5; touch " + marker + ") & wait"}, Timeout: 0.1})
+		_, err = m.Run()
+		assert.NoError(t, err)
+
+		time.Sleep(time.Second)
+		_, err = os.Stat(marker)
+		assert.True(t, os.IsNotExist(err), "the child must not finish")
+	})
+}
@@ -0,0 +1,144 @@
+package nagios
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PerfData is a single item of the plugin performance data: 'label'=value[UOM];[warn];[crit];[min];[max]
+type PerfData struct {
+	Label string
+	Value float64
+	UOM   string
+	Warn  string
+	Crit  string
+	Min   string
+	Max   string
+}
+
+func (p *PerfData) addTo(measurements map[string]interface{}) {
+	measurements[p.Label] = p.Value
+
+	for suffix, val := range map[string]string{"uom": p.UOM, "warn": p.Warn, "crit": p.Crit, "min": p.Min, "max": p.Max} {
+		if val != "" {
+			measurements[p.Label+"."+suffix] = val
+		}
+	}
+}
+
+// parseOutput splits the plugin output into the text and the performance data.
+// The first line is "TEXT|PERFDATA", following lines are the long text and may contain more performance data after a '|'
+func parseOutput(out string) (string, []PerfData) {
+	lines := strings.Split(strings.TrimRight(out, "\r\n"), "\n")
+
+	var perfStrings []string
+	text, perf := splitPipe(lines[0])
+	text = strings.TrimSpace(text)
+	perfStrings = append(perfStrings, perf)
+
+	var longText []string
+	inPerfData := false
+	for _, line := range lines[1:] {
+		if inPerfData {
+			perfStrings = append(perfStrings, line)
+			continue
+		}
+
+		before, after := splitPipe(line)
+		longText = append(longText, strings.TrimSpace(before))
+		if strings.Contains(line, "|") {
+			inPerfData = true
+			perfStrings = append(perfStrings, after)
+		}
+	}
+
+	if len(longText) > 0 {
+		text += "\n" + strings.Join(longText, "\n")
+	}
+
+	var result []PerfData
+	for _, s := range perfStrings {
+		result = append(result, parsePerfData(s)...)
+	}
+
+	return strings.TrimSpace(text), result
+}
+
+func splitPipe(line string) (string, string) {
+	parts := strings.SplitN(line, "|", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
+
+// parsePerfData parses the space separated items. Invalid items and items with the value 'U' are skipped
+func parsePerfData(s string) []PerfData {
+	var result []PerfData
+	for _, item := range splitPerfItems(s) {
+		eq := strings.LastIndex(item, "=")
+		if eq <= 0 {
+			continue
+		}
+
+		label := unquoteLabel(item[:eq])
+		fields := strings.Split(item[eq+1:], ";")
+
+		valueStr := fields[0]
+		numEnd := len(valueStr)
+		for i, r := range valueStr {
+			if !(r >= '0' && r <= '9' || r == '.' || r == '-' || r == '+' || r == 'e' || r == 'E') {
+				numEnd = i
+				break
+			}
+		}
+
+		value, err := strconv.ParseFloat(valueStr[:numEnd], 64)
+		if err != nil {
+			continue
+		}
+
+		p := PerfData{Label: label, Value: value, UOM: valueStr[numEnd:]}
+		for i, dst := range []*string{&p.Warn, &p.Crit, &p.Min, &p.Max} {
+			if i+1 < len(fields) {
+				*dst = fields[i+1]
+			}
+		}
+		result = append(result, p)
+	}
+
+	return result
+}
+
+// splitPerfItems splits by whitespace except inside single quoted labels
+func splitPerfItems(s string) []string {
+	var items []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range s {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+			current.WriteRune(r)
+		case (r == ' ' || r == '\t') && !quoted:
+			if current.Len() > 0 {
+				items = append(items, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		items = append(items, current.String())
+	}
+	return items
+}
+
+func unquoteLabel(label string) string {
+	if len(label) >= 2 && strings.HasPrefix(label, "'") && strings.HasSuffix(label, "'") {
+		// a quote inside a quoted label is escaped by doubling it
+		return strings.ReplaceAll(label[1:len(label)-1], "''", "'")
+	}
+	return label
+}
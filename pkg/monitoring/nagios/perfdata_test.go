@@ -0,0 +1,47 @@
+package nagios
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOutput(t *testing.T) {
+	t.Run("single line", func(t *testing.T) {
+		text, perf := parseOutput("DISK OK - free space: / 3326 MB (56%); | /=2643MB;5948;5958;0;5968\n")
+		assert.Equal(t, "DISK OK - free space: / 3326 MB (56%);", text)
+		assert.Equal(t, []PerfData{
+			{Label: "/", Value: 2643, UOM: "MB", Warn: "5948", Crit: "5958", Min: "0", Max: "5968"},
+		}, perf)
+	})
+
+	t.Run("long text", func(t *testing.T) {
+		out := "DISK OK - free space: / 3326 MB (56%); | /=2643MB;5948;5958;0;5968\n" +
+			"/ 15272 MB (77%);\n" +
+			"/boot 68 MB (69%); | /boot=68MB;88;93;0;98\n" +
+			"/home=69357MB;253404;253409;0;253414\n"
+		text, perf := parseOutput(out)
+		assert.Equal(t, "DISK OK - free space: / 3326 MB (56%);\n/ 15272 MB (77%);\n/boot 68 MB (69%);", text)
+		if assert.Len(t, perf, 3) {
+			assert.Equal(t, "/boot", perf[1].Label)
+			assert.Equal(t, "/home", perf[2].Label)
+			assert.Equal(t, 69357.0, perf[2].Value)
+		}
+	})
+
+	t.Run("no perfdata", func(t *testing.T) {
+		text, perf := parseOutput("PING OK")
+		assert.Equal(t, "PING OK", text)
+		assert.Empty(t, perf)
+	})
+}
+
+func TestParsePerfData(t *testing.T) {
+	perf := parsePerfData("'time spent'=0.25s;1;2 'it''s'=5 load1=0.5;;;0; size=U invalid rta=1.5e-2ms")
+	assert.Equal(t, []PerfData{
+		{Label: "time spent", Value: 0.25, UOM: "s", Warn: "1", Crit: "2"},
+		{Label: "it's", Value: 5},
+		{Label: "load1", Value: 0.5, Min: "0"},
+		{Label: "rta", Value: 0.015, UOM: "ms"},
+	}, perf)
+}
@@ -0,0 +1,251 @@
+package netcheck
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// A minimal DNS client to query the configured server directly.
+// The resolver of Go answers from /etc/hosts before it asks the server, which hides the answers of the server
+
+const (
+	dnsTypeA     = 1
+	dnsTypeCNAME = 5
+	dnsTypeMX    = 15
+	dnsTypeAAAA  = 28
+	dnsClassIN   = 1
+
+	dnsHeaderSize      = 12
+	dnsFlagRecursion   = 0x0100
+	dnsFlagTruncated   = 0x0200
+	dnsRcodeNXDomain   = 3
+	dnsMaxLabelLength  = 63
+	dnsMaxPointerJumps = 16
+	maxDNSUDPSize      = 4096
+)
+
+var dnsRecordTypes = map[string]uint16{
+	RecordTypeA:     dnsTypeA,
+	RecordTypeAAAA:  dnsTypeAAAA,
+	RecordTypeCNAME: dnsTypeCNAME,
+	RecordTypeMX:    dnsTypeMX,
+}
+
+// queryServer sends the query to the server over UDP and repeats it over TCP if the response was truncated
+func queryServer(ctx context.Context, server, name, recordType string) ([]string, error) {
+	qType := dnsRecordTypes[recordType]
+
+	idBuf := make([]byte, 2)
+	if _, err := rand.Read(idBuf); err != nil {
+		return nil, err
+	}
+	id := binary.BigEndian.Uint16(idBuf)
+
+	query, err := buildDNSQuery(id, name, qType)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := dnsExchange(ctx, "udp", server, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) >= dnsHeaderSize && binary.BigEndian.Uint16(resp[2:])&dnsFlagTruncated != 0 {
+		if resp, err = dnsExchange(ctx, "tcp", server, query); err != nil {
+			return nil, err
+		}
+	}
+
+	answers, err := parseDNSResponse(resp, id, qType)
+	if err != nil {
+		return nil, err
+	}
+	if len(answers) == 0 {
+		return nil, fmt.Errorf("no %s records found for %s", recordType, name)
+	}
+	return answers, nil
+}
+
+func buildDNSQuery(id uint16, name string, qType uint16) ([]byte, error) {
+	query := make([]byte, dnsHeaderSize, 512)
+	binary.BigEndian.PutUint16(query[0:], id)
+	binary.BigEndian.PutUint16(query[2:], dnsFlagRecursion)
+	// one question
+	binary.BigEndian.PutUint16(query[4:], 1)
+
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || len(label) > dnsMaxLabelLength {
+			return nil, fmt.Errorf("invalid name '%s'", name)
+		}
+		query = append(query, byte(len(label)))
+		query = append(query, label...)
+	}
+	query = append(query, 0)
+
+	fields := make([]byte, 4)
+	binary.BigEndian.PutUint16(fields[0:], qType)
+	binary.BigEndian.PutUint16(fields[2:], dnsClassIN)
+	return append(query, fields...), nil
+}
+
+func dnsExchange(ctx context.Context, network, server string, query []byte) ([]byte, error) {
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if network == "udp" {
+		if _, err = conn.Write(query); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, maxDNSUDPSize)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+
+	// messages over TCP are prefixed with the length
+	msg := make([]byte, 2, 2+len(query))
+	binary.BigEndian.PutUint16(msg, uint16(len(query)))
+	if _, err = conn.Write(append(msg, query...)); err != nil {
+		return nil, err
+	}
+
+	if _, err = io.ReadFull(conn, msg); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(msg))
+	if _, err = io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// parseDNSResponse returns the answers of the queried type, e.g. the addresses without the CNAME records leading to them
+func parseDNSResponse(msg []byte, id uint16, qType uint16) ([]string, error) {
+	if len(msg) < dnsHeaderSize {
+		return nil, fmt.Errorf("invalid DNS response: too short")
+	}
+	if binary.BigEndian.Uint16(msg[0:]) != id {
+		return nil, fmt.Errorf("invalid DNS response: unexpected id")
+	}
+
+	switch rcode := binary.BigEndian.Uint16(msg[2:]) & 0xf; rcode {
+	case 0:
+	case dnsRcodeNXDomain:
+		return nil, fmt.Errorf("no such host")
+	default:
+		return nil, fmt.Errorf("DNS server responded with rcode %d", rcode)
+	}
+
+	questions := int(binary.BigEndian.Uint16(msg[4:]))
+	records := int(binary.BigEndian.Uint16(msg[6:]))
+
+	off := dnsHeaderSize
+	var err error
+	for i := 0; i < questions; i++ {
+		if _, off, err = readDNSName(msg, off); err != nil {
+			return nil, err
+		}
+		// type and class
+		off += 4
+	}
+
+	var answers []string
+	for i := 0; i < records; i++ {
+		if _, off, err = readDNSName(msg, off); err != nil {
+			return nil, err
+		}
+		if off+10 > len(msg) {
+			return nil, fmt.Errorf("invalid DNS response: record is truncated")
+		}
+		rrType := binary.BigEndian.Uint16(msg[off:])
+		length := int(binary.BigEndian.Uint16(msg[off+8:]))
+		off += 10
+		if off+length > len(msg) {
+			return nil, fmt.Errorf("invalid DNS response: record is truncated")
+		}
+
+		if rrType == qType {
+			answer, err := parseDNSRecord(msg, off, length, rrType)
+			if err != nil {
+				return nil, err
+			}
+			answers = append(answers, answer)
+		}
+		off += length
+	}
+
+	return answers, nil
+}
+
+func parseDNSRecord(msg []byte, off, length int, rrType uint16) (string, error) {
+	data := msg[off : off+length]
+	switch rrType {
+	case dnsTypeA, dnsTypeAAAA:
+		if length != net.IPv4len && length != net.IPv6len {
+			return "", fmt.Errorf("invalid DNS response: address of %d bytes", length)
+		}
+		return net.IP(data).String(), nil
+	case dnsTypeCNAME:
+		name, _, err := readDNSName(msg, off)
+		return name, err
+	case dnsTypeMX:
+		if length < 3 {
+			return "", fmt.Errorf("invalid DNS response: MX record is truncated")
+		}
+		// the preference precedes the host
+		name, _, err := readDNSName(msg, off+2)
+		return name, err
+	}
+	return "", fmt.Errorf("unsupported record type %d", rrType)
+}
+
+// readDNSName reads the name at the offset following the compression pointers.
+// It returns the offset after the name at its original position
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, fmt.Errorf("invalid DNS response: name is truncated")
+		}
+
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, ".") + ".", end, nil
+		case length&0xc0 == 0xc0:
+			if off+1 >= len(msg) || jumps >= dnsMaxPointerJumps {
+				return "", 0, fmt.Errorf("invalid DNS response: invalid name compression")
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			jumps++
+		default:
+			if off+1+length > len(msg) {
+				return "", 0, fmt.Errorf("invalid DNS response: name is truncated")
+			}
+			labels = append(labels, string(msg[off+1:off+1+length]))
+			off += 1 + length
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package netcheck
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+)
+
+const (
+	TypeTCP = "tcp"
+	TypeUDP = "udp"
+	TypeDNS = "dns"
+
+	RecordTypeA     = "A"
+	RecordTypeAAAA  = "AAAA"
+	RecordTypeCNAME = "CNAME"
+	RecordTypeMX    = "MX"
+
+	defaultTimeout = 5 * time.Second
+	defaultDNSPort = "53"
+
+	maxResponseSize = 64 * 1024
+)
+
+var log = logrus.WithField("package", "netcheck")
+
+// Check is a TCP connect, a UDP probe or a DNS resolution
+type Check struct {
+	Name            string   `toml:"name" comment:"Name of the check used in the module report"`
+	Type            string   `toml:"type" comment:"'tcp', 'udp' or 'dns'"`
+	Address         string   `toml:"address" comment:"host:port to connect to. For type = 'dns' the server queried directly without /etc/hosts, default: the resolver of the system"`
+	Send            string   `toml:"send" comment:"Payload sent after connecting. Required for type = 'udp'"`
+	Expect          string   `toml:"expect" comment:"Text the response must contain. For type = 'udp' any response is accepted by default"`
+	Query           string   `toml:"query" comment:"Name to resolve. Required for type = 'dns'"`
+	RecordType      string   `toml:"record_type" comment:"'A', 'AAAA', 'CNAME' or 'MX'. Default: A"`
+	ExpectedAnswers []string `toml:"expected_answers" comment:"Alert if one of the answers is missing. IP addresses for A and AAAA, host names for CNAME and MX"`
+	Timeout         float64  `toml:"timeout" comment:"Time limit in seconds for the check. Default: 5"`
+	Interval        float64  `toml:"interval" comment:"Run the check every N seconds. Default: the interval of the modules"`
+}
+
+func (c *Check) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("name is empty")
+	}
+
+	switch c.Type {
+	case TypeTCP, TypeUDP:
+		if _, _, err := net.SplitHostPort(c.Address); err != nil {
+			return fmt.Errorf("invalid address: %s", err.Error())
+		}
+		if c.Type == TypeUDP && c.Send == "" {
+			return fmt.Errorf("send is required for type = '%s'", TypeUDP)
+		}
+	case TypeDNS:
+		if c.Query == "" {
+			return fmt.Errorf("query is required for type = '%s'", TypeDNS)
+		}
+		switch c.GetRecordType() {
+		case RecordTypeA, RecordTypeAAAA, RecordTypeCNAME, RecordTypeMX:
+		default:
+			return fmt.Errorf("unknown record_type '%s'. Possible values: A, AAAA, CNAME, MX", c.RecordType)
+		}
+	default:
+		return fmt.Errorf("unknown type '%s'. Possible values: %s, %s, %s", c.Type, TypeTCP, TypeUDP, TypeDNS)
+	}
+
+	if c.Timeout < 0 || c.Interval < 0 {
+		return fmt.Errorf("timeout and interval should be equal or greater than 0")
+	}
+
+	return nil
+}
+
+func (c *Check) GetTimeout() time.Duration {
+	if c.Timeout == 0 {
+		return defaultTimeout
+	}
+	return time.Duration(int64(float64(time.Second) * c.Timeout))
+}
+
+func (c *Check) GetRecordType() string {
+	if c.RecordType == "" {
+		return RecordTypeA
+	}
+	return strings.ToUpper(c.RecordType)
+}
+
+type NetCheck struct {
+	check *Check
+}
+
+func CreateModule(check *Check) monitoring.Module {
+	return &NetCheck{check: check}
+}
+
+func (n *NetCheck) GetDescription() string {
+	return fmt.Sprintf("%s check '%s'", n.check.Type, n.check.Name)
+}
+
+func (n *NetCheck) IsEnabled() bool {
+	return n.check.Type != ""
+}
+
+func (n *NetCheck) Run() ([]*monitoring.ModuleReport, error) {
+	var cmd string
+	if n.check.Type == TypeDNS {
+		cmd = fmt.Sprintf("%s %s %s", n.check.Type, n.check.GetRecordType(), n.check.Query)
+		if n.check.Address != "" {
+			cmd += " @" + n.check.Address
+		}
+	} else {
+		cmd = fmt.Sprintf("%s %s", n.check.Type, n.check.Address)
+	}
+	report := monitoring.NewReport(fmt.Sprintf("%s check %s", n.check.Type, n.check.Name), time.Now(), cmd)
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.check.GetTimeout())
+	defer cancel()
+
+	started := time.Now()
+	var answers []string
+	var err error
+	switch n.check.Type {
+	case TypeTCP, TypeUDP:
+		err = n.probe(ctx)
+	case TypeDNS:
+		answers, err = n.resolve(ctx)
+	}
+	latency := time.Since(started)
+
+	report.Measurements = map[string]interface{}{
+		"latency_ms": common.RoundToTwoDecimalPlaces(float64(latency) / float64(time.Millisecond)),
+	}
+	if answers != nil {
+		report.Measurements["answers"] = answers
+	}
+
+	if err == nil && n.check.Type == TypeDNS {
+		err = checkAnswers(answers, n.check.ExpectedAnswers)
+	}
+
+	if err != nil {
+		log.WithError(err).Debugf("check '%s' failed", n.check.Name)
+		report.AddAlert(err.Error())
+		report.Measurements["success"] = 0
+	} else {
+		report.Measurements["success"] = 1
+	}
+
+	return []*monitoring.ModuleReport{&report}, nil
+}
+
+// probe connects to the address, sends the payload and waits for the expected response
+func (n *NetCheck) probe(ctx context.Context) error {
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, n.check.Type, n.check.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	if n.check.Send != "" {
+		if _, err = conn.Write([]byte(n.check.Send)); err != nil {
+			return fmt.Errorf("failed to send: %s", err.Error())
+		}
+	}
+
+	if n.check.Expect == "" && n.check.Type == TypeTCP {
+		// connected successfully
+		return nil
+	}
+
+	buf := make([]byte, maxResponseSize)
+	var response []byte
+	for {
+		var read int
+		read, err = conn.Read(buf)
+		response = append(response, buf[:read]...)
+
+		if strings.Contains(string(response), n.check.Expect) && len(response) > 0 {
+			return nil
+		}
+		if err != nil {
+			break
+		}
+		if n.check.Type == TypeUDP || len(response) >= maxResponseSize {
+			// a datagram is read at once
+			break
+		}
+	}
+
+	if len(response) == 0 && err != nil {
+		return fmt.Errorf("no response: %s", err.Error())
+	}
+	return fmt.Errorf("response doesn't contain '%s'", n.check.Expect)
+}
+
+// serverAddress returns the host:port of the configured DNS server
+func (n *NetCheck) serverAddress() string {
+	if _, _, err := net.SplitHostPort(n.check.Address); err != nil {
+		return net.JoinHostPort(n.check.Address, defaultDNSPort)
+	}
+	return n.check.Address
+}
+
+// resolve sends the query to the configured server or resolves it like the system does, e.g. using /etc/hosts
+func (n *NetCheck) resolve(ctx context.Context) ([]string, error) {
+	// a fully qualified name is not affected by the search domains
+	query := n.check.Query
+	if !strings.HasSuffix(query, ".") {
+		query += "."
+	}
+
+	var answers []string
+	var err error
+	if n.check.Address != "" {
+		answers, err = queryServer(ctx, n.serverAddress(), query, n.check.GetRecordType())
+	} else {
+		answers, err = lookup(ctx, query, n.check.GetRecordType())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range answers {
+		if net.ParseIP(answers[i]) == nil {
+			answers[i] = normalizeName(answers[i])
+		}
+	}
+
+	// the canonical name of a host without an alias is the host itself
+	if n.check.GetRecordType() == RecordTypeCNAME && len(answers) == 1 && answers[0] == normalizeName(query) {
+		return nil, fmt.Errorf("no CNAME records found for %s", query)
+	}
+
+	sort.Strings(answers)
+	return answers, nil
+}
+
+// lookup resolves the query with the resolver of the system
+func lookup(ctx context.Context, query, recordType string) ([]string, error) {
+	r := net.DefaultResolver
+
+	var answers []string
+	switch recordType {
+	case RecordTypeA, RecordTypeAAAA:
+		network := "ip4"
+		if recordType == RecordTypeAAAA {
+			network = "ip6"
+		}
+		ips, err := r.LookupIP(ctx, network, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			answers = append(answers, ip.String())
+		}
+	case RecordTypeCNAME:
+		cname, err := r.LookupCNAME(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, cname)
+	case RecordTypeMX:
+		mxs, err := r.LookupMX(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range mxs {
+			answers = append(answers, mx.Host)
+		}
+	}
+
+	return answers, nil
+}
+
+func checkAnswers(answers, expected []string) error {
+	var missing []string
+	for _, e := range expected {
+		found := false
+		for _, a := range answers {
+			if normalizeAnswer(e) == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, e)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("expected answers missing: %s. Got: %s", strings.Join(missing, ", "), strings.Join(answers, ", "))
+	}
+	return nil
+}
+
+func normalizeAnswer(answer string) string {
+	if ip := net.ParseIP(answer); ip != nil {
+		return ip.String()
+	}
+	return normalizeName(answer)
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
@@ -0,0 +1,330 @@
+package netcheck
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/moduletest"
+)
+
+type dnsRecord struct {
+	rrType uint16
+	data   []byte
+}
+
+// stubDNSServer answers queries from the records by name, CNAME records are followed for other types
+type stubDNSServer struct {
+	conn    net.PacketConn
+	records map[string][]dnsRecord
+}
+
+func newStubDNSServer(t *testing.T) *stubDNSServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	mx := make([]byte, 2)
+	binary.BigEndian.PutUint16(mx, 10)
+	s := &stubDNSServer{
+		conn: conn,
+		records: map[string][]dnsRecord{
+			"www.example.test.": {
+				{rrType: dnsTypeA, data: net.ParseIP("192.0.2.1").To4()},
+				{rrType: dnsTypeA, data: net.ParseIP("192.0.2.2").To4()},
+				{rrType: dnsTypeAAAA, data: net.ParseIP("2001:db8::1").To16()},
+			},
+			"alias.example.test.": {
+				{rrType: dnsTypeCNAME, data: encodeName("www.example.test.")},
+			},
+			"example.test.": {
+				{rrType: dnsTypeMX, data: append(mx, encodeName("mail.example.test.")...)},
+			},
+		},
+	}
+	go s.serve()
+	return s
+}
+
+func (s *stubDNSServer) serve() {
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp := s.answer(buf[:n]); resp != nil {
+			_, _ = s.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *stubDNSServer) answer(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+
+	// the question follows the header, the name ends with a zero length label
+	end := 12
+	var labels []string
+	for end < len(query) && query[end] != 0 {
+		l := int(query[end])
+		if end+1+l > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[end+1:end+1+l]))
+		end += 1 + l
+	}
+	end += 5
+	if end > len(query) {
+		return nil
+	}
+	name := strings.ToLower(strings.Join(labels, ".")) + "."
+	qType := binary.BigEndian.Uint16(query[end-4 : end-2])
+
+	var answers [][]byte
+	_, exists := s.records[name]
+	for exists {
+		var cname string
+		for _, r := range s.records[name] {
+			if r.rrType == qType || r.rrType == dnsTypeCNAME {
+				answers = append(answers, encodeRR(name, r))
+			}
+			if r.rrType == dnsTypeCNAME && qType != dnsTypeCNAME {
+				cname = decodeName(r.data)
+			}
+		}
+		if cname == "" {
+			break
+		}
+		name = cname
+		_, exists = s.records[name]
+	}
+
+	resp := make([]byte, 12, 512)
+	copy(resp, query[:2])
+	flags := uint16(0x8180)
+	if _, found := s.records[strings.ToLower(strings.Join(labels, "."))+"."]; !found {
+		// NXDOMAIN
+		flags |= 3
+	}
+	binary.BigEndian.PutUint16(resp[2:], flags)
+	binary.BigEndian.PutUint16(resp[4:], 1)
+	binary.BigEndian.PutUint16(resp[6:], uint16(len(answers)))
+	resp = append(resp, query[12:end]...)
+	for _, a := range answers {
+		resp = append(resp, a...)
+	}
+	return resp
+}
+
+func (s *stubDNSServer) Close() {
+	s.conn.Close()
+}
+
+func encodeName(name string) []byte {
+	var res []byte
+	for _, l := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		res = append(res, byte(len(l)))
+		res = append(res, l...)
+	}
+	return append(res, 0)
+}
+
+func decodeName(data []byte) string {
+	var labels []string
+	for i := 0; i < len(data) && data[i] != 0; i += 1 + int(data[i]) {
+		labels = append(labels, string(data[i+1:i+1+int(data[i])]))
+	}
+	return strings.Join(labels, ".") + "."
+}
+
+func encodeRR(name string, r dnsRecord) []byte {
+	res := encodeName(name)
+	fields := make([]byte, 10)
+	binary.BigEndian.PutUint16(fields[0:], r.rrType)
+	// class IN, TTL 60
+	binary.BigEndian.PutUint16(fields[2:], 1)
+	binary.BigEndian.PutUint32(fields[4:], 60)
+	binary.BigEndian.PutUint16(fields[8:], uint16(len(r.data)))
+	res = append(res, fields...)
+	return append(res, r.data...)
+}
+
+func TestCheckValidate(t *testing.T) {
+	assert.NoError(t, (&Check{Name: "ssh", Type: TypeTCP, Address: "localhost:22"}).Validate())
+	assert.NoError(t, (&Check{Name: "ntp", Type: TypeUDP, Address: "localhost:123", Send: "x"}).Validate())
+	assert.NoError(t, (&Check{Name: "dns", Type: TypeDNS, Query: "example.com", RecordType: "mx"}).Validate())
+	assert.Error(t, (&Check{Name: "no port", Type: TypeTCP, Address: "localhost"}).Validate())
+	assert.Error(t, (&Check{Name: "no payload", Type: TypeUDP, Address: "localhost:123"}).Validate())
+	assert.Error(t, (&Check{Name: "no query", Type: TypeDNS}).Validate())
+	assert.Error(t, (&Check{Name: "txt", Type: TypeDNS, Query: "example.com", RecordType: "TXT"}).Validate())
+	assert.Error(t, (&Check{Name: "icmp", Type: "icmp", Address: "localhost:0"}).Validate())
+	assert.Error(t, (&Check{Type: TypeTCP, Address: "localhost:22"}).Validate())
+}
+
+func TestTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("220 ready\r\n"))
+			conn.Close()
+		}
+	}()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	tests := []struct {
+		name    string
+		check   Check
+		success bool
+	}{
+		{"connect", Check{Address: l.Addr().String()}, true},
+		{"expected banner", Check{Address: l.Addr().String(), Expect: "220"}, true},
+		{"unexpected banner", Check{Address: l.Addr().String(), Expect: "SSH-2.0"}, false},
+		{"refused", Check{Address: closedAddr}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check.Name = tt.name
+			tt.check.Type = TypeTCP
+			measurements, alerts, _ := moduletest.Run(t, CreateModule(&tt.check))
+			assert.Contains(t, measurements, "latency_ms")
+			if tt.success {
+				assert.Equal(t, 1, measurements["success"])
+				assert.Empty(t, alerts)
+			} else {
+				assert.Equal(t, 0, measurements["success"])
+				assert.Len(t, alerts, 1)
+			}
+		})
+	}
+}
+
+func TestUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if string(buf[:n]) == "PING" {
+				_, _ = conn.WriteTo([]byte("PONG"), addr)
+			}
+		}
+	}()
+
+	tests := []struct {
+		name    string
+		check   Check
+		success bool
+	}{
+		{"any response", Check{Send: "PING"}, true},
+		{"expected response", Check{Send: "PING", Expect: "PONG"}, true},
+		{"unexpected response", Check{Send: "PING", Expect: "PANG"}, false},
+		{"no response", Check{Send: "HELLO", Timeout: 0.2}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check.Name = tt.name
+			tt.check.Type = TypeUDP
+			tt.check.Address = conn.LocalAddr().String()
+			measurements, alerts, _ := moduletest.Run(t, CreateModule(&tt.check))
+			if tt.success {
+				assert.Equal(t, 1, measurements["success"])
+				assert.Empty(t, alerts)
+			} else {
+				assert.Equal(t, 0, measurements["success"])
+				assert.Len(t, alerts, 1)
+			}
+		})
+	}
+}
+
+func TestDNS(t *testing.T) {
+	s := newStubDNSServer(t)
+	defer s.Close()
+
+	tests := []struct {
+		name            string
+		query           string
+		recordType      string
+		expectedAnswers []string
+		answers         []string
+		success         bool
+	}{
+		{"A", "www.example.test", "", nil, []string{"192.0.2.1", "192.0.2.2"}, true},
+		{"A expected", "www.example.test", "A", []string{"192.0.2.2"}, []string{"192.0.2.1", "192.0.2.2"}, true},
+		{"A missing", "www.example.test", "A", []string{"192.0.2.3"}, []string{"192.0.2.1", "192.0.2.2"}, false},
+		{"AAAA", "www.example.test", "AAAA", []string{"2001:0db8::0001"}, []string{"2001:db8::1"}, true},
+		{"A via CNAME", "alias.example.test", "A", []string{"192.0.2.1"}, []string{"192.0.2.1", "192.0.2.2"}, true},
+		{"CNAME", "alias.example.test.", "CNAME", []string{"WWW.example.test."}, []string{"www.example.test"}, true},
+		{"MX", "example.test", "MX", []string{"mail.example.test"}, []string{"mail.example.test"}, true},
+		{"CNAME missing", "www.example.test", "CNAME", nil, nil, false},
+		{"NXDOMAIN", "missing.example.test", "A", nil, nil, false},
+		{"hosts file is not used", "localhost", "A", nil, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := &Check{
+				Name:            tt.name,
+				Type:            TypeDNS,
+				Address:         s.conn.LocalAddr().String(),
+				Query:           tt.query,
+				RecordType:      tt.recordType,
+				ExpectedAnswers: tt.expectedAnswers,
+			}
+			measurements, alerts, _ := moduletest.Run(t, CreateModule(check))
+			assert.Contains(t, measurements, "latency_ms")
+			if tt.answers != nil {
+				assert.Equal(t, tt.answers, measurements["answers"])
+			}
+			if tt.success {
+				assert.Equal(t, 1, measurements["success"])
+				assert.Empty(t, alerts)
+			} else {
+				assert.Equal(t, 0, measurements["success"])
+				assert.Len(t, alerts, 1)
+			}
+		})
+	}
+}
+
+func TestReadDNSName(t *testing.T) {
+	// "example.test." at 12 and "www" with a pointer to it at 26
+	msg := append(make([]byte, 12), encodeName("example.test.")...)
+	msg = append(msg, 3, 'w', 'w', 'w', 0xc0, 12)
+
+	name, end, err := readDNSName(msg, 12)
+	require.NoError(t, err)
+	assert.Equal(t, "example.test.", name)
+	assert.Equal(t, 26, end)
+
+	name, end, err = readDNSName(msg, 26)
+	require.NoError(t, err)
+	assert.Equal(t, "www.example.test.", name)
+	assert.Equal(t, 32, end)
+
+	// a pointer to itself
+	_, _, err = readDNSName(append(msg, 0xc0, 32), 32)
+	assert.Error(t, err)
+}
@@ -0,0 +1,327 @@
+package portpolicy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+)
+
+const wildcard = "*"
+
+var log = logrus.WithField("package", "portpolicy")
+
+// Config is the policy of the expected listening ports
+type Config struct {
+	Enabled   bool     `toml:"enabled" comment:"Set 'true' to check the listening ports against the policy"`
+	Required  []string `toml:"required" comment:"Listeners which must exist as 'proto:port' or 'proto:port:program', e.g. 'tcp:22:sshd'. A missing one raises an alert"`
+	Allowed   []string `toml:"allowed" comment:"Other expected listeners in the same format. Port and program can be '*'. Any listener not required or allowed raises a warning.\nUse allowed = [\"*\"] to report only the changes"`
+	StateFile string   `toml:"state_file" comment:"File to keep the listeners of the previous run to report the added and removed ones"`
+}
+
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	for _, p := range c.Required {
+		if _, err := parsePattern(p); err != nil {
+			return fmt.Errorf("required: %s", err.Error())
+		}
+	}
+	for _, p := range c.Allowed {
+		if _, err := parsePattern(p); err != nil {
+			return fmt.Errorf("allowed: %s", err.Error())
+		}
+	}
+
+	if c.StateFile != "" && !filepath.IsAbs(c.StateFile) {
+		return fmt.Errorf("state_file path must be absolute")
+	}
+
+	return nil
+}
+
+// Listener is a listening socket
+type Listener struct {
+	Protocol string `json:"proto"`
+	Address  string `json:"addr"`
+	Program  string `json:"program,omitempty"`
+}
+
+func (l Listener) String() string {
+	if l.Program == "" {
+		return l.Protocol + " " + l.Address
+	}
+	return fmt.Sprintf("%s %s (%s)", l.Protocol, l.Address, l.Program)
+}
+
+func (l Listener) port() string {
+	i := strings.LastIndex(l.Address, ":")
+	if i < 0 {
+		return ""
+	}
+	return l.Address[i+1:]
+}
+
+// pattern matches listeners by 'proto:port[:program]'.
+// The protocols 'tcp' and 'udp' match both IPv4 and IPv6 sockets
+type pattern struct {
+	raw      string
+	protocol string
+	port     string
+	program  string
+}
+
+func parsePattern(s string) (pattern, error) {
+	p := pattern{raw: s, protocol: wildcard, port: wildcard, program: wildcard}
+	if s == wildcard {
+		return p, nil
+	}
+
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) < 2 {
+		return p, fmt.Errorf("invalid listener '%s'. Expected 'proto:port' or 'proto:port:program'", s)
+	}
+
+	p.protocol = strings.ToLower(parts[0])
+	switch p.protocol {
+	case "tcp", "tcp6", "udp", "udp6", wildcard:
+	default:
+		return p, fmt.Errorf("invalid protocol '%s' of listener '%s'. Possible values: tcp, tcp6, udp, udp6, *", parts[0], s)
+	}
+
+	p.port = parts[1]
+	if p.port != wildcard {
+		if _, err := strconv.ParseUint(p.port, 10, 16); err != nil {
+			return p, fmt.Errorf("invalid port '%s' of listener '%s'", parts[1], s)
+		}
+	}
+
+	if len(parts) == 3 && parts[2] != "" {
+		p.program = parts[2]
+	}
+
+	return p, nil
+}
+
+// matches checks the listener. The program isn't compared if it's unknown, e.g. cagent doesn't run as root
+func (p pattern) matches(l Listener) bool {
+	if p.protocol != wildcard && p.protocol != l.Protocol && p.protocol+"6" != l.Protocol {
+		return false
+	}
+	if p.port != wildcard && p.port != l.port() {
+		return false
+	}
+	return p.program == wildcard || p.program == l.Program || l.Program == ""
+}
+
+// matchesPortOnly is true if the pattern requires a program which is unknown for the listener
+func (p pattern) matchesPortOnly(l Listener) bool {
+	return p.program != wildcard && l.Program == "" && p.matches(l)
+}
+
+// Policy compares the listeners with the config and the listeners of the previous run
+type Policy struct {
+	config   *Config
+	required []pattern
+	allowed  []pattern
+
+	previous       []Listener
+	previousLoaded bool
+}
+
+func NewPolicy(config *Config) *Policy {
+	p := &Policy{config: config}
+	// the patterns are checked by Validate
+	for _, s := range config.Required {
+		if pt, err := parsePattern(s); err == nil {
+			p.required = append(p.required, pt)
+		}
+	}
+	for _, s := range config.Allowed {
+		if pt, err := parsePattern(s); err == nil {
+			p.allowed = append(p.allowed, pt)
+		}
+	}
+	return p
+}
+
+// Evaluate returns the report with the missing and unexpected listeners
+// and the changes since the previous run. The listeners are remembered for the next run
+func (p *Policy) Evaluate(listeners []Listener, now time.Time) *monitoring.ModuleReport {
+	report := monitoring.NewReport("listening ports policy", now, "")
+
+	current := unique(listeners)
+
+	var missing []string
+	for _, r := range p.required {
+		found := false
+		for _, l := range current {
+			if r.matches(l) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, r.raw)
+			report.AddAlert(fmt.Sprintf("required listener '%s' is missing", r.raw))
+		}
+	}
+
+	var unexpected []string
+	for _, l := range current {
+		if matchesAny(p.required, l) || matchesAny(p.allowed, l) {
+			continue
+		}
+		unexpected = append(unexpected, l.String())
+		report.AddWarning(fmt.Sprintf("unexpected listener %s", l.String()))
+	}
+
+	previous, hasPrevious := p.loadPrevious()
+	var added, removed []string
+	if hasPrevious {
+		added = difference(current, previous)
+		removed = difference(previous, current)
+	}
+
+	if err := p.save(current); err != nil {
+		log.WithError(err).Error("failed to save the listeners")
+		report.AddWarning(fmt.Sprintf("failed to save the listeners: %s", err.Error()))
+	}
+
+	portOnly := []string{}
+	for _, pt := range append(append([]pattern{}, p.required...), p.allowed...) {
+		for _, l := range current {
+			if pt.matchesPortOnly(l) {
+				portOnly = append(portOnly, pt.raw)
+				break
+			}
+		}
+	}
+	if len(portOnly) > 0 {
+		report.Message = fmt.Sprintf("the program of some listeners is unknown, matched by the port only: %s", strings.Join(portOnly, ", "))
+	}
+
+	report.Measurements = map[string]interface{}{
+		"listeners":  len(current),
+		"missing":    nonNil(missing),
+		"unexpected": nonNil(unexpected),
+		"added":      nonNil(added),
+		"removed":    nonNil(removed),
+		"port_only":  portOnly,
+	}
+
+	return &report
+}
+
+// loadPrevious returns the listeners of the previous run, reading them from the state file after a restart
+func (p *Policy) loadPrevious() ([]Listener, bool) {
+	if p.previousLoaded {
+		return p.previous, true
+	}
+
+	if p.config.StateFile == "" {
+		return nil, false
+	}
+
+	data, err := ioutil.ReadFile(p.config.StateFile)
+	if os.IsNotExist(err) {
+		return nil, false
+	}
+	if err != nil {
+		log.WithError(err).Warn("failed to read the listeners of the previous run")
+		return nil, false
+	}
+
+	var previous []Listener
+	if err = json.Unmarshal(data, &previous); err != nil {
+		log.WithError(err).Warnf("invalid state file %s", p.config.StateFile)
+		return nil, false
+	}
+
+	return previous, true
+}
+
+func (p *Policy) save(listeners []Listener) error {
+	p.previous = listeners
+	p.previousLoaded = true
+
+	if p.config.StateFile == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(listeners)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(p.config.StateFile), 0755); err != nil {
+		return err
+	}
+
+	// replace the file atomically to not lose the state if cagent is stopped meanwhile
+	tmpFile := p.config.StateFile + ".tmp"
+	if err = ioutil.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, p.config.StateFile)
+}
+
+func matchesAny(patterns []pattern, l Listener) bool {
+	for _, p := range patterns {
+		if p.matches(l) {
+			return true
+		}
+	}
+	return false
+}
+
+// unique returns the sorted listeners without duplicates, e.g. the sockets of several workers of the same program
+func unique(listeners []Listener) []Listener {
+	seen := make(map[Listener]bool, len(listeners))
+	res := make([]Listener, 0, len(listeners))
+	for _, l := range listeners {
+		if !seen[l] {
+			seen[l] = true
+			res = append(res, l)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].String() < res[j].String()
+	})
+	return res
+}
+
+// difference returns the listeners of a which are not in b
+func difference(a, b []Listener) []string {
+	inB := make(map[Listener]bool, len(b))
+	for _, l := range b {
+		inB[l] = true
+	}
+
+	var res []string
+	for _, l := range a {
+		if !inB[l] {
+			res = append(res, l.String())
+		}
+	}
+	return res
+}
+
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
@@ -0,0 +1,136 @@
+package portpolicy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	sshd   = Listener{Protocol: "tcp", Address: "0.0.0.0:22", Program: "sshd"}
+	sshd6  = Listener{Protocol: "tcp6", Address: ":::22", Program: "sshd"}
+	nginx  = Listener{Protocol: "tcp", Address: "0.0.0.0:443", Program: "nginx"}
+	ntpd   = Listener{Protocol: "udp", Address: "0.0.0.0:123", Program: "ntpd"}
+	netcat = Listener{Protocol: "tcp", Address: "0.0.0.0:4444", Program: "nc"}
+	// the program is unknown if cagent doesn't run as root
+	unknown = Listener{Protocol: "tcp", Address: "0.0.0.0:22"}
+)
+
+func evaluate(p *Policy, listeners ...Listener) (map[string]interface{}, []string, []string) {
+	report := p.Evaluate(listeners, time.Now())
+
+	var alerts, warnings []string
+	for _, a := range report.Alerts {
+		alerts = append(alerts, string(a))
+	}
+	for _, w := range report.Warnings {
+		warnings = append(warnings, string(w))
+	}
+	return report.Measurements, alerts, warnings
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, (&Config{Required: []string{"invalid"}}).Validate(), "disabled config is not validated")
+	assert.NoError(t, (&Config{Enabled: true, Required: []string{"tcp:22:sshd", "tcp6:443"}, Allowed: []string{"*", "udp:*", "*:*:java"}}).Validate())
+	assert.Error(t, (&Config{Enabled: true, Required: []string{"tcp"}}).Validate())
+	assert.Error(t, (&Config{Enabled: true, Required: []string{"sctp:22"}}).Validate())
+	assert.Error(t, (&Config{Enabled: true, Allowed: []string{"tcp:65536"}}).Validate())
+	assert.Error(t, (&Config{Enabled: true, StateFile: "listeningports.json"}).Validate())
+}
+
+func TestPatternMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		l       Listener
+		matches bool
+	}{
+		{"tcp:22", sshd, true},
+		{"tcp:22", sshd6, true},
+		{"tcp6:22", sshd, false},
+		{"tcp6:22", sshd6, true},
+		{"tcp:22:sshd", sshd, true},
+		{"tcp:22:dropbear", sshd, false},
+		{"udp:22", sshd, false},
+		{"*:*:sshd", sshd6, true},
+		{"tcp:*", nginx, true},
+		{"*", ntpd, true},
+		{"tcp:44", netcat, false},
+		{"tcp:22:sshd", unknown, true},
+		{"tcp:443:nginx", unknown, false},
+	}
+
+	for _, tt := range tests {
+		p, err := parsePattern(tt.pattern)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.matches, p.matches(tt.l), "%s matches %s", tt.pattern, tt.l)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	p := NewPolicy(&Config{
+		Enabled:  true,
+		Required: []string{"tcp:22:sshd", "tcp:443"},
+		Allowed:  []string{"udp:*"},
+	})
+
+	t.Run("first run", func(t *testing.T) {
+		measurements, alerts, warnings := evaluate(p, sshd, sshd6, nginx, ntpd)
+		assert.Empty(t, alerts)
+		assert.Empty(t, warnings)
+		assert.Equal(t, 4, measurements["listeners"])
+		assert.Equal(t, []string{}, measurements["added"])
+		assert.Equal(t, []string{}, measurements["removed"])
+		assert.Equal(t, []string{}, measurements["port_only"])
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		measurements, alerts, warnings := evaluate(p, sshd, sshd6, ntpd, netcat, netcat)
+		assert.Equal(t, []string{"required listener 'tcp:443' is missing"}, alerts)
+		assert.Equal(t, []string{"unexpected listener tcp 0.0.0.0:4444 (nc)"}, warnings)
+		assert.Equal(t, []string{"tcp:443"}, measurements["missing"])
+		assert.Equal(t, []string{"tcp 0.0.0.0:4444 (nc)"}, measurements["unexpected"])
+		assert.Equal(t, []string{"tcp 0.0.0.0:4444 (nc)"}, measurements["added"])
+		assert.Equal(t, []string{"tcp 0.0.0.0:443 (nginx)"}, measurements["removed"])
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		measurements, alerts, warnings := evaluate(p, netcat, ntpd, sshd6, sshd)
+		assert.Len(t, alerts, 1)
+		assert.Len(t, warnings, 1)
+		assert.Equal(t, []string{}, measurements["added"])
+		assert.Equal(t, []string{}, measurements["removed"])
+	})
+}
+
+func TestEvaluateUnknownProgram(t *testing.T) {
+	p := NewPolicy(&Config{Enabled: true, Required: []string{"tcp:22:sshd"}})
+	report := p.Evaluate([]Listener{unknown}, time.Now())
+	assert.Empty(t, report.Alerts)
+	assert.Empty(t, report.Warnings)
+	assert.Equal(t, []string{"tcp:22:sshd"}, report.Measurements["port_only"])
+	assert.Contains(t, report.Message, "matched by the port only: tcp:22:sshd")
+}
+
+func TestStateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "portpolicy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &Config{Enabled: true, Allowed: []string{"*"}, StateFile: filepath.Join(dir, "state", "listeningports.json")}
+	measurements, _, warnings := evaluate(NewPolicy(cfg), sshd, nginx)
+	assert.Empty(t, warnings)
+	assert.Equal(t, []string{}, measurements["added"])
+	assert.FileExists(t, cfg.StateFile)
+
+	// a new policy, e.g. after a restart, continues with the listeners from the file
+	measurements, _, warnings = evaluate(NewPolicy(cfg), sshd, ntpd)
+	assert.Empty(t, warnings)
+	assert.Equal(t, []string{"udp 0.0.0.0:123 (ntpd)"}, measurements["added"])
+	assert.Equal(t, []string{"tcp 0.0.0.0:443 (nginx)"}, measurements["removed"])
+}
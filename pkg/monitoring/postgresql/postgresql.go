@@ -0,0 +1,290 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+)
+
+const (
+	defaultPort         = "5432"
+	defaultQueryTimeout = 10 * time.Second
+)
+
+var log = logrus.WithField("package", "postgresql")
+
+type Config struct {
+	Enabled                  bool    `toml:"enabled" comment:"Set 'true' to enable the PostgreSQL monitoring"`
+	Connect                  string  `toml:"connect" comment:"host:port of the server or the directory of the unix socket, e.g. /var/run/postgresql"`
+	User                     string  `toml:"user" comment:"Create a user with minimal rights\npostgres=# CREATE USER cagent WITH PASSWORD '<password>' IN ROLE pg_monitor;"`
+	Password                 string  `toml:"password" comment:"Password of the user, leave empty for the peer or trust authentication"`
+	Database                 string  `toml:"database" comment:"Database to connect to. The statistics of all databases are reported regardless. Default: postgres"`
+	SSLMode                  string  `toml:"sslmode" comment:"Possible values: 'disable', 'require', 'verify-ca', 'verify-full'. Default: disable"`
+	ConnectTimeout           float64 `toml:"connect_timeout" comment:"Maximum time to wait for the server to connect using provided credentials"`
+	QueryTimeout             float64 `toml:"query_timeout" comment:"The queries of a run are cancelled after N seconds. Default: 10"`
+	MaxConnectionsPercent    float64 `toml:"max_connections_percent" comment:"Alert if the number of client connections exceeds N percent of max_connections. Default: 90"`
+	MaxReplicationLag        float64 `toml:"max_replication_lag" comment:"Alert if a replica lags more than N seconds behind. A replica without a streaming WAL receiver raises an alert as well. Default: 300"`
+	LongTransactionThreshold float64 `toml:"long_transaction_threshold" comment:"Transactions running for more than N seconds are counted as long-running. Default: 300"`
+}
+
+func (cfg *Config) Validate() error {
+	if cfg.ConnectTimeout < 0 || cfg.QueryTimeout < 0 {
+		return fmt.Errorf("connect_timeout and query_timeout should be equal or greater than 0.0")
+	}
+
+	if cfg.MaxConnectionsPercent < 0 || cfg.MaxConnectionsPercent > 100 {
+		return fmt.Errorf("max_connections_percent should be between 0 and 100")
+	}
+
+	if cfg.MaxReplicationLag < 0 || cfg.LongTransactionThreshold < 0 {
+		return fmt.Errorf("max_replication_lag and long_transaction_threshold should be equal or greater than 0.0")
+	}
+
+	switch cfg.SSLMode {
+	case "", "disable", "require", "verify-ca", "verify-full":
+	default:
+		return fmt.Errorf("unknown sslmode '%s'", cfg.SSLMode)
+	}
+
+	return nil
+}
+
+func (cfg *Config) GetQueryTimeout() time.Duration {
+	if cfg.QueryTimeout == 0 {
+		return defaultQueryTimeout
+	}
+	return common.SecToDuration(cfg.QueryTimeout)
+}
+
+func CreateModule(config *Config) monitoring.Module {
+	return &Postgresql{
+		config: config,
+	}
+}
+
+type Postgresql struct {
+	config *Config
+
+	// mu guards the client, it's closed from another goroutine when the config is reloaded
+	mu     sync.Mutex
+	client *sql.DB
+
+	lastStatus     *Status
+	lastStatusTime time.Time
+}
+
+func (r *Postgresql) getClient() (*sql.DB, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.client != nil {
+		return r.client, nil
+	}
+
+	dsn, err := r.dataSourceName()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect %s: %s", r.config.Connect, err.Error())
+	}
+
+	// a single connection is enough for the queries run one after another
+	db.SetMaxOpenConns(1)
+
+	r.client = db
+	return db, nil
+}
+
+// Close releases the connection pool. It's not opened again, so a run which is still in progress fails
+func (r *Postgresql) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.client == nil {
+		return nil
+	}
+	return r.client.Close()
+}
+
+// dataSourceName returns the connection string in the key=value format of lib/pq
+func (r *Postgresql) dataSourceName() (string, error) {
+	if len(r.config.Connect) == 0 {
+		return "", fmt.Errorf("connect address is empty")
+	}
+
+	if len(r.config.User) == 0 {
+		return "", fmt.Errorf("user is empty")
+	}
+
+	var host, port string
+	if filepath.IsAbs(r.config.Connect) {
+		// the directory of the unix socket
+		host = r.config.Connect
+		port = defaultPort
+	} else if h, p, err := net.SplitHostPort(r.config.Connect); err == nil {
+		host, port = h, p
+	} else {
+		host = strings.Trim(r.config.Connect, "[]")
+		port = defaultPort
+	}
+
+	params := [][2]string{
+		{"host", host},
+		{"port", port},
+		{"user", r.config.User},
+		{"password", r.config.Password},
+		{"dbname", r.config.Database},
+		{"sslmode", r.config.SSLMode},
+		{"connect_timeout", fmt.Sprintf("%d", int(r.config.ConnectTimeout+0.5))},
+		{"application_name", "cagent"},
+	}
+
+	var parts []string
+	for _, p := range params {
+		if p[1] == "" {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s=%s", p[0], quoteParam(p[1])))
+	}
+
+	return strings.Join(parts, " "), nil
+}
+
+func quoteParam(v string) string {
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, `'`, `\'`, -1)
+	return "'" + v + "'"
+}
+
+func (r *Postgresql) GetDescription() string {
+	return fmt.Sprintf("PostgreSQL performance for %s", r.config.Connect)
+}
+
+func (r *Postgresql) IsEnabled() bool {
+	return r.config.Enabled
+}
+
+func (r *Postgresql) Run() ([]*monitoring.ModuleReport, error) {
+	report := monitoring.NewReport(
+		fmt.Sprintf("PostgreSQL performance metrics for %s", r.config.Connect),
+		time.Now(),
+		"",
+	)
+
+	client, err := r.getClient()
+	if err != nil {
+		report.AddAlert(err.Error())
+		return []*monitoring.ModuleReport{&report}, nil
+	}
+
+	// a hanging server must not block the module, the queries are cancelled on the server as well
+	ctx, cancel := context.WithTimeout(context.Background(), r.config.GetQueryTimeout())
+	defer cancel()
+
+	statusTime := time.Now()
+	status, err := getStatus(ctx, client)
+	if err != nil {
+		report.AddAlert(fmt.Sprintf("failed to get status: %s", err.Error()))
+		return []*monitoring.ModuleReport{&report}, nil
+	}
+
+	report.Measurements = make(map[string]interface{})
+	if r.lastStatus == nil {
+		// need one more iteration to calculate the rates
+		// but we need to provide nil measurements for consistency
+		fillEmptyResultsPerSecond(report.Measurements)
+	} else {
+		fillResultsPerSecond(status, r.lastStatus, statusTime.Sub(r.lastStatusTime), report.Measurements)
+	}
+	r.lastStatus = status
+	r.lastStatusTime = statusTime
+
+	r.checkConnections(ctx, client, &report)
+	r.checkReplication(ctx, client, &report)
+	r.checkTransactions(ctx, client, &report)
+
+	sizes, err := getDatabaseSizes(ctx, client)
+	if err != nil {
+		report.AddWarning(fmt.Sprintf("failed to get database sizes: %s", err.Error()))
+	}
+	report.Measurements["Database sizes B"] = sizes
+
+	return []*monitoring.ModuleReport{&report}, nil
+}
+
+func (r *Postgresql) checkConnections(ctx context.Context, client *sql.DB, report *monitoring.ModuleReport) {
+	connections, maxConnections, err := getConnections(ctx, client)
+	if err != nil {
+		report.AddWarning(fmt.Sprintf("failed to get connections: %s", err.Error()))
+		return
+	}
+
+	report.Measurements["Connections"] = connections
+	report.Measurements["Max connections"] = maxConnections
+	if maxConnections == 0 {
+		return
+	}
+
+	percent := float64(connections) / float64(maxConnections) * 100
+	report.Measurements["Connections percent"] = common.RoundToTwoDecimalPlaces(percent)
+	if r.config.MaxConnectionsPercent > 0 && percent > r.config.MaxConnectionsPercent {
+		report.AddAlert(fmt.Sprintf("%d of %d connections in use (%.2f%%)", connections, maxConnections, percent))
+	}
+}
+
+func (r *Postgresql) checkReplication(ctx context.Context, client *sql.DB, report *monitoring.ModuleReport) {
+	replication, err := getReplication(ctx, client)
+	if err != nil {
+		report.AddWarning(fmt.Sprintf("failed to get replication status: %s", err.Error()))
+		return
+	}
+
+	report.Measurements["Is replica"] = replication.IsReplica
+	report.Measurements["Replicas"] = replication.Replicas
+	if replication.IsReplica {
+		report.Measurements["Replication lag sec"] = replication.ReplayLag
+		report.Measurements["WAL receiver status"] = replication.ReceiverStatus
+		switch replication.ReceiverStatus {
+		case receiverStatusStreaming, receiverStatusUnknown:
+		default:
+			report.AddAlert(fmt.Sprintf("WAL receiver is %s, the replica doesn't receive the changes of the primary", replication.ReceiverStatus))
+		}
+		if replication.ReplayLag != nil && r.exceedsReplicationLag(*replication.ReplayLag) {
+			report.AddAlert(fmt.Sprintf("replica lags %.0f seconds behind the primary", *replication.ReplayLag))
+		}
+	}
+
+	for _, replica := range replication.Replicas {
+		if replica.ReplayLag != nil && r.exceedsReplicationLag(*replica.ReplayLag) {
+			report.AddAlert(fmt.Sprintf("replica %s lags %.0f seconds behind", replica.Name, *replica.ReplayLag))
+		}
+	}
+}
+
+func (r *Postgresql) exceedsReplicationLag(lag float64) bool {
+	return r.config.MaxReplicationLag > 0 && lag > r.config.MaxReplicationLag
+}
+
+func (r *Postgresql) checkTransactions(ctx context.Context, client *sql.DB, report *monitoring.ModuleReport) {
+	count, longest, err := getLongTransactions(ctx, client, r.config.LongTransactionThreshold)
+	if err != nil {
+		report.AddWarning(fmt.Sprintf("failed to get transactions: %s", err.Error()))
+		return
+	}
+
+	report.Measurements["Long-running transactions"] = count
+	report.Measurements["Longest transaction sec"] = longest
+}
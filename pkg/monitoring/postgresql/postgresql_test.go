@@ -0,0 +1,75 @@
+package postgresql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataSourceName(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		dsn     string
+		invalid bool
+	}{
+		{
+			name:   "tcp",
+			config: Config{Connect: "db.example.com:5433", User: "cagent", Password: "pa'ss", Database: "postgres", SSLMode: "require", ConnectTimeout: 5},
+			dsn:    `host='db.example.com' port='5433' user='cagent' password='pa\'ss' dbname='postgres' sslmode='require' connect_timeout='5' application_name='cagent'`,
+		},
+		{
+			name:   "default port",
+			config: Config{Connect: "127.0.0.1", User: "cagent"},
+			dsn:    `host='127.0.0.1' port='5432' user='cagent' connect_timeout='0' application_name='cagent'`,
+		},
+		{
+			name:   "ipv6",
+			config: Config{Connect: "[::1]:5432", User: "cagent"},
+			dsn:    `host='::1' port='5432' user='cagent' connect_timeout='0' application_name='cagent'`,
+		},
+		{
+			name:   "unix socket",
+			config: Config{Connect: "/var/run/postgresql", User: "cagent"},
+			dsn:    `host='/var/run/postgresql' port='5432' user='cagent' connect_timeout='0' application_name='cagent'`,
+		},
+		{
+			name:    "no user",
+			config:  Config{Connect: "127.0.0.1"},
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn, err := (&Postgresql{config: &tt.config}).dataSourceName()
+			if tt.invalid {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.dsn, dsn)
+		})
+	}
+}
+
+func TestFillResultsPerSecond(t *testing.T) {
+	old := &Status{Commits: 100, Rollbacks: 10, Inserted: 50, BlocksRead: 10, BlocksHit: 90, Deadlocks: 1}
+	new := &Status{Commits: 300, Rollbacks: 30, Inserted: 150, BlocksRead: 20, BlocksHit: 480, Deadlocks: 3}
+
+	result := make(map[string]interface{})
+	fillResultsPerSecond(new, old, 10*time.Second, result)
+
+	assert.Equal(t, 22.0, result["Transactions per sec"])
+	assert.Equal(t, 20.0, result["Commits per sec"])
+	assert.Equal(t, 10.0, result["Rows inserted per sec"])
+	assert.Equal(t, int64(2), result["Deadlocks"])
+	assert.Equal(t, 97.5, result["Cache hit ratio percent"])
+
+	// the counters were reset
+	fillResultsPerSecond(old, new, 10*time.Second, result)
+	assert.Equal(t, 0.0, result["Transactions per sec"])
+	assert.Equal(t, int64(0), result["Deadlocks"])
+	assert.Nil(t, result["Cache hit ratio percent"])
+}
@@ -0,0 +1,226 @@
+package postgresql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	// import postgres driver to inject into database/sql
+	_ "github.com/lib/pq"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+)
+
+// Status contains the counters of pg_stat_database summed up over all databases
+type Status struct {
+	Commits    int64
+	Rollbacks  int64
+	Returned   int64
+	Fetched    int64
+	Inserted   int64
+	Updated    int64
+	Deleted    int64
+	BlocksRead int64
+	BlocksHit  int64
+	Deadlocks  int64
+}
+
+func (s *Status) Transactions() int64 {
+	// pg_stat_database doesn't count the queries, every statement outside of a transaction block is a transaction
+	return s.Commits + s.Rollbacks
+}
+
+type Replica struct {
+	Name      string   `json:"name"`
+	Address   string   `json:"address"`
+	State     string   `json:"state"`
+	ReplayLag *float64 `json:"replay_lag_sec"`
+}
+
+const (
+	receiverStatusStreaming = "streaming"
+	// receiverStatusStopped is reported if the WAL receiver isn't running
+	receiverStatusStopped = "stopped"
+	// receiverStatusUnknown is reported if the user isn't allowed to see the status, e.g. without the pg_monitor role
+	receiverStatusUnknown = "unknown"
+)
+
+type Replication struct {
+	IsReplica bool
+	// ReceiverStatus is the status of the WAL receiver on a replica
+	ReceiverStatus string
+	// ReplayLag is the time since the last replayed transaction on a replica, nil if nothing was replayed yet
+	ReplayLag *float64
+	// Replicas are the standby servers connected to the primary
+	Replicas []Replica
+}
+
+func getStatus(ctx context.Context, db *sql.DB) (*Status, error) {
+	row := db.QueryRowContext(ctx, `SELECT
+COALESCE(sum(xact_commit), 0), COALESCE(sum(xact_rollback), 0),
+COALESCE(sum(tup_returned), 0), COALESCE(sum(tup_fetched), 0),
+COALESCE(sum(tup_inserted), 0), COALESCE(sum(tup_updated), 0), COALESCE(sum(tup_deleted), 0),
+COALESCE(sum(blks_read), 0), COALESCE(sum(blks_hit), 0), COALESCE(sum(deadlocks), 0)
+FROM pg_stat_database`)
+
+	var total Status
+	err := row.Scan(
+		&total.Commits, &total.Rollbacks,
+		&total.Returned, &total.Fetched,
+		&total.Inserted, &total.Updated, &total.Deleted,
+		&total.BlocksRead, &total.BlocksHit, &total.Deadlocks,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &total, nil
+}
+
+// getConnections counts the client connections only, the background processes don't count against max_connections
+func getConnections(ctx context.Context, db *sql.DB) (connections int64, maxConnections int64, err error) {
+	err = db.QueryRowContext(ctx, `SELECT count(*), current_setting('max_connections')::bigint
+FROM pg_stat_activity WHERE backend_type = 'client backend'`).Scan(&connections, &maxConnections)
+	return
+}
+
+func getReplication(ctx context.Context, db *sql.DB) (*Replication, error) {
+	var res Replication
+	err := db.QueryRowContext(ctx, `SELECT pg_is_in_recovery()`).Scan(&res.IsReplica)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.IsReplica {
+		var status sql.NullString
+		err = db.QueryRowContext(ctx, `SELECT status FROM pg_stat_wal_receiver`).Scan(&status)
+		switch {
+		case err == sql.ErrNoRows:
+			res.ReceiverStatus = receiverStatusStopped
+		case err != nil:
+			return nil, err
+		case !status.Valid:
+			res.ReceiverStatus = receiverStatusUnknown
+		default:
+			res.ReceiverStatus = status.String
+		}
+
+		// a streaming replica which replayed everything it received is not lagging even if the primary is idle.
+		// Without the WAL receiver nothing is received, the lag grows with the time since the last replayed transaction
+		lagQuery := `SELECT EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())`
+		if res.ReceiverStatus == receiverStatusStreaming {
+			lagQuery = `SELECT CASE
+WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())
+END`
+		}
+
+		var lag sql.NullFloat64
+		if err = db.QueryRowContext(ctx, lagQuery).Scan(&lag); err != nil {
+			return nil, err
+		}
+		if lag.Valid {
+			res.ReplayLag = &lag.Float64
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT application_name, COALESCE(host(client_addr), ''), COALESCE(state, ''), EXTRACT(EPOCH FROM replay_lag)
+FROM pg_stat_replication ORDER BY application_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res.Replicas = []Replica{}
+	for rows.Next() {
+		var replica Replica
+		var lag sql.NullFloat64
+		err = rows.Scan(&replica.Name, &replica.Address, &replica.State, &lag)
+		if err != nil {
+			return nil, err
+		}
+		if lag.Valid {
+			replica.ReplayLag = &lag.Float64
+		}
+		res.Replicas = append(res.Replicas, replica)
+	}
+
+	return &res, rows.Err()
+}
+
+// getLongTransactions returns the number of transactions running longer than the threshold and the duration of the longest one
+func getLongTransactions(ctx context.Context, db *sql.DB, thresholdSec float64) (count int64, longestSec float64, err error) {
+	err = db.QueryRowContext(ctx, `SELECT
+count(*) FILTER (WHERE now() - xact_start > $1 * interval '1 second'),
+COALESCE(EXTRACT(EPOCH FROM max(now() - xact_start)), 0)
+FROM pg_stat_activity WHERE xact_start IS NOT NULL AND pid <> pg_backend_pid()`, thresholdSec).Scan(&count, &longestSec)
+	longestSec = common.RoundToTwoDecimalPlaces(longestSec)
+	return
+}
+
+func getDatabaseSizes(ctx context.Context, db *sql.DB) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	rows, err := db.QueryContext(ctx, `SELECT datname, pg_database_size(datname) FROM pg_database WHERE datallowconn AND NOT datistemplate`)
+	if err != nil {
+		return sizes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var size int64
+		if err = rows.Scan(&name, &size); err != nil {
+			log.Error(err.Error())
+			continue
+		}
+		sizes[name] = size
+	}
+
+	return sizes, rows.Err()
+}
+
+func fillResultsPerSecond(new *Status, old *Status, durationBetween time.Duration, result map[string]interface{}) {
+	sec := durationBetween.Seconds()
+	result["Transactions per sec"] = common.FormatPerSec(new.Transactions(), old.Transactions(), sec)
+	result["Commits per sec"] = common.FormatPerSec(new.Commits, old.Commits, sec)
+	result["Rollbacks per sec"] = common.FormatPerSec(new.Rollbacks, old.Rollbacks, sec)
+	result["Rows returned per sec"] = common.FormatPerSec(new.Returned, old.Returned, sec)
+	result["Rows fetched per sec"] = common.FormatPerSec(new.Fetched, old.Fetched, sec)
+	result["Rows inserted per sec"] = common.FormatPerSec(new.Inserted, old.Inserted, sec)
+	result["Rows updated per sec"] = common.FormatPerSec(new.Updated, old.Updated, sec)
+	result["Rows deleted per sec"] = common.FormatPerSec(new.Deleted, old.Deleted, sec)
+	result["Deadlocks"] = formatDelta(new.Deadlocks, old.Deadlocks)
+
+	hits := formatDelta(new.BlocksHit, old.BlocksHit)
+	reads := formatDelta(new.BlocksRead, old.BlocksRead)
+	if hits+reads > 0 {
+		result["Cache hit ratio percent"] = common.RoundToTwoDecimalPlaces(float64(hits) / float64(hits+reads) * 100)
+	} else {
+		result["Cache hit ratio percent"] = nil
+	}
+}
+
+func fillEmptyResultsPerSecond(result map[string]interface{}) {
+	for _, key := range []string{
+		"Transactions per sec",
+		"Commits per sec",
+		"Rollbacks per sec",
+		"Rows returned per sec",
+		"Rows fetched per sec",
+		"Rows inserted per sec",
+		"Rows updated per sec",
+		"Rows deleted per sec",
+		"Deadlocks",
+		"Cache hit ratio percent",
+	} {
+		result[key] = nil
+	}
+}
+
+// formatDelta returns the increase of a counter, the counters are reset by pg_stat_reset()
+func formatDelta(new int64, old int64) int64 {
+	if new < old {
+		return 0
+	}
+	return new - old
+}
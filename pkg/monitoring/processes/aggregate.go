@@ -0,0 +1,89 @@
+package processes
+
+import (
+	"sort"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+)
+
+const (
+	AggregateByName      = "name"
+	AggregateByUser      = "user"
+	AggregateByContainer = "container"
+	AggregateByUnit      = "unit"
+)
+
+// UsageGroup is the summed resource usage of the processes sharing the same key
+type UsageGroup struct {
+	Key                string  `json:"key"`
+	Processes          int     `json:"processes"`
+	CPUUsagePercent    float32 `json:"cpu_usage_percent"`
+	RSS                uint64  `json:"rss"`
+	MemoryUsagePercent float32 `json:"memory_usage_percent"`
+}
+
+// aggregateKey returns the key of the process to group by. Processes with an empty key are not aggregated
+func aggregateKey(p *ProcStat, aggregateBy string) string {
+	switch aggregateBy {
+	case AggregateByName:
+		return p.Name
+	case AggregateByUser:
+		if p.UID < 0 {
+			return ""
+		}
+		return userNameByID(p.UID)
+	case AggregateByContainer:
+		return p.Container
+	case AggregateByUnit:
+		return p.Unit
+	}
+	return ""
+}
+
+// aggregate sums the usage of all processes by each of the keys. The groups are sorted by the CPU usage descending
+func aggregate(procs []*ProcStat, cfg *Config) common.MeasurementsMap {
+	result := common.MeasurementsMap{}
+	for _, aggregateBy := range cfg.AggregateBy {
+		groups := make(map[string]*UsageGroup)
+		for _, p := range procs {
+			if !cfg.EnableKernelTaskMonitoring && isKernelTask(p) {
+				continue
+			}
+
+			key := aggregateKey(p, aggregateBy)
+			if key == "" {
+				continue
+			}
+
+			g, exists := groups[key]
+			if !exists {
+				g = &UsageGroup{Key: key}
+				groups[key] = g
+			}
+			g.Processes++
+			g.CPUUsagePercent += p.CPUAverageUsagePercent
+			g.RSS += p.RSS
+			g.MemoryUsagePercent += p.MemoryUsagePercent
+		}
+
+		list := make([]*UsageGroup, 0, len(groups))
+		for _, g := range groups {
+			g.CPUUsagePercent = float32(common.RoundToTwoDecimalPlaces(float64(g.CPUUsagePercent)))
+			g.MemoryUsagePercent = float32(common.RoundToTwoDecimalPlaces(float64(g.MemoryUsagePercent)))
+			list = append(list, g)
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].CPUUsagePercent != list[j].CPUUsagePercent {
+				return list[i].CPUUsagePercent > list[j].CPUUsagePercent
+			}
+			if list[i].RSS != list[j].RSS {
+				return list[i].RSS > list[j].RSS
+			}
+			return list[i].Key < list[j].Key
+		})
+
+		result["by_"+aggregateBy] = list
+	}
+
+	return result
+}
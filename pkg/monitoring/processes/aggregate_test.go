@@ -0,0 +1,53 @@
+package processes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregate(t *testing.T) {
+	procs := []*ProcStat{
+		{PID: 1, ParentPID: 0, ProcessGID: 1, UID: -1, Name: "systemd", Unit: "init.scope", CPUAverageUsagePercent: 0.1, RSS: 10, MemoryUsagePercent: 0.1},
+		{PID: 2, ParentPID: 0, ProcessGID: 0, UID: -1, Name: "kthreadd", Unit: "/"},
+		{PID: 10, ParentPID: 1, ProcessGID: 10, UID: -1, Name: "php-fpm", Unit: "php-fpm.service", CPUAverageUsagePercent: 10.5, RSS: 100, MemoryUsagePercent: 1.25},
+		{PID: 11, ParentPID: 10, ProcessGID: 10, UID: -1, Name: "php-fpm", Unit: "php-fpm.service", CPUAverageUsagePercent: 20.25, RSS: 200, MemoryUsagePercent: 2.5},
+		{PID: 20, ParentPID: 1, ProcessGID: 20, UID: -1, Name: "nginx", Container: "web", Unit: "docker-0123.scope", CPUAverageUsagePercent: 5, RSS: 50, MemoryUsagePercent: 0.5},
+	}
+
+	t.Run("all keys", func(t *testing.T) {
+		cfg := &Config{AggregateBy: []string{AggregateByName, AggregateByUser, AggregateByContainer, AggregateByUnit}, EnableKernelTaskMonitoring: true}
+		m := aggregate(procs, cfg)
+
+		assert.Equal(t, []*UsageGroup{
+			{Key: "php-fpm", Processes: 2, CPUUsagePercent: 30.75, RSS: 300, MemoryUsagePercent: 3.75},
+			{Key: "nginx", Processes: 1, CPUUsagePercent: 5, RSS: 50, MemoryUsagePercent: 0.5},
+			{Key: "systemd", Processes: 1, CPUUsagePercent: 0.1, RSS: 10, MemoryUsagePercent: 0.1},
+			{Key: "kthreadd", Processes: 1},
+		}, m["by_name"])
+		assert.Equal(t, []*UsageGroup{}, m["by_user"], "processes with an unknown user are skipped")
+		assert.Equal(t, []*UsageGroup{
+			{Key: "web", Processes: 1, CPUUsagePercent: 5, RSS: 50, MemoryUsagePercent: 0.5},
+		}, m["by_container"])
+		assert.Len(t, m["by_unit"], 4)
+	})
+
+	t.Run("without kernel tasks", func(t *testing.T) {
+		cfg := &Config{AggregateBy: []string{AggregateByUnit}}
+		m := aggregate(procs, cfg)
+
+		assert.Equal(t, []*UsageGroup{
+			{Key: "php-fpm.service", Processes: 2, CPUUsagePercent: 30.75, RSS: 300, MemoryUsagePercent: 3.75},
+			{Key: "docker-0123.scope", Processes: 1, CPUUsagePercent: 5, RSS: 50, MemoryUsagePercent: 0.5},
+		}, m["by_unit"])
+		assert.NotContains(t, m, "by_name")
+	})
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := GetDefaultConfig()
+	assert.NoError(t, cfg.Validate())
+
+	cfg.AggregateBy = []string{"name", "pid"}
+	assert.Error(t, cfg.Validate())
+}
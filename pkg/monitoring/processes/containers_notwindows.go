@@ -0,0 +1,354 @@
+// +build !windows
+
+package processes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/docker"
+)
+
+const (
+	RuntimeDocker        = "docker"
+	RuntimePodman        = "podman"
+	RuntimeContainerd    = "containerd"
+	RuntimeCRIO          = "cri-o"
+	RuntimeKubernetes    = "kubernetes"
+	RuntimeSystemdNspawn = "systemd-nspawn"
+
+	containerNameCacheTTL       = 10 * time.Minute
+	containerNameFailedCacheTTL = time.Minute
+	shortContainerIDLength      = 12
+)
+
+var (
+	// cgroup v2 and systemd cgroup driver: /system.slice/docker-<id>.scope, /machine.slice/libpod-<id>.scope, ...
+	containerScopeRE = regexp.MustCompile(`^(docker|libpod|cri-containerd|crio)-([a-f0-9]{64})(?:\.scope)?$`)
+	containerIDRE    = regexp.MustCompile(`^[a-f0-9]{64}$`)
+	nspawnServiceRE  = regexp.MustCompile(`^systemd-nspawn@(.+)\.service$`)
+	machineScopeRE   = regexp.MustCompile(`^machine-(.+)\.scope$`)
+
+	runtimeByScopePrefix = map[string]string{
+		"docker":         RuntimeDocker,
+		"libpod":         RuntimePodman,
+		"cri-containerd": RuntimeContainerd,
+		"crio":           RuntimeCRIO,
+	}
+
+	errContainerMetadataNotFound = errors.New("container metadata not found")
+)
+
+// containerRef identifies the container of a process parsed from its cgroup path
+type containerRef struct {
+	Runtime string
+	ID      string
+	// Name is only set when the cgroup path contains it, e.g. for systemd-nspawn machines
+	Name string
+}
+
+type cachedContainerName struct {
+	name      string
+	runtime   string
+	expiresAt time.Time
+}
+
+// the cache is shared with the PSI collector
+var (
+	containerNameCache   = make(map[string]cachedContainerName)
+	containerNameCacheMu sync.Mutex
+)
+
+// ContainerByCgroupPath returns the name and the runtime of the container the cgroup belongs to,
+// e.g. "/system.slice/docker-<id>.scope"
+func ContainerByCgroupPath(path string) (name, runtime string, ok bool) {
+	ref := containerFromCgroupPath(path)
+	if ref == nil {
+		return "", "", false
+	}
+
+	name, runtime = resolveContainer(ref)
+	return name, runtime, true
+}
+
+// parseContainerFromCgroup finds the container in the contents of /proc/<pid>/cgroup.
+// It returns nil if the process doesn't run inside of a container
+func parseContainerFromCgroup(cgroup []byte) *containerRef {
+	scanner := bufio.NewScanner(bytes.NewReader(cgroup))
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) < 3 {
+			continue
+		}
+
+		if ref := containerFromCgroupPath(parts[2]); ref != nil {
+			return ref
+		}
+	}
+
+	return nil
+}
+
+func containerFromCgroupPath(path string) *containerRef {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	// search from the deepest cgroup to handle nested containers, e.g. docker inside of a systemd-nspawn machine
+	for i := len(segments) - 1; i >= 0; i-- {
+		segment := segments[i]
+		parent := ""
+		if i > 0 {
+			parent = segments[i-1]
+		}
+
+		if reParts := containerScopeRE.FindStringSubmatch(segment); len(reParts) > 0 {
+			return &containerRef{Runtime: runtimeByScopePrefix[reParts[1]], ID: reParts[2]}
+		}
+
+		if containerIDRE.MatchString(segment) {
+			switch {
+			case parent == "docker":
+				// cgroupfs driver: /docker/<id>
+				return &containerRef{Runtime: RuntimeDocker, ID: segment}
+			case strings.HasPrefix(parent, "pod") && strings.Contains(path, "kubepods"):
+				// kubelet with the cgroupfs driver: /kubepods/burstable/pod<uid>/<id>, the runtime is unknown
+				return &containerRef{ID: segment}
+			}
+		}
+
+		if reParts := nspawnServiceRE.FindStringSubmatch(segment); len(reParts) > 0 {
+			return &containerRef{Runtime: RuntimeSystemdNspawn, Name: unescapeSystemdUnitName(reParts[1])}
+		}
+
+		if parent == "machine.slice" {
+			if reParts := machineScopeRE.FindStringSubmatch(segment); len(reParts) > 0 {
+				return &containerRef{Runtime: RuntimeSystemdNspawn, Name: unescapeSystemdUnitName(reParts[1])}
+			}
+		}
+	}
+
+	return nil
+}
+
+// unescapeSystemdUnitName reverts the \xNN escaping of systemd unit names, e.g. "my\x2dmachine" -> "my-machine"
+func unescapeSystemdUnitName(s string) string {
+	if !strings.Contains(s, `\x`) {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+			if c, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// resolveContainer returns the name and the runtime of the container.
+// Names are cached, if the name can't be resolved the short container ID is used instead
+func resolveContainer(ref *containerRef) (name, runtime string) {
+	if ref.Name != "" {
+		return ref.Name, ref.Runtime
+	}
+
+	cacheKey := ref.Runtime + "/" + ref.ID
+	now := time.Now()
+	containerNameCacheMu.Lock()
+	cached, exists := containerNameCache[cacheKey]
+	containerNameCacheMu.Unlock()
+	if exists && now.Before(cached.expiresAt) {
+		return cached.name, cached.runtime
+	}
+
+	name, runtime, err := lookupContainerName(ref)
+	ttl := containerNameCacheTTL
+	if err != nil {
+		switch err {
+		case errContainerMetadataNotFound, docker.ErrorNotImplementedForOS, docker.ErrorDockerNotAvailable, docker.ErrorDockerPermissionDenied:
+			// the missing permission is logged once by the docker package
+		default:
+			log.WithError(err).Errorf("failed to read %s container name by id(%s)", runtime, ref.ID)
+		}
+		name = ref.ID[:shortContainerIDLength]
+		ttl = containerNameFailedCacheTTL
+	}
+
+	containerNameCacheMu.Lock()
+	// remove the entries of the containers gone meanwhile
+	for key, cached := range containerNameCache {
+		if !now.Before(cached.expiresAt) {
+			delete(containerNameCache, key)
+		}
+	}
+	containerNameCache[cacheKey] = cachedContainerName{name: name, runtime: runtime, expiresAt: now.Add(ttl)}
+	containerNameCacheMu.Unlock()
+	return name, runtime
+}
+
+func lookupContainerName(ref *containerRef) (string, string, error) {
+	switch ref.Runtime {
+	case RuntimeDocker:
+		name, err := docker.ContainerNameByID(ref.ID)
+		return name, RuntimeDocker, err
+	case RuntimePodman:
+		name, err := podmanContainerName(ref.ID)
+		return name, RuntimePodman, err
+	case RuntimeContainerd:
+		name, err := containerdContainerName(ref.ID)
+		return name, RuntimeContainerd, err
+	case RuntimeCRIO:
+		name, err := crioContainerName(ref.ID)
+		return name, RuntimeCRIO, err
+	}
+
+	// kubernetes pod with the cgroupfs driver, try the runtimes one by one
+	if name, err := containerdContainerName(ref.ID); err == nil {
+		return name, RuntimeContainerd, nil
+	}
+	if name, err := crioContainerName(ref.ID); err == nil {
+		return name, RuntimeCRIO, nil
+	}
+	if name, err := docker.ContainerNameByID(ref.ID); err == nil {
+		return name, RuntimeDocker, nil
+	}
+
+	return "", RuntimeKubernetes, errContainerMetadataNotFound
+}
+
+// podmanContainerName looks up the container in the containers/storage metadata of rootful and rootless podman
+func podmanContainerName(id string) (string, error) {
+	patterns := []string{
+		common.HostRoot("var/lib/containers/storage/*-containers/containers.json"),
+		common.HostRoot("home/*/.local/share/containers/storage/*-containers/containers.json"),
+	}
+
+	for _, pattern := range patterns {
+		files, _ := filepath.Glob(pattern)
+		for _, f := range files {
+			data, err := ioutil.ReadFile(f)
+			if err != nil {
+				log.WithError(err).Debugf("failed to read %s", f)
+				continue
+			}
+
+			var containers []struct {
+				ID    string   `json:"id"`
+				Names []string `json:"names"`
+			}
+			if err := json.Unmarshal(data, &containers); err != nil {
+				log.WithError(err).Debugf("failed to parse %s", f)
+				continue
+			}
+
+			for _, c := range containers {
+				if c.ID == id && len(c.Names) > 0 {
+					return c.Names[0], nil
+				}
+			}
+		}
+	}
+
+	return "", errContainerMetadataNotFound
+}
+
+// containerdContainerName reads the OCI bundle of the container created by the containerd shim
+func containerdContainerName(id string) (string, error) {
+	annotations, err := readOCIAnnotations(common.HostRoot("run/containerd/io.containerd.runtime.v2.task/*", id, "config.json"))
+	if err != nil {
+		return "", err
+	}
+
+	if name := kubernetesContainerName(
+		annotations["io.kubernetes.cri.sandbox-namespace"],
+		annotations["io.kubernetes.cri.sandbox-name"],
+		annotations["io.kubernetes.cri.container-name"],
+	); name != "" {
+		return name, nil
+	}
+
+	// containers created by nerdctl
+	if name := annotations["nerdctl/name"]; name != "" {
+		return name, nil
+	}
+
+	return "", errContainerMetadataNotFound
+}
+
+// crioContainerName reads the OCI bundle of the container created by CRI-O
+func crioContainerName(id string) (string, error) {
+	annotations, err := readOCIAnnotations(common.HostRoot("run/containers/storage/*-containers", id, "userdata/config.json"))
+	if err != nil {
+		return "", err
+	}
+
+	containerName := annotations["io.kubernetes.container.name"]
+	if containerName == "POD" {
+		// the infra container of the pod
+		containerName = ""
+	}
+
+	if name := kubernetesContainerName(
+		annotations["io.kubernetes.pod.namespace"],
+		annotations["io.kubernetes.pod.name"],
+		containerName,
+	); name != "" {
+		return name, nil
+	}
+
+	return "", errContainerMetadataNotFound
+}
+
+func readOCIAnnotations(pattern string) (map[string]string, error) {
+	files, _ := filepath.Glob(pattern)
+	if len(files) == 0 {
+		return nil, errContainerMetadataNotFound
+	}
+
+	data, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		return nil, err
+	}
+
+	var spec struct {
+		Annotations map[string]string `json:"annotations"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+
+	return spec.Annotations, nil
+}
+
+// kubernetesContainerName returns the name in the <namespace>/<pod>/<container> format.
+// The container is empty for the sandbox(pause) container of the pod
+func kubernetesContainerName(namespace, pod, container string) string {
+	if pod == "" {
+		return ""
+	}
+
+	parts := []string{pod}
+	if namespace != "" {
+		parts = append([]string{namespace}, parts...)
+	}
+	if container != "" {
+		parts = append(parts, container)
+	}
+
+	return strings.Join(parts, "/")
+}
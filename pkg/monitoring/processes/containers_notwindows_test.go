@@ -0,0 +1,177 @@
+// +build !windows
+
+package processes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testContainerID = strings.Repeat("0123456789abcdef", 4)
+
+func TestParseContainerFromCgroup(t *testing.T) {
+	tests := []struct {
+		name     string
+		cgroup   string
+		expected *containerRef
+	}{
+		{
+			name:     "docker cgroupfs",
+			cgroup:   "12:memory:/docker/" + testContainerID + "\n1:name=systemd:/docker/" + testContainerID + "\n",
+			expected: &containerRef{Runtime: RuntimeDocker, ID: testContainerID},
+		},
+		{
+			name:     "docker cgroup v2",
+			cgroup:   "0::/system.slice/docker-" + testContainerID + ".scope\n",
+			expected: &containerRef{Runtime: RuntimeDocker, ID: testContainerID},
+		},
+		{
+			name:     "podman",
+			cgroup:   "0::/machine.slice/libpod-" + testContainerID + ".scope/container\n",
+			expected: &containerRef{Runtime: RuntimePodman, ID: testContainerID},
+		},
+		{
+			name:     "podman rootless",
+			cgroup:   "0::/user.slice/user-1000.slice/user@1000.service/user.slice/libpod-" + testContainerID + ".scope\n",
+			expected: &containerRef{Runtime: RuntimePodman, ID: testContainerID},
+		},
+		{
+			name:     "podman conmon",
+			cgroup:   "0::/machine.slice/libpod-conmon-" + testContainerID + ".scope\n",
+			expected: nil,
+		},
+		{
+			name:     "kubernetes containerd systemd driver",
+			cgroup:   "0::/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1b2c.slice/cri-containerd-" + testContainerID + ".scope\n",
+			expected: &containerRef{Runtime: RuntimeContainerd, ID: testContainerID},
+		},
+		{
+			name:     "kubernetes cri-o",
+			cgroup:   "0::/kubepods.slice/kubepods-pod1b2c.slice/crio-" + testContainerID + ".scope\n",
+			expected: &containerRef{Runtime: RuntimeCRIO, ID: testContainerID},
+		},
+		{
+			name:     "kubernetes cgroupfs driver",
+			cgroup:   "0::/kubepods/besteffort/pod1b2c-3d4e/" + testContainerID + "\n",
+			expected: &containerRef{ID: testContainerID},
+		},
+		{
+			name:     "systemd-nspawn machine",
+			cgroup:   "0::/machine.slice/machine-web\\x2d1.scope/payload/system.slice/nginx.service\n",
+			expected: &containerRef{Runtime: RuntimeSystemdNspawn, Name: "web-1"},
+		},
+		{
+			name:     "systemd-nspawn service",
+			cgroup:   "0::/machine.slice/systemd-nspawn@db.service/payload\n",
+			expected: &containerRef{Runtime: RuntimeSystemdNspawn, Name: "db"},
+		},
+		{
+			name:     "docker inside of a machine",
+			cgroup:   "0::/machine.slice/machine-web.scope/payload/system.slice/docker-" + testContainerID + ".scope\n",
+			expected: &containerRef{Runtime: RuntimeDocker, ID: testContainerID},
+		},
+		{
+			name:     "host process",
+			cgroup:   "0::/system.slice/sshd.service\n",
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, parseContainerFromCgroup([]byte(tt.cgroup)))
+		})
+	}
+}
+
+func TestParseUnitFromCgroup(t *testing.T) {
+	tests := []struct {
+		cgroup   string
+		expected string
+	}{
+		{"0::/system.slice/nginx.service\n", "nginx.service"},
+		{"0::/user.slice/user-1000.slice/user@1000.service/app.slice/app-gnome\\x2dterminal.scope\n", "app-gnome-terminal.scope"},
+		{"12:memory:/system.slice/cron.service\n1:name=systemd:/system.slice/cron.service\n0::/\n", "cron.service"},
+		{"0::/machine.slice/libpod-" + testContainerID + ".scope/container\n", "libpod-" + testContainerID + ".scope"},
+		{"0::/kubepods/besteffort/pod1b2c/" + testContainerID + "\n", "/kubepods/besteffort/pod1b2c/" + testContainerID},
+		{"0::/\n", "/"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, parseUnitFromCgroup([]byte(tt.cgroup)), tt.cgroup)
+	}
+}
+
+func TestResolveContainer(t *testing.T) {
+	root, err := ioutil.TempDir("", "hostroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	os.Setenv("HOST_ROOT", root)
+	defer os.Unsetenv("HOST_ROOT")
+	defer func() { containerNameCache = make(map[string]cachedContainerName) }()
+
+	writeFile := func(path, content string) {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	podmanID := strings.Repeat("a", 64)
+	writeFile("var/lib/containers/storage/overlay-containers/containers.json",
+		`[{"id":"`+podmanID+`","names":["web"],"image":"b1c2"}]`)
+
+	containerdID := strings.Repeat("b", 64)
+	writeFile("run/containerd/io.containerd.runtime.v2.task/k8s.io/"+containerdID+"/config.json",
+		`{"ociVersion":"1.0.2","annotations":{"io.kubernetes.cri.container-name":"app","io.kubernetes.cri.sandbox-name":"app-5d8f","io.kubernetes.cri.sandbox-namespace":"default"}}`)
+
+	crioID := strings.Repeat("c", 64)
+	writeFile("run/containers/storage/overlay-containers/"+crioID+"/userdata/config.json",
+		`{"annotations":{"io.kubernetes.container.name":"POD","io.kubernetes.pod.name":"dns-7c6d","io.kubernetes.pod.namespace":"kube-system"}}`)
+
+	tests := []struct {
+		name            string
+		ref             *containerRef
+		expectedName    string
+		expectedRuntime string
+	}{
+		{"podman", &containerRef{Runtime: RuntimePodman, ID: podmanID}, "web", RuntimePodman},
+		{"containerd", &containerRef{Runtime: RuntimeContainerd, ID: containerdID}, "default/app-5d8f/app", RuntimeContainerd},
+		{"cri-o pod sandbox", &containerRef{Runtime: RuntimeCRIO, ID: crioID}, "kube-system/dns-7c6d", RuntimeCRIO},
+		{"kubernetes cgroupfs", &containerRef{ID: containerdID}, "default/app-5d8f/app", RuntimeContainerd},
+		{"unknown", &containerRef{Runtime: RuntimePodman, ID: testContainerID}, "0123456789ab", RuntimePodman},
+		{"nspawn", &containerRef{Runtime: RuntimeSystemdNspawn, Name: "db"}, "db", RuntimeSystemdNspawn},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, runtime := resolveContainer(tt.ref)
+			assert.Equal(t, tt.expectedName, name)
+			assert.Equal(t, tt.expectedRuntime, runtime)
+		})
+	}
+
+	// names are served from the cache
+	writeFile("var/lib/containers/storage/overlay-containers/containers.json", `[]`)
+	name, _ := resolveContainer(&containerRef{Runtime: RuntimePodman, ID: podmanID})
+	assert.Equal(t, "web", name)
+
+	// expired entries are removed when a new one is added
+	containerNameCache["podman/removed"] = cachedContainerName{name: "removed", expiresAt: time.Now().Add(-time.Second)}
+	resolveContainer(&containerRef{Runtime: RuntimePodman, ID: strings.Repeat("d", 64)})
+	assert.NotContains(t, containerNameCache, "podman/removed")
+	assert.Contains(t, containerNameCache, RuntimePodman+"/"+podmanID)
+}
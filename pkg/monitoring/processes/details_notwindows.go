@@ -0,0 +1,228 @@
+// +build !windows
+
+package processes
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+)
+
+// clockTicks is USER_HZ used by the kernel for the times in /proc/<pid>/stat. It is 100 on all supported architectures
+const clockTicks = 100
+
+// procCounters keeps the cumulative counters of the process from the previous run to calculate the rates
+type procCounters struct {
+	startTicks uint64
+	at         time.Time
+
+	hasIO      bool
+	readBytes  uint64
+	writeBytes uint64
+
+	voluntaryCtxSwitches    uint64
+	nonvoluntaryCtxSwitches uint64
+}
+
+var (
+	procCountersCache = make(map[int]procCounters)
+	userNameCache     = make(map[int]string)
+	bootTime          uint64
+)
+
+// gatherProcessDetails fills the optional fields of the process enabled in the config
+func gatherProcessDetails(stat *ProcStat, status procStatus, cfg *Config, now time.Time, updatedCountersCache map[int]procCounters) {
+	pidPath := common.HostProc(strconv.Itoa(stat.PID))
+
+	if cfg.ReportUser && stat.UID >= 0 {
+		stat.User = userNameByID(stat.UID)
+	}
+
+	if cfg.ReportThreads {
+		stat.Threads = status.Threads
+	}
+
+	if cfg.ReportStartTime && stat.StartTicks > 0 {
+		if bt := getBootTime(); bt > 0 {
+			startTime := bt + stat.StartTicks/clockTicks
+			stat.StartTime = int64(startTime)
+
+			var age uint64
+			if nowUnix := uint64(now.Unix()); nowUnix > startTime {
+				age = nowUnix - startTime
+			}
+			stat.AgeSeconds = &age
+		}
+	}
+
+	if cfg.ReportOpenFiles {
+		gatherOpenFiles(stat, pidPath)
+	}
+
+	if !cfg.ReportIO && !cfg.ReportContextSwitches {
+		return
+	}
+
+	counters := procCounters{
+		startTicks:              stat.StartTicks,
+		at:                      now,
+		voluntaryCtxSwitches:    status.VoluntaryCtxSwitches,
+		nonvoluntaryCtxSwitches: status.NonvoluntaryCtxSwitches,
+	}
+	if cfg.ReportIO {
+		counters.readBytes, counters.writeBytes, counters.hasIO = readProcIO(pidPath)
+	}
+	updatedCountersCache[stat.PID] = counters
+
+	prev, exists := procCountersCache[stat.PID]
+	// the PID may be reused by a new process
+	if !exists || prev.startTicks != counters.startTicks {
+		return
+	}
+	elapsed := now.Sub(prev.at).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	if cfg.ReportIO && counters.hasIO && prev.hasIO {
+		stat.ReadBytesPerSecond = ratePerSecond(prev.readBytes, counters.readBytes, elapsed)
+		stat.WriteBytesPerSecond = ratePerSecond(prev.writeBytes, counters.writeBytes, elapsed)
+	}
+
+	if cfg.ReportContextSwitches {
+		stat.VoluntaryContextSwitchesPerSecond = ratePerSecond(prev.voluntaryCtxSwitches, counters.voluntaryCtxSwitches, elapsed)
+		stat.InvoluntaryContextSwitchesPerSecond = ratePerSecond(prev.nonvoluntaryCtxSwitches, counters.nonvoluntaryCtxSwitches, elapsed)
+	}
+}
+
+func ratePerSecond(prev, current uint64, elapsedSeconds float64) *float64 {
+	if current < prev {
+		return nil
+	}
+	rate := common.RoundToTwoDecimalPlaces(float64(current-prev) / elapsedSeconds)
+	return &rate
+}
+
+func userNameByID(uid int) string {
+	if name, exists := userNameCache[uid]; exists {
+		return name
+	}
+
+	name := strconv.Itoa(uid)
+	if u, err := user.LookupId(name); err == nil {
+		name = u.Username
+	} else {
+		log.WithError(err).Debugf("failed to lookup user %d", uid)
+	}
+
+	userNameCache[uid] = name
+	return name
+}
+
+// getBootTime returns the boot time as a unix timestamp from the btime line of /proc/stat
+func getBootTime() uint64 {
+	if bootTime > 0 {
+		return bootTime
+	}
+
+	lines, err := common.ReadLines(common.HostProc("stat"))
+	if err != nil {
+		log.WithError(err).Error("failed to read the boot time")
+		return 0
+	}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "btime" {
+			bootTime, _ = strconv.ParseUint(fields[1], 10, 64)
+			break
+		}
+	}
+
+	return bootTime
+}
+
+func gatherOpenFiles(stat *ProcStat, pidPath string) {
+	fdDir, err := os.Open(pidPath + "/fd")
+	if err != nil {
+		// processes of other users are not readable without root privileges
+		log.WithError(err).Debugf("failed to open the fd dir of process %d", stat.PID)
+		return
+	}
+	fds, err := fdDir.Readdirnames(-1)
+	fdDir.Close()
+	if err != nil {
+		log.WithError(err).Debugf("failed to list the fd dir of process %d", stat.PID)
+		return
+	}
+
+	openFiles := len(fds)
+	stat.OpenFiles = &openFiles
+
+	limits, err := readProcFile(pidPath + "/limits")
+	if err != nil {
+		if err != errorProcessTerminated {
+			log.WithError(err).Debugf("failed to read the limits of process %d", stat.PID)
+		}
+		return
+	}
+
+	stat.OpenFilesLimit = parseOpenFilesSoftLimit(limits)
+	if stat.OpenFilesLimit > 0 {
+		usage := float32(common.RoundToTwoDecimalPlaces(float64(openFiles) / float64(stat.OpenFilesLimit) * 100))
+		stat.OpenFilesUsagePercent = &usage
+	}
+}
+
+// parseOpenFilesSoftLimit returns the soft limit from /proc/<pid>/limits, 0 means unlimited
+func parseOpenFilesSoftLimit(b []byte) uint64 {
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Max open files") {
+			continue
+		}
+
+		// Limit  Soft Limit  Hard Limit  Units
+		fields := strings.Fields(strings.TrimPrefix(line, "Max open files"))
+		if len(fields) == 0 {
+			return 0
+		}
+		limit, _ := strconv.ParseUint(fields[0], 10, 64)
+		return limit
+	}
+
+	return 0
+}
+
+// readProcIO returns the bytes read from and written to the storage layer from /proc/<pid>/io
+func readProcIO(pidPath string) (readBytes, writeBytes uint64, ok bool) {
+	b, err := readProcFile(pidPath + "/io")
+	if err != nil {
+		// processes of other users are not readable without root privileges
+		return 0, 0, false
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		switch fields[0] {
+		case "read_bytes:":
+			readBytes, _ = strconv.ParseUint(fields[1], 10, 64)
+		case "write_bytes:":
+			writeBytes, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+
+	return readBytes, writeBytes, true
+}
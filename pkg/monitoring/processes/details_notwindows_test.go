@@ -0,0 +1,134 @@
+// +build !windows
+
+package processes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testStatusFile = `Name:	nginx
+Umask:	0022
+State:	S (sleeping)
+Tgid:	1234
+Ngid:	0
+Pid:	1234
+PPid:	1
+TracerPid:	0
+Uid:	0	0	0	0
+Gid:	0	0	0	0
+Threads:	4
+voluntary_ctxt_switches:	150
+nonvoluntary_ctxt_switches:	20
+`
+
+const testLimitsFile = `Limit                     Soft Limit           Hard Limit           Units
+Max cpu time              unlimited            unlimited            seconds
+Max open files            1024                 524288               files
+Max locked memory         65536                65536                bytes
+`
+
+func TestParseProcStatusFile(t *testing.T) {
+	t.Run("required fields only", func(t *testing.T) {
+		status := parseProcStatusFile([]byte(testStatusFile), false)
+		assert.Equal(t, procStatus{PPID: 1, State: "sleeping", UID: 0}, status)
+	})
+
+	t.Run("all fields", func(t *testing.T) {
+		status := parseProcStatusFile([]byte(testStatusFile), true)
+		assert.Equal(t, procStatus{PPID: 1, State: "sleeping", UID: 0, Threads: 4, VoluntaryCtxSwitches: 150, NonvoluntaryCtxSwitches: 20}, status)
+	})
+}
+
+func TestParseStartTicksFromStatFile(t *testing.T) {
+	// starttime is the 22nd field
+	statFile := []byte("1234 (nginx) S 1 1234 1234 0 -1 4194560 0 0 0 0 0 0 0 0 20 0 4 0 1000 0 0")
+	assert.Equal(t, uint64(1000), parseStartTicksFromStatFile(statFile))
+}
+
+func TestParseOpenFilesSoftLimit(t *testing.T) {
+	assert.Equal(t, uint64(1024), parseOpenFilesSoftLimit([]byte(testLimitsFile)))
+	assert.Equal(t, uint64(0), parseOpenFilesSoftLimit([]byte("Max open files            unlimited            unlimited            files\n")))
+}
+
+func TestGatherProcessDetails(t *testing.T) {
+	procDir, err := ioutil.TempDir("", "proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(procDir)
+
+	os.Setenv("HOST_PROC", procDir)
+	defer os.Unsetenv("HOST_PROC")
+	defer func() {
+		procCountersCache = make(map[int]procCounters)
+		bootTime = 0
+	}()
+
+	writeFile := func(path, content string) {
+		path = filepath.Join(procDir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile("stat", "cpu  1 2 3 4\nbtime 1600000000\n")
+	writeFile("1234/limits", testLimitsFile)
+	writeFile("1234/io", "rchar: 100\nwchar: 200\nread_bytes: 4096\nwrite_bytes: 8192\n")
+	for _, fd := range []string{"0", "1", "2"} {
+		writeFile("1234/fd/"+fd, "")
+	}
+
+	status := parseProcStatusFile([]byte(testStatusFile), true)
+	cfg := &Config{ReportUser: true, ReportStartTime: true, ReportThreads: true, ReportOpenFiles: true, ReportIO: true, ReportContextSwitches: true}
+	now := time.Unix(1600000110, 0)
+
+	// 1000 ticks = 10s after the boot
+	stat := &ProcStat{PID: 1234, UID: 0, StartTicks: 1000}
+	updatedCounters := make(map[int]procCounters)
+	gatherProcessDetails(stat, status, cfg, now, updatedCounters)
+
+	assert.Equal(t, "root", stat.User)
+	assert.Equal(t, int64(1600000010), stat.StartTime)
+	assert.Equal(t, uint64(100), *stat.AgeSeconds)
+	assert.Equal(t, 4, stat.Threads)
+	assert.Equal(t, 3, *stat.OpenFiles)
+	assert.Equal(t, uint64(1024), stat.OpenFilesLimit)
+	assert.Equal(t, float32(0.29), *stat.OpenFilesUsagePercent)
+	assert.Nil(t, stat.ReadBytesPerSecond, "rates need the previous values")
+	assert.Nil(t, stat.VoluntaryContextSwitchesPerSecond, "rates need the previous values")
+
+	procCountersCache = updatedCounters
+	writeFile("1234/io", "read_bytes: 24576\nwrite_bytes: 8192\n")
+	status.VoluntaryCtxSwitches += 300
+	status.NonvoluntaryCtxSwitches += 10
+
+	stat = &ProcStat{PID: 1234, StartTicks: 1000}
+	gatherProcessDetails(stat, status, cfg, now.Add(10*time.Second), make(map[int]procCounters))
+
+	assert.Equal(t, 2048.0, *stat.ReadBytesPerSecond)
+	assert.Equal(t, 0.0, *stat.WriteBytesPerSecond)
+	assert.Equal(t, 30.0, *stat.VoluntaryContextSwitchesPerSecond)
+	assert.Equal(t, 1.0, *stat.InvoluntaryContextSwitchesPerSecond)
+
+	t.Run("reused PID", func(t *testing.T) {
+		stat := &ProcStat{PID: 1234, StartTicks: 5000}
+		gatherProcessDetails(stat, status, cfg, now.Add(20*time.Second), make(map[int]procCounters))
+		assert.Nil(t, stat.ReadBytesPerSecond)
+		assert.Nil(t, stat.VoluntaryContextSwitchesPerSecond)
+	})
+
+	t.Run("disabled fields", func(t *testing.T) {
+		stat := &ProcStat{PID: 1234, StartTicks: 1000}
+		gatherProcessDetails(stat, status, &Config{}, now, make(map[int]procCounters))
+		assert.Equal(t, &ProcStat{PID: 1234, StartTicks: 1000}, stat)
+	})
+}
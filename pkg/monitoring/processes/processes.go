@@ -1,6 +1,7 @@
 package processes
 
 import (
+	"fmt"
 	"runtime"
 	"sort"
 
@@ -16,6 +17,26 @@ type Config struct {
 	Enabled                     bool `toml:"enabled"`
 	EnableKernelTaskMonitoring  bool `toml:"enable_kerneltask_monitoring" comment:"Monitor kernel tasks identified by process group 0\nIgnored on Windows."`
 	MaxNumberMonitoredProcesses uint `toml:"max_number_monitored_processes" comment:"The process list is sorted by PID descending. Only the top N processes are monitored."`
+
+	ReportUser            bool `toml:"report_user" comment:"Additional per process fields, all disabled by default to keep the payload small.\nOnly supported on Linux.\nReport the owner of the process"`
+	ReportStartTime       bool `toml:"report_start_time" comment:"Report the start time and the age of the process"`
+	ReportThreads         bool `toml:"report_threads" comment:"Report the number of threads"`
+	ReportOpenFiles       bool `toml:"report_open_files" comment:"Report the number of open file descriptors and the usage of the RLIMIT_NOFILE soft limit"`
+	ReportIO              bool `toml:"report_io" comment:"Report the bytes read from and written to the storage per second\nProcesses of other users are only readable when cagent runs as root"`
+	ReportContextSwitches bool `toml:"report_context_switches" comment:"Report voluntary and involuntary context switches per second"`
+
+	AggregateBy []string `toml:"aggregate_by" comment:"Sum CPU, RSS and the number of processes of all processes, regardless of max_number_monitored_processes.\nPossible values: 'name', 'user', 'container', 'unit' (systemd unit or the cgroup, Linux only). Disabled by default, e.g. ['name', 'user']"`
+}
+
+func (cfg *Config) Validate() error {
+	for _, a := range cfg.AggregateBy {
+		switch a {
+		case AggregateByName, AggregateByUser, AggregateByContainer, AggregateByUnit:
+		default:
+			return fmt.Errorf("invalid aggregate_by value '%s'. Possible values: %s, %s, %s, %s", a, AggregateByName, AggregateByUser, AggregateByContainer, AggregateByUnit)
+		}
+	}
+	return nil
 }
 
 func GetDefaultConfig() Config {
@@ -23,6 +44,7 @@ func GetDefaultConfig() Config {
 		Enabled:                     true,
 		EnableKernelTaskMonitoring:  true,
 		MaxNumberMonitoredProcesses: 500,
+		AggregateBy:                 []string{},
 	}
 }
 
@@ -30,14 +52,36 @@ type ProcStat struct {
 	PID                    int     `json:"pid"`
 	ParentPID              int     `json:"parent_pid"`
 	ProcessGID             int     `json:"-"`
+	UID                    int     `json:"-"` // -1 if unknown
+	StartTicks             uint64  `json:"-"` // start time in clock ticks since the boot, identifies the process together with the PID
 	Name                   string  `json:"name"`
 	Cmdline                string  `json:"cmdline"`
 	State                  string  `json:"state"`
 	Container              string  `json:"container,omitempty"`
+	ContainerRuntime       string  `json:"container_runtime,omitempty"` // docker, podman, containerd, cri-o, kubernetes or systemd-nspawn
+	Unit                   string  `json:"-"`                           // systemd unit or the cgroup path if the process doesn't belong to a unit
 	CPUAverageUsagePercent float32 `json:"cpu_avg_usage_percent,omitempty"`
 	RSS                    uint64  `json:"rss"` // Resident Set Size
 	VMS                    uint64  `json:"vms"` // Virtual Memory Size
 	MemoryUsagePercent     float32 `json:"memory_usage_percent"`
+
+	// optional fields enabled by the report_* settings
+	User                                string   `json:"user,omitempty"`
+	StartTime                           int64    `json:"start_time,omitempty"` // unix timestamp
+	AgeSeconds                          *uint64  `json:"age_s,omitempty"`
+	Threads                             int      `json:"threads,omitempty"`
+	OpenFiles                           *int     `json:"open_files,omitempty"`
+	OpenFilesLimit                      uint64   `json:"open_files_limit,omitempty"` // the soft limit, omitted if unlimited
+	OpenFilesUsagePercent               *float32 `json:"open_files_usage_percent,omitempty"`
+	ReadBytesPerSecond                  *float64 `json:"read_B_per_s,omitempty"`
+	WriteBytesPerSecond                 *float64 `json:"write_B_per_s,omitempty"`
+	VoluntaryContextSwitchesPerSecond   *float64 `json:"voluntary_ctxt_switches_per_s,omitempty"`
+	InvoluntaryContextSwitchesPerSecond *float64 `json:"involuntary_ctxt_switches_per_s,omitempty"`
+}
+
+// reportsStatusDetails returns true if the optional fields from /proc/<pid>/status are needed
+func (cfg *Config) reportsStatusDetails() bool {
+	return cfg.ReportUser || cfg.ReportThreads || cfg.ReportContextSwitches
 }
 
 // Gets possible process states based on the OS
@@ -74,7 +118,7 @@ func GetMeasurements(memStat *mem.VirtualMemoryStat, cfg *Config) (common.Measur
 	} else {
 		systemMemorySize = memStat.Total
 	}
-	procs, err := processes(systemMemorySize)
+	procs, err := processes(systemMemorySize, cfg)
 	if err != nil {
 		log.WithError(err).Error()
 		return nil, nil, err
@@ -83,7 +127,10 @@ func GetMeasurements(memStat *mem.VirtualMemoryStat, cfg *Config) (common.Measur
 
 	var m common.MeasurementsMap
 	if cfg.Enabled {
-		m = common.MeasurementsMap{"list": filterProcs(procs, cfg), "possible_states": states}
+		// aggregate before the list is truncated
+		m = aggregate(procs, cfg)
+		m["list"] = filterProcs(procs, cfg)
+		m["possible_states"] = states
 	}
 
 	return m, procs, nil
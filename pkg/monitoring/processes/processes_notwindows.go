@@ -10,7 +10,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
@@ -20,7 +19,6 @@ import (
 	"github.com/shirou/gopsutil/process"
 
 	"github.com/cloudradar-monitoring/cagent/pkg/common"
-	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/docker"
 )
 
 var errorProcessTerminated = fmt.Errorf("Process was terminated")
@@ -28,14 +26,18 @@ var errorProcessTerminated = fmt.Errorf("Process was terminated")
 type procStatus struct {
 	PPID  int
 	State string
+	UID   int
+	// the following fields are only parsed when requested
+	Threads                 int
+	VoluntaryCtxSwitches    uint64
+	NonvoluntaryCtxSwitches uint64
 }
 
-var dockerContainerIDRE = regexp.MustCompile(`(?m)/docker/([a-f0-9]*)$`)
 var monitoredProcessCache = make(map[int]*process.Process)
 
-func processes(systemMemorySize uint64) ([]*ProcStat, error) {
+func processes(systemMemorySize uint64, cfg *Config) ([]*ProcStat, error) {
 	if runtime.GOOS == "linux" {
-		return processesFromProc(systemMemorySize)
+		return processesFromProc(systemMemorySize, cfg)
 	}
 	return processesFromPS(systemMemorySize)
 }
@@ -64,7 +66,7 @@ func getProcLongState(shortState byte) string {
 }
 
 // get process states from /proc/(pid)/stat
-func processesFromProc(systemMemorySize uint64) ([]*ProcStat, error) {
+func processesFromProc(systemMemorySize uint64, cfg *Config) ([]*ProcStat, error) {
 	filepaths, err := filepath.Glob(common.HostProc() + "/[0-9]*/status")
 	if err != nil {
 		return nil, err
@@ -72,6 +74,8 @@ func processesFromProc(systemMemorySize uint64) ([]*ProcStat, error) {
 
 	var procs []*ProcStat
 	var updatedProcessCache = make(map[int]*process.Process)
+	var updatedCountersCache = make(map[int]procCounters)
+	now := time.Now()
 
 	for _, statusFilepath := range filepaths {
 		statusFile, err := readProcFile(statusFilepath)
@@ -82,8 +86,8 @@ func processesFromProc(systemMemorySize uint64) ([]*ProcStat, error) {
 			continue
 		}
 
-		parsedProcStatus := parseProcStatusFile(statusFile)
-		stat := &ProcStat{ParentPID: parsedProcStatus.PPID, State: parsedProcStatus.State}
+		parsedProcStatus := parseProcStatusFile(statusFile, cfg.reportsStatusDetails())
+		stat := &ProcStat{ParentPID: parsedProcStatus.PPID, State: parsedProcStatus.State, UID: parsedProcStatus.UID}
 		// get the PID from the filepath(/proc/<pid>/status) itself
 		pathParts := strings.Split(statusFilepath, string(filepath.Separator))
 		pidString := pathParts[len(pathParts)-2]
@@ -113,18 +117,10 @@ func processesFromProc(systemMemorySize uint64) ([]*ProcStat, error) {
 		if err != nil && err != errorProcessTerminated {
 			log.WithError(err).Errorf("failed to read cgroup(%s)", cgroupFilepath)
 		} else if err == nil {
-			reParts := dockerContainerIDRE.FindStringSubmatch(string(cgroup))
-			if len(reParts) > 0 {
-				containerID := reParts[1]
-				containerName, err := docker.ContainerNameByID(containerID)
-				if err != nil {
-					if err != docker.ErrorNotImplementedForOS && err != docker.ErrorDockerNotAvailable {
-						log.WithError(err).Errorf("failed to read docker container name by id(%s)", containerID)
-					}
-				} else {
-					stat.Container = containerName
-				}
+			if ref := parseContainerFromCgroup(cgroup); ref != nil {
+				stat.Container, stat.ContainerRuntime = resolveContainer(ref)
 			}
+			stat.Unit = parseUnitFromCgroup(cgroup)
 		}
 
 		statFilepath := common.HostProc() + "/" + pidString + "/stat"
@@ -133,27 +129,33 @@ func processesFromProc(systemMemorySize uint64) ([]*ProcStat, error) {
 			log.WithError(err).Errorf("failed to read stat (%s)", statFilepath)
 		} else if err == nil {
 			stat.ProcessGID = parseProcessGroupIDFromStatFile(statFileContent)
+			stat.StartTicks = parseStartTicksFromStatFile(statFileContent)
 		}
 
 		if stat.PID > 0 {
 			p := getProcessByPID(stat.PID)
 			stat.RSS, stat.VMS, stat.MemoryUsagePercent, stat.CPUAverageUsagePercent = gatherProcessResourceUsage(p, systemMemorySize)
 			updatedProcessCache[stat.PID] = p
+
+			gatherProcessDetails(stat, parsedProcStatus, cfg, now, updatedCountersCache)
 		}
 
 		procs = append(procs, stat)
 	}
 
 	monitoredProcessCache = updatedProcessCache
+	procCountersCache = updatedCountersCache
 
 	return procs, nil
 }
 
-func parseProcStatusFile(b []byte) procStatus {
+// parseProcStatusFile parses /proc/<pid>/status. The whole file is only parsed if allFields is true
+func parseProcStatusFile(b []byte, allFields bool) procStatus {
 	// fill default value
 	// we need non-zero values in order to check if we set them, because PPID can be 0
 	status := procStatus{
 		PPID: -1,
+		UID:  -1,
 	}
 
 	scanner := bufio.NewScanner(bytes.NewReader(b))
@@ -181,9 +183,26 @@ func parseProcStatusFile(b []byte) procStatus {
 			// determine long state from the short one in case long one is not available
 			// eg "State:	S"
 			status.State = getProcLongState(fields[1][0])
+		case "uid:":
+			// real, effective, saved set, and filesystem UIDs
+			if len(fields) >= 2 {
+				status.UID, _ = strconv.Atoi(fields[1])
+			}
+		case "threads:":
+			if len(fields) >= 2 {
+				status.Threads, _ = strconv.Atoi(fields[1])
+			}
+		case "voluntary_ctxt_switches:":
+			if len(fields) >= 2 {
+				status.VoluntaryCtxSwitches, _ = strconv.ParseUint(fields[1], 10, 64)
+			}
+		case "nonvoluntary_ctxt_switches:":
+			if len(fields) >= 2 {
+				status.NonvoluntaryCtxSwitches, _ = strconv.ParseUint(fields[1], 10, 64)
+			}
 		}
 
-		if status.PPID >= 0 && status.State != "" {
+		if !allFields && status.PPID >= 0 && status.State != "" && status.UID >= 0 {
 			// we found all fields we want to
 			// we can break and return
 			break
@@ -209,6 +228,49 @@ func parseProcessGroupIDFromStatFile(b []byte) int {
 	return int(pgrp)
 }
 
+// parseUnitFromCgroup returns the deepest systemd unit from the contents of /proc/<pid>/cgroup,
+// e.g. "nginx.service" for "0::/system.slice/nginx.service". If the process doesn't belong to a unit the cgroup path is returned
+func parseUnitFromCgroup(cgroup []byte) string {
+	var path string
+	scanner := bufio.NewScanner(bytes.NewReader(cgroup))
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) < 3 {
+			continue
+		}
+
+		// the unified hierarchy of cgroup v2 or the systemd hierarchy of cgroup v1
+		if parts[1] == "" || parts[1] == "name=systemd" {
+			path = parts[2]
+			break
+		}
+	}
+
+	if path == "" {
+		return ""
+	}
+
+	segments := strings.Split(path, "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		if strings.HasSuffix(segments[i], ".service") || strings.HasSuffix(segments[i], ".scope") {
+			return unescapeSystemdUnitName(segments[i])
+		}
+	}
+
+	return path
+}
+
+// parseStartTicksFromStatFile returns the start time of the process in clock ticks since the boot
+func parseStartTicksFromStatFile(b []byte) uint64 {
+	startTicks, err := strconv.ParseUint(procPidStatSplit(string(b))[21], 10, 64)
+	if err != nil {
+		log.WithError(err).Debugf("proc/stat: failed to parse the start time. Stat file: %s", string(b))
+		return 0
+	}
+	return startTicks
+}
+
 // procPidStatSplit tries to parse /proc/<pid>/stat file
 // from uber-archive/cpustat
 // You might think that we could split on space, but due to what can at best be called
@@ -291,7 +353,7 @@ func execPS() ([]byte, error) {
 		return nil, err
 	}
 
-	out, _ := exec.Command(bin, "axwwo", "pid,ppid,pgrp,state,command").Output()
+	out, _ := exec.Command(bin, "axwwo", "pid,ppid,pgrp,uid,state,command").Output()
 	return out, nil
 }
 
@@ -356,6 +418,16 @@ func processesFromPS(systemMemorySize uint64) ([]*ProcStat, error) {
 			stat.ProcessGID = -1
 		}
 
+		stat.UID = -1
+		if uidIndex, exists := columnsIndex["UID"]; exists {
+			uidString := parts[uidIndex]
+			stat.UID, err = strconv.Atoi(uidString)
+			if err != nil {
+				log.WithError(err).Errorf("ps: failed to convert UID(%s) to int", uidString)
+				stat.UID = -1
+			}
+		}
+
 		if statIndex, exists := columnsIndex["STAT"]; exists {
 			stat.State = getProcLongState(parts[statIndex][0])
 		}
@@ -20,7 +20,7 @@ func init() {
 	windowsEnumerator = winapi.NewWindowsEnumerator()
 }
 
-func processes(systemMemorySize uint64) ([]*ProcStat, error) {
+func processes(systemMemorySize uint64, _ *Config) ([]*ProcStat, error) {
 	procByPid, threadsByProcPid, err := winapi.GetSystemProcessInformation(false)
 	if err != nil {
 		return nil, errors.Wrap(err, "can't get system processes")
@@ -96,6 +96,7 @@ func processes(systemMemorySize uint64) ([]*ProcStat, error) {
 			PID:                    int(pid),
 			ParentPID:              int(proc.InheritedFromUniqueProcessID),
 			ProcessGID:             -1,
+			UID:                    -1,
 			State:                  state,
 			Name:                   proc.ImageName.String(),
 			Cmdline:                cmdLine,
@@ -128,3 +129,13 @@ func isKernelTask(p *ProcStat) bool {
 	// Where LocalSystemSID is { SID_REVISION, 1, SECURITY_NT_AUTHORITY, { SECURITY_LOCAL_SYSTEM_RID } };
 	// See https://github.com/processhacker/processhacker/blob/master/phlib/data.c for more details
 }
+
+// userNameByID is not used on Windows, the UID of the processes is unknown
+func userNameByID(_ int) string {
+	return ""
+}
+
+// ContainerByCgroupPath is not supported on Windows
+func ContainerByCgroupPath(_ string) (name, runtime string, ok bool) {
+	return "", "", false
+}
@@ -0,0 +1,229 @@
+package procwatch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/user"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/processes"
+)
+
+const defaultMinCount = 1
+
+var log = logrus.WithField("package", "procwatch")
+
+// Process describes a watched process. A process must match all of the set criteria
+type Process struct {
+	Name        string `toml:"name" comment:"Name of the watched process used in the module report"`
+	ProcessName string `toml:"process_name" comment:"Executable name of the process, e.g. 'nginx'"`
+	Cmdline     string `toml:"cmdline" comment:"Regular expression matching the command line"`
+	User        string `toml:"user" comment:"User name or UID owning the process"`
+	PIDFile     string `toml:"pidfile" comment:"File containing the PID of the process"`
+	MinCount    *uint  `toml:"min_count" comment:"Minimum number of instances. Default: 1"`
+	MaxCount    *uint  `toml:"max_count" comment:"Maximum number of instances. Default: unlimited"`
+}
+
+func (p *Process) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	if p.ProcessName == "" && p.Cmdline == "" && p.User == "" && p.PIDFile == "" {
+		return fmt.Errorf("at least one of process_name, cmdline, user or pidfile is required")
+	}
+
+	if p.Cmdline != "" {
+		if _, err := regexp.Compile(p.Cmdline); err != nil {
+			return fmt.Errorf("invalid cmdline regular expression: %s", err.Error())
+		}
+	}
+
+	if p.MaxCount != nil && *p.MaxCount < p.minCount() {
+		return fmt.Errorf("max_count must be >= min_count")
+	}
+
+	return nil
+}
+
+func (p *Process) minCount() uint {
+	if p.MinCount == nil {
+		return defaultMinCount
+	}
+	return *p.MinCount
+}
+
+// instance identifies a process across runs. The start time detects a reused PID
+type instance struct {
+	pid        int
+	startTicks uint64
+}
+
+type watchedProcess struct {
+	config  *Process
+	cmdline *regexp.Regexp
+
+	previous       []instance
+	previousLoaded bool
+}
+
+// Watchlist evaluates the watched processes against the process list and remembers the instances for the next run
+type Watchlist struct {
+	processes []*watchedProcess
+}
+
+func NewWatchlist(config []Process) *Watchlist {
+	w := &Watchlist{}
+	for i := range config {
+		wp := &watchedProcess{config: &config[i]}
+		if config[i].Cmdline != "" {
+			// the expression is checked by Validate
+			wp.cmdline, _ = regexp.Compile(config[i].Cmdline)
+		}
+		w.processes = append(w.processes, wp)
+	}
+	return w
+}
+
+// Evaluate returns the report with alerts for the missing processes or too many instances
+// and warnings for the processes restarted since the previous run
+func (w *Watchlist) Evaluate(procs []*processes.ProcStat, now time.Time) *monitoring.ModuleReport {
+	report := monitoring.NewReport("process watchlist", now, "")
+	report.Measurements = make(map[string]interface{}, len(w.processes))
+
+	for _, wp := range w.processes {
+		cfg := wp.config
+		current := wp.match(procs)
+
+		count := uint(len(current))
+		minCount := cfg.minCount()
+		switch {
+		case count == 0 && minCount > 0:
+			report.AddAlert(fmt.Sprintf("process '%s' is not running", cfg.Name))
+		case count < minCount:
+			report.AddAlert(fmt.Sprintf("process '%s' has %d instances, expected at least %d", cfg.Name, count, minCount))
+		case cfg.MaxCount != nil && count > *cfg.MaxCount:
+			report.AddAlert(fmt.Sprintf("process '%s' has %d instances, expected at most %d", cfg.Name, count, *cfg.MaxCount))
+		}
+
+		if wp.previousLoaded {
+			stopped := difference(wp.previous, current)
+			started := difference(current, wp.previous)
+			if len(stopped) > 0 && len(started) > 0 {
+				report.AddWarning(fmt.Sprintf("process '%s' restarted, PID %s replaced by %s", cfg.Name, formatPIDs(stopped), formatPIDs(started)))
+			}
+		}
+		wp.previous = current
+		wp.previousLoaded = true
+
+		pids := make([]int, 0, len(current))
+		for _, inst := range current {
+			pids = append(pids, inst.pid)
+		}
+		report.Measurements[cfg.Name] = map[string]interface{}{
+			"count": count,
+			"pids":  pids,
+		}
+	}
+
+	return &report
+}
+
+func (wp *watchedProcess) match(procs []*processes.ProcStat) []instance {
+	cfg := wp.config
+
+	pidFromFile := -1
+	if cfg.PIDFile != "" {
+		var err error
+		pidFromFile, err = readPIDFile(cfg.PIDFile)
+		if err != nil {
+			log.WithError(err).Debugf("failed to read the pidfile of process '%s'", cfg.Name)
+			return nil
+		}
+	}
+
+	uid := -1
+	if cfg.User != "" {
+		var err error
+		uid, err = lookupUID(cfg.User)
+		if err != nil {
+			log.WithError(err).Errorf("failed to lookup the user of process '%s'", cfg.Name)
+			return nil
+		}
+	}
+
+	var result []instance
+	for _, p := range procs {
+		if pidFromFile >= 0 && p.PID != pidFromFile {
+			continue
+		}
+		if uid >= 0 && p.UID != uid {
+			continue
+		}
+		if cfg.ProcessName != "" && p.Name != cfg.ProcessName {
+			continue
+		}
+		if wp.cmdline != nil && !wp.cmdline.MatchString(p.Cmdline) {
+			continue
+		}
+		result = append(result, instance{pid: p.PID, startTicks: p.StartTicks})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].pid < result[j].pid
+	})
+	return result
+}
+
+func readPIDFile(path string) (int, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func lookupUID(name string) (int, error) {
+	if uid, err := strconv.Atoi(name); err == nil {
+		return uid, nil
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// difference returns the instances of a not present in b
+func difference(a, b []instance) []instance {
+	var result []instance
+	for _, x := range a {
+		found := false
+		for _, y := range b {
+			if x == y {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, x)
+		}
+	}
+	return result
+}
+
+func formatPIDs(instances []instance) string {
+	pids := make([]string, 0, len(instances))
+	for _, inst := range instances {
+		pids = append(pids, strconv.Itoa(inst.pid))
+	}
+	return strings.Join(pids, ", ")
+}
@@ -0,0 +1,111 @@
+package procwatch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/processes"
+)
+
+func count(n uint) *uint {
+	return &n
+}
+
+func toStrings(alerts []monitoring.Alert) []string {
+	var result []string
+	for _, a := range alerts {
+		result = append(result, string(a))
+	}
+	return result
+}
+
+func warnings(w *Watchlist, procs []*processes.ProcStat) []string {
+	var result []string
+	for _, warn := range w.Evaluate(procs, time.Now()).Warnings {
+		result = append(result, string(warn))
+	}
+	return result
+}
+
+func TestProcessValidate(t *testing.T) {
+	assert.Error(t, (&Process{ProcessName: "nginx"}).Validate(), "name is required")
+	assert.Error(t, (&Process{Name: "nginx"}).Validate(), "a criteria is required")
+	assert.Error(t, (&Process{Name: "nginx", Cmdline: "(nginx"}).Validate())
+	assert.Error(t, (&Process{Name: "nginx", ProcessName: "nginx", MaxCount: count(0)}).Validate())
+	assert.NoError(t, (&Process{Name: "nginx", ProcessName: "nginx", MinCount: count(0), MaxCount: count(0)}).Validate())
+	assert.NoError(t, (&Process{Name: "nginx", Cmdline: "^nginx: worker", MinCount: count(2), MaxCount: count(4)}).Validate())
+}
+
+func TestEvaluate(t *testing.T) {
+	procs := []*processes.ProcStat{
+		{PID: 100, Name: "nginx", Cmdline: "nginx: master process /usr/sbin/nginx", UID: 0, StartTicks: 1000},
+		{PID: 101, Name: "nginx", Cmdline: "nginx: worker process", UID: 33, StartTicks: 1010},
+		{PID: 102, Name: "nginx", Cmdline: "nginx: worker process", UID: 33, StartTicks: 1010},
+		{PID: 200, Name: "sshd", Cmdline: "/usr/sbin/sshd -D", UID: 0, StartTicks: 500},
+	}
+
+	w := NewWatchlist([]Process{
+		{Name: "master", Cmdline: "^nginx: master", User: "0", MaxCount: count(1)},
+		{Name: "workers", ProcessName: "nginx", User: "33", MinCount: count(3)},
+		{Name: "all nginx", ProcessName: "nginx", MaxCount: count(2)},
+		{Name: "cron", ProcessName: "cron"},
+		{Name: "forbidden", ProcessName: "telnetd", MinCount: count(0), MaxCount: count(0)},
+	})
+
+	t.Run("counts", func(t *testing.T) {
+		report := w.Evaluate(procs, time.Now())
+		assert.Equal(t, []string{
+			"process 'workers' has 2 instances, expected at least 3",
+			"process 'all nginx' has 3 instances, expected at most 2",
+			"process 'cron' is not running",
+		}, toStrings(report.Alerts))
+		assert.Empty(t, report.Warnings)
+		assert.Equal(t, map[string]interface{}{"count": uint(1), "pids": []int{100}}, report.Measurements["master"])
+		assert.Equal(t, map[string]interface{}{"count": uint(0), "pids": []int{}}, report.Measurements["forbidden"])
+	})
+
+	t.Run("restarted", func(t *testing.T) {
+		restarted := []*processes.ProcStat{
+			{PID: 300, Name: "nginx", Cmdline: "nginx: master process /usr/sbin/nginx", UID: 0, StartTicks: 9000},
+			// the same PID with a different start time is a new process
+			{PID: 101, Name: "nginx", Cmdline: "nginx: worker process", UID: 33, StartTicks: 9010},
+			{PID: 102, Name: "nginx", Cmdline: "nginx: worker process", UID: 33, StartTicks: 1010},
+		}
+		assert.Equal(t, []string{
+			"process 'master' restarted, PID 100 replaced by 300",
+			"process 'workers' restarted, PID 101 replaced by 101",
+			"process 'all nginx' restarted, PID 100, 101 replaced by 101, 300",
+		}, warnings(w, restarted))
+
+		assert.Empty(t, warnings(w, restarted), "unchanged processes")
+	})
+}
+
+func TestPIDFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "procwatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	pidFile := filepath.Join(dir, "app.pid")
+	if err := ioutil.WriteFile(pidFile, []byte("42\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	procs := []*processes.ProcStat{{PID: 41, Name: "app"}, {PID: 42, Name: "app"}}
+	w := NewWatchlist([]Process{
+		{Name: "app", PIDFile: pidFile},
+		{Name: "missing pidfile", PIDFile: filepath.Join(dir, "missing.pid")},
+	})
+
+	report := w.Evaluate(procs, time.Now())
+	assert.Equal(t, []string{"process 'missing pidfile' is not running"}, toStrings(report.Alerts))
+	assert.Equal(t, map[string]interface{}{"count": uint(1), "pids": []int{42}}, report.Measurements["app"])
+}
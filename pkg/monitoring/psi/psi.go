@@ -0,0 +1,268 @@
+package psi
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/processes"
+)
+
+// maxCgroupDepth limits the walk through the cgroup hierarchy looking for units and containers
+const maxCgroupDepth = 8
+
+var log = logrus.WithField("package", "psi")
+
+// Resources with the pressure stall information
+var Resources = []string{"cpu", "memory", "io"}
+
+type Config struct {
+	Enabled bool `toml:"enabled" comment:"Set 'false' to disable the collection of the pressure stall information. Linux only, requires kernel 4.20 or newer"`
+	Cgroups bool `toml:"cgroups" comment:"Also collect the pressure of systemd units and containers. Requires the cgroup v2 hierarchy"`
+}
+
+// Stall is the share of the time in percent some or all tasks were stalled on a resource
+type Stall struct {
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	// Total is the absolute stall time in microseconds
+	Total uint64
+}
+
+// Pressure is the content of a /proc/pressure/<resource> or <cgroup>/<resource>.pressure file
+type Pressure struct {
+	Some Stall
+	// Full is nil for CPU pressure on kernels before 5.13
+	Full *Stall
+}
+
+// Parse parses the 'some' and 'full' lines of the pressure file, e.g. "some avg10=0.00 avg60=0.00 avg300=0.00 total=0"
+func Parse(b []byte) (*Pressure, error) {
+	p := &Pressure{}
+	hasSome := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		var s Stall
+		for _, f := range fields[1:] {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("unexpected field '%s'", f)
+			}
+
+			var err error
+			switch kv[0] {
+			case "avg10":
+				s.Avg10, err = strconv.ParseFloat(kv[1], 64)
+			case "avg60":
+				s.Avg60, err = strconv.ParseFloat(kv[1], 64)
+			case "avg300":
+				s.Avg300, err = strconv.ParseFloat(kv[1], 64)
+			case "total":
+				s.Total, err = strconv.ParseUint(kv[1], 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid value of '%s': %s", kv[0], err.Error())
+			}
+		}
+
+		switch fields[0] {
+		case "some":
+			p.Some = s
+			hasSome = true
+		case "full":
+			p.Full = &s
+		}
+	}
+
+	if !hasSome {
+		return nil, fmt.Errorf("no 'some' line found")
+	}
+
+	return p, nil
+}
+
+func ReadFile(path string) (*Pressure, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return p, nil
+}
+
+// SystemPressure reads the system-wide pressure of the resource
+func SystemPressure(resource string) (*Pressure, error) {
+	return ReadFile(common.HostProc("pressure", resource))
+}
+
+// IsNotSupported returns true if the pressure file doesn't exist or the kernel was booted with psi=0,
+// reading the files fails with EOPNOTSUPP then
+func IsNotSupported(err error) bool {
+	return os.IsNotExist(err) || errors.Is(err, syscall.EOPNOTSUPP)
+}
+
+// ValidateMetric checks the metric name accepted by Pressure.Value
+func ValidateMetric(metric string) error {
+	_, err := (&Pressure{Full: &Stall{}}).Value(metric)
+	return err
+}
+
+// Value returns the average by the metric name, e.g. 'some.avg10' or 'full.avg300'
+func (p *Pressure) Value(metric string) (float64, error) {
+	parts := strings.Split(metric, ".")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid metric '%s'", metric)
+	}
+
+	s := &p.Some
+	switch parts[0] {
+	case "some":
+	case "full":
+		if p.Full == nil {
+			return 0, fmt.Errorf("'full' is not available")
+		}
+		s = p.Full
+	default:
+		return 0, fmt.Errorf("invalid metric '%s'. Possible values: some.avg10, some.avg60, some.avg300, full.avg10, full.avg60, full.avg300", metric)
+	}
+
+	switch parts[1] {
+	case "avg10":
+		return s.Avg10, nil
+	case "avg60":
+		return s.Avg60, nil
+	case "avg300":
+		return s.Avg300, nil
+	}
+	return 0, fmt.Errorf("invalid metric '%s'. Possible values: some.avg10, some.avg60, some.avg300, full.avg10, full.avg60, full.avg300", metric)
+}
+
+// Watcher reports the pressure and the stall time since the previous run
+type Watcher struct {
+	cfg            *Config
+	previousTotals map[string]uint64
+}
+
+func NewWatcher(cfg *Config) *Watcher {
+	return &Watcher{cfg: cfg, previousTotals: make(map[string]uint64)}
+}
+
+// Results returns e.g. 'cpu.some.avg10' for the system and 'unit.cpu.some.avg10.nginx.service' for the cgroups.
+// Nothing is returned if the kernel doesn't support PSI
+func (w *Watcher) Results() (common.MeasurementsMap, error) {
+	results := common.MeasurementsMap{}
+	totals := make(map[string]uint64)
+	errs := common.ErrorCollector{}
+
+	for _, resource := range Resources {
+		p, err := SystemPressure(resource)
+		if err != nil {
+			if !IsNotSupported(err) {
+				errs.Add(err)
+			}
+			continue
+		}
+		w.add(results, totals, resource+".", "", p)
+	}
+
+	if w.cfg.Cgroups {
+		if root := cgroup2Root(); root != "" {
+			w.walkCgroups(results, totals, root, "", 0)
+		}
+	}
+
+	w.previousTotals = totals
+	return results, errs.Combine()
+}
+
+// add puts the values of the pressure in the results, the suffix is the name of the cgroup
+func (w *Watcher) add(results common.MeasurementsMap, totals map[string]uint64, prefix, suffix string, p *Pressure) {
+	stalls := map[string]*Stall{"some": &p.Some}
+	if p.Full != nil {
+		stalls["full"] = p.Full
+	}
+
+	for kind, s := range stalls {
+		key := prefix + kind + ".%s" + suffix
+		results[fmt.Sprintf(key, "avg10")] = s.Avg10
+		results[fmt.Sprintf(key, "avg60")] = s.Avg60
+		results[fmt.Sprintf(key, "avg300")] = s.Avg300
+
+		totalKey := fmt.Sprintf(key, "total_delta_us")
+		totals[totalKey] = s.Total
+		if prev, exists := w.previousTotals[totalKey]; exists && s.Total >= prev {
+			results[totalKey] = s.Total - prev
+		}
+	}
+}
+
+// cgroup2Root returns the mount point of the cgroup v2 hierarchy, including the hybrid mode
+func cgroup2Root() string {
+	for _, root := range []string{common.HostSys("fs/cgroup"), common.HostSys("fs/cgroup/unified")} {
+		if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+			return root
+		}
+	}
+	return ""
+}
+
+// walkCgroups adds the pressure of the systemd units and containers below the dir
+func (w *Watcher) walkCgroups(results common.MeasurementsMap, totals map[string]uint64, root, relPath string, depth int) {
+	if depth >= maxCgroupDepth {
+		return
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Join(root, relPath))
+	if err != nil {
+		log.WithError(err).Debugf("failed to read cgroup %s", relPath)
+		return
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		path := relPath + "/" + e.Name()
+		var prefix, name string
+		if containerName, _, isContainer := processes.ContainerByCgroupPath(path); isContainer {
+			prefix, name = "container.", containerName
+		} else if strings.HasSuffix(e.Name(), ".service") || strings.HasSuffix(e.Name(), ".scope") {
+			prefix, name = "unit.", e.Name()
+		} else {
+			// slices and kubepods groups
+			w.walkCgroups(results, totals, root, path, depth+1)
+			continue
+		}
+
+		for _, resource := range Resources {
+			p, err := ReadFile(filepath.Join(root, path, resource+".pressure"))
+			if err != nil {
+				// the controller may be disabled for the cgroup
+				continue
+			}
+			w.add(results, totals, prefix+resource+".", "."+name, p)
+		}
+	}
+}
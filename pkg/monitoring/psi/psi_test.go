@@ -0,0 +1,115 @@
+package psi
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testCPUPressure    = "some avg10=1.50 avg60=0.75 avg300=0.25 total=1000\n"
+	testMemoryPressure = "some avg10=0.00 avg60=0.00 avg300=0.00 total=200\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=100\n"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse([]byte(testMemoryPressure))
+	assert.NoError(t, err)
+	assert.Equal(t, &Pressure{Some: Stall{Total: 200}, Full: &Stall{Total: 100}}, p)
+
+	p, err = Parse([]byte(testCPUPressure))
+	assert.NoError(t, err)
+	assert.Equal(t, &Pressure{Some: Stall{Avg10: 1.5, Avg60: 0.75, Avg300: 0.25, Total: 1000}}, p)
+
+	_, err = Parse([]byte("some avg10=x avg60=0.00 avg300=0.00 total=0\n"))
+	assert.Error(t, err)
+
+	_, err = Parse([]byte(""))
+	assert.Error(t, err)
+}
+
+func TestValue(t *testing.T) {
+	p, err := Parse([]byte(testCPUPressure))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := p.Value("some.avg60")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.75, v)
+
+	_, err = p.Value("full.avg10")
+	assert.Error(t, err, "no full line for CPU")
+
+	assert.NoError(t, ValidateMetric("full.avg300"))
+	assert.Error(t, ValidateMetric("some.avg5"))
+	assert.Error(t, ValidateMetric("avg10"))
+}
+
+func TestIsNotSupported(t *testing.T) {
+	assert.True(t, IsNotSupported(&os.PathError{Op: "open", Path: "/proc/pressure/cpu", Err: syscall.ENOENT}))
+	assert.True(t, IsNotSupported(&os.PathError{Op: "read", Path: "/proc/pressure/cpu", Err: syscall.EOPNOTSUPP}))
+	assert.False(t, IsNotSupported(&os.PathError{Op: "open", Path: "/proc/pressure/cpu", Err: syscall.EACCES}))
+}
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "psi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("HOST_PROC", filepath.Join(dir, "proc"))
+	defer os.Unsetenv("HOST_PROC")
+	os.Setenv("HOST_SYS", filepath.Join(dir, "sys"))
+	defer os.Unsetenv("HOST_SYS")
+
+	writeFile := func(path, content string) {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeFile("proc/pressure/cpu", testCPUPressure)
+	writeFile("proc/pressure/memory", testMemoryPressure)
+	writeFile("sys/fs/cgroup/cgroup.controllers", "cpu io memory pids\n")
+	writeFile("sys/fs/cgroup/system.slice/nginx.service/cpu.pressure", testCPUPressure)
+	writeFile("sys/fs/cgroup/system.slice/nginx.service/io.pressure", testMemoryPressure)
+	writeFile("sys/fs/cgroup/machine.slice/machine-web.scope/memory.pressure", testMemoryPressure)
+	writeFile("sys/fs/cgroup/machine.slice/machine-web.scope/payload/system.slice/cron.service/cpu.pressure", testCPUPressure)
+
+	w := NewWatcher(&Config{Enabled: true, Cgroups: true})
+	res, err := w.Results()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1.5, res["cpu.some.avg10"])
+	assert.Equal(t, 0.25, res["cpu.some.avg300"])
+	assert.NotContains(t, res, "cpu.some.total_delta_us", "the first run has no previous total")
+	assert.Equal(t, 0.0, res["memory.full.avg60"])
+	assert.Equal(t, 1.5, res["unit.cpu.some.avg10.nginx.service"])
+	assert.Equal(t, 0.0, res["unit.io.full.avg10.nginx.service"])
+	assert.Equal(t, 0.0, res["container.memory.some.avg10.web"])
+	assert.NotContains(t, res, "unit.cpu.some.avg10.cron.service", "containers are not walked")
+
+	writeFile("proc/pressure/cpu", "some avg10=3.00 avg60=1.00 avg300=0.50 total=4500\n")
+	writeFile("sys/fs/cgroup/system.slice/nginx.service/cpu.pressure", "some avg10=3.00 avg60=1.00 avg300=0.50 total=1250\n")
+	res, err = w.Results()
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3500), res["cpu.some.total_delta_us"])
+	assert.Equal(t, uint64(0), res["memory.full.total_delta_us"])
+	assert.Equal(t, uint64(250), res["unit.cpu.some.total_delta_us.nginx.service"])
+
+	t.Run("not supported", func(t *testing.T) {
+		os.Setenv("HOST_PROC", filepath.Join(dir, "missing"))
+		res, err := NewWatcher(&Config{Enabled: true}).Results()
+		assert.NoError(t, err)
+		assert.Empty(t, res)
+	})
+}
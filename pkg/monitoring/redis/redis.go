@@ -0,0 +1,216 @@
+package redis
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+)
+
+const (
+	defaultPort = "6379"
+)
+
+var log = logrus.WithField("package", "redis")
+
+type Config struct {
+	Enabled        bool    `toml:"enabled" comment:"Set 'true' to enable the Redis monitoring"`
+	Connect        string  `toml:"connect" comment:"host:port of the server or the path to the unix socket, e.g. /var/run/redis/redis.sock"`
+	User           string  `toml:"user" comment:"ACL user, Redis >= 6. Leave empty to authenticate with the password only"`
+	Password       string  `toml:"password" comment:"Password sent with AUTH, leave empty if no authentication is required"`
+	ConnectTimeout float64 `toml:"connect_timeout" comment:"Maximum time to wait for the server to connect and to reply"`
+}
+
+func (cfg *Config) Validate() error {
+	if cfg.ConnectTimeout < 0 {
+		return fmt.Errorf("connect_timeout should be equal or greater than 0.0")
+	}
+	if cfg.User != "" && cfg.Password == "" {
+		return fmt.Errorf("password is required if user is set")
+	}
+	return nil
+}
+
+func CreateModule(config *Config) monitoring.Module {
+	return &Redis{
+		config: config,
+	}
+}
+
+type Redis struct {
+	config *Config
+
+	lastStatus     *Status
+	lastStatusTime time.Time
+}
+
+// dial connects to the server and authenticates if needed
+func (r *Redis) dial() (*conn, error) {
+	if len(r.config.Connect) == 0 {
+		return nil, fmt.Errorf("connect address is empty")
+	}
+
+	network, address := "tcp", r.config.Connect
+	if filepath.IsAbs(address) {
+		network = "unix"
+	} else if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, defaultPort)
+	}
+
+	timeout := time.Duration(r.config.ConnectTimeout * float64(time.Second))
+	c, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect %s: %s", r.config.Connect, err.Error())
+	}
+
+	client := newConn(c, timeout)
+	if r.config.Password != "" {
+		args := []string{"AUTH", r.config.Password}
+		if r.config.User != "" {
+			args = []string{"AUTH", r.config.User, r.config.Password}
+		}
+		if _, err = client.do(args...); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed to authenticate: %s", err.Error())
+		}
+	}
+
+	return client, nil
+}
+
+func (r *Redis) GetDescription() string {
+	return fmt.Sprintf("Redis performance for %s", r.config.Connect)
+}
+
+func (r *Redis) IsEnabled() bool {
+	return r.config.Enabled
+}
+
+func (r *Redis) Run() ([]*monitoring.ModuleReport, error) {
+	report := monitoring.NewReport(
+		fmt.Sprintf("Redis performance metrics for %s", r.config.Connect),
+		time.Now(),
+		"",
+	)
+
+	client, err := r.dial()
+	if err != nil {
+		report.AddAlert(err.Error())
+		return []*monitoring.ModuleReport{&report}, nil
+	}
+	defer client.Close()
+
+	statusTime := time.Now()
+	reply, err := client.do("INFO")
+	if err != nil {
+		report.AddAlert(fmt.Sprintf("failed to get info: %s", err.Error()))
+		return []*monitoring.ModuleReport{&report}, nil
+	}
+
+	info := parseInfo(reply)
+	status := getStatus(info)
+
+	report.Measurements = make(map[string]interface{})
+	if r.lastStatus == nil {
+		// need one more iteration to calculate the rates
+		// but we need to provide nil measurements for consistency
+		fillEmptyResultsPerSecond(report.Measurements)
+	} else {
+		fillResultsPerSecond(status, r.lastStatus, statusTime.Sub(r.lastStatusTime), report.Measurements)
+	}
+	r.lastStatus = status
+	r.lastStatusTime = statusTime
+
+	fillMemory(info, report.Measurements)
+	fillClients(info, report.Measurements)
+	checkReplication(info, &report)
+	checkPersistence(info, &report)
+
+	return []*monitoring.ModuleReport{&report}, nil
+}
+
+func fillMemory(info map[string]string, result map[string]interface{}) {
+	used := parseInt(info, "used_memory")
+	maxMemory := parseInt(info, "maxmemory")
+	result["Used memory B"] = used
+	result["Max memory B"] = maxMemory
+	if maxMemory > 0 {
+		result["Used memory percent"] = common.RoundToTwoDecimalPlaces(float64(used) / float64(maxMemory) * 100)
+	} else {
+		// no limit is set
+		result["Used memory percent"] = nil
+	}
+}
+
+func fillClients(info map[string]string, result map[string]interface{}) {
+	result["Connected clients"] = parseInt(info, "connected_clients")
+	result["Blocked clients"] = parseInt(info, "blocked_clients")
+}
+
+func checkReplication(info map[string]string, report *monitoring.ModuleReport) {
+	role := info["role"]
+	report.Measurements["Role"] = role
+	report.Measurements["Connected replicas"] = parseInt(info, "connected_slaves")
+
+	if role != "slave" {
+		return
+	}
+
+	linkStatus := info["master_link_status"]
+	report.Measurements["Master link status"] = linkStatus
+	report.Measurements["Master last io sec"] = parseInt(info, "master_last_io_seconds_ago")
+	if linkStatus != "up" {
+		msg := fmt.Sprintf("replication link to the master %s:%s is %s", info["master_host"], info["master_port"], linkStatus)
+		if down, exists := info["master_link_down_since_seconds"]; exists {
+			msg += fmt.Sprintf(" since %s seconds", down)
+		}
+		report.AddAlert(msg)
+	}
+}
+
+func checkPersistence(info map[string]string, report *monitoring.ModuleReport) {
+	rdbStatus := info["rdb_last_bgsave_status"]
+	report.Measurements["RDB last save status"] = rdbStatus
+	report.Measurements["RDB changes since last save"] = parseInt(info, "rdb_changes_since_last_save")
+	report.Measurements["RDB last save time"] = parseInt(info, "rdb_last_save_time")
+	if rdbStatus != "" && rdbStatus != "ok" {
+		report.AddAlert(fmt.Sprintf("the last RDB save failed: %s", rdbStatus))
+	}
+
+	aofEnabled := info["aof_enabled"] == "1"
+	report.Measurements["AOF enabled"] = aofEnabled
+	if !aofEnabled {
+		return
+	}
+
+	aofWriteStatus := info["aof_last_write_status"]
+	aofRewriteStatus := info["aof_last_bgrewrite_status"]
+	report.Measurements["AOF last write status"] = aofWriteStatus
+	report.Measurements["AOF last rewrite status"] = aofRewriteStatus
+	if aofWriteStatus != "" && aofWriteStatus != "ok" {
+		report.AddAlert(fmt.Sprintf("the last AOF write failed: %s", aofWriteStatus))
+	}
+	if aofRewriteStatus != "" && aofRewriteStatus != "ok" {
+		report.AddAlert(fmt.Sprintf("the last AOF rewrite failed: %s", aofRewriteStatus))
+	}
+}
+
+func parseInt(info map[string]string, key string) int64 {
+	val, exists := info[key]
+	if !exists {
+		return 0
+	}
+
+	valInt, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		log.Errorf("failed to convert %s to int: %s", key, err.Error())
+		return 0
+	}
+	return valInt
+}
@@ -0,0 +1,217 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/moduletest"
+)
+
+const masterInfo = `# Server
+redis_version:6.2.6
+
+# Clients
+connected_clients:12
+blocked_clients:1
+
+# Memory
+used_memory:52428800
+maxmemory:104857600
+
+# Persistence
+rdb_changes_since_last_save:10
+rdb_last_save_time:1634000000
+rdb_last_bgsave_status:ok
+aof_enabled:1
+aof_last_bgrewrite_status:ok
+aof_last_write_status:ok
+
+# Stats
+total_connections_received:%d
+total_commands_processed:%d
+keyspace_hits:%d
+keyspace_misses:%d
+evicted_keys:0
+expired_keys:0
+
+# Replication
+role:master
+connected_slaves:1
+slave0:ip=10.0.0.2,port=6379,state=online,offset=100,lag=0
+`
+
+const brokenReplicaInfo = `# Memory
+used_memory:1024
+maxmemory:0
+
+# Persistence
+rdb_last_bgsave_status:err
+aof_enabled:0
+
+# Replication
+role:slave
+master_host:10.0.0.1
+master_port:6379
+master_link_status:down
+master_last_io_seconds_ago:-1
+master_link_down_since_seconds:120
+`
+
+// stubServer replies to AUTH and INFO like a Redis server
+type stubServer struct {
+	listener net.Listener
+	password string
+	info     func() string
+}
+
+func newStubServer(t *testing.T, password string, info func() string) *stubServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &stubServer{listener: l, password: password, info: info}
+	go s.serve()
+	return s
+}
+
+func (s *stubServer) serve() {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(c)
+	}
+}
+
+func (s *stubServer) handle(c net.Conn) {
+	defer c.Close()
+	reader := bufio.NewReader(c)
+	authenticated := s.password == ""
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "AUTH":
+			if args[len(args)-1] == s.password {
+				authenticated = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid username-password pair\r\n"
+			}
+		case "INFO":
+			if !authenticated {
+				reply = "-NOAUTH Authentication required.\r\n"
+				break
+			}
+			info := strings.Replace(s.info(), "\n", "\r\n", -1)
+			reply = fmt.Sprintf("$%d\r\n%s\r\n", len(info), info)
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		if _, err = c.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		// skip the length of the bulk string
+		if _, err = reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, strings.TrimRight(arg, "\r\n"))
+	}
+	return args, nil
+}
+
+func (s *stubServer) Close() {
+	s.listener.Close()
+}
+
+func TestParseInfo(t *testing.T) {
+	info := parseInfo(strings.Replace(brokenReplicaInfo, "\n", "\r\n", -1))
+	assert.Equal(t, "slave", info["role"])
+	assert.Equal(t, "10.0.0.1", info["master_host"])
+	assert.Equal(t, int64(-1), parseInt(info, "master_last_io_seconds_ago"))
+	assert.NotContains(t, info, "# Replication")
+}
+
+func TestRun(t *testing.T) {
+	runs := 0
+	s := newStubServer(t, "secret", func() string {
+		runs++
+		return fmt.Sprintf(masterInfo, runs*10, runs*1000, runs*90, runs*10)
+	})
+	defer s.Close()
+
+	r := &Redis{config: &Config{Connect: s.listener.Addr().String(), User: "cagent", Password: "secret", ConnectTimeout: 1}}
+
+	measurements, alerts, _ := moduletest.Run(t, r)
+	assert.Empty(t, alerts)
+	assert.Nil(t, measurements["Commands per sec"])
+	assert.Equal(t, int64(12), measurements["Connected clients"])
+	assert.Equal(t, 50.0, measurements["Used memory percent"])
+	assert.Equal(t, "master", measurements["Role"])
+	assert.Equal(t, int64(1), measurements["Connected replicas"])
+	assert.Equal(t, "ok", measurements["AOF last write status"])
+
+	measurements, alerts, _ = moduletest.Run(t, r)
+	assert.Empty(t, alerts)
+	assert.Contains(t, measurements, "Commands per sec")
+	assert.NotNil(t, measurements["Commands per sec"])
+	assert.Equal(t, 90.0, measurements["Keyspace hit ratio percent"])
+
+	t.Run("wrong password", func(t *testing.T) {
+		r := &Redis{config: &Config{Connect: s.listener.Addr().String(), Password: "wrong", ConnectTimeout: 1}}
+		_, alerts, _ := moduletest.Run(t, r)
+		assert.Len(t, alerts, 1)
+	})
+
+	t.Run("no password", func(t *testing.T) {
+		r := &Redis{config: &Config{Connect: s.listener.Addr().String(), ConnectTimeout: 1}}
+		_, alerts, _ := moduletest.Run(t, r)
+		assert.Len(t, alerts, 1)
+	})
+}
+
+func TestRunFailures(t *testing.T) {
+	s := newStubServer(t, "", func() string { return brokenReplicaInfo })
+	defer s.Close()
+
+	r := &Redis{config: &Config{Connect: s.listener.Addr().String(), ConnectTimeout: 1}}
+	measurements, alerts, _ := moduletest.Run(t, r)
+	assert.Equal(t, []string{
+		"replication link to the master 10.0.0.1:6379 is down since 120 seconds",
+		"the last RDB save failed: err",
+	}, alerts)
+	assert.Equal(t, "down", measurements["Master link status"])
+	assert.Nil(t, measurements["Used memory percent"])
+	assert.Equal(t, false, measurements["AOF enabled"])
+}
@@ -0,0 +1,90 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBulkSize limits the size of a reply, INFO returns a few kilobytes
+const maxBulkSize = 1024 * 1024
+
+// conn speaks the subset of the Redis protocol (RESP) needed for AUTH and INFO
+type conn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+}
+
+func newConn(c net.Conn, timeout time.Duration) *conn {
+	return &conn{Conn: c, reader: bufio.NewReader(c), timeout: timeout}
+}
+
+// do sends the command and returns the reply as a string. Error replies are returned as errors
+func (c *conn) do(args ...string) (string, error) {
+	if c.timeout > 0 {
+		if err := c.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+			return "", err
+		}
+	}
+
+	var cmd strings.Builder
+	cmd.WriteString(fmt.Sprintf("*%d\r\n", len(args)))
+	for _, arg := range args {
+		cmd.WriteString(fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg))
+	}
+	if _, err := io.WriteString(c, cmd.String()); err != nil {
+		return "", err
+	}
+
+	return c.readReply()
+}
+
+func (c *conn) readReply() (string, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return "", err
+	}
+	if len(line) == 0 {
+		return "", errors.New("empty reply")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", errors.New(line[1:])
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", fmt.Errorf("invalid bulk size '%s'", line[1:])
+		}
+		if size < 0 {
+			// null bulk string
+			return "", nil
+		}
+		if size > maxBulkSize {
+			return "", fmt.Errorf("reply of %d bytes is too large", size)
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(c.reader, buf); err != nil {
+			return "", err
+		}
+		return string(buf[:size]), nil
+	default:
+		return "", fmt.Errorf("unexpected reply '%s'", line)
+	}
+}
+
+func (c *conn) readLine() (string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
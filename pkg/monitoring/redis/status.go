@@ -0,0 +1,84 @@
+package redis
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+)
+
+// Status contains the counters of INFO which are reported as rates
+type Status struct {
+	Commands       int64
+	Connections    int64
+	KeyspaceHits   int64
+	KeyspaceMisses int64
+	EvictedKeys    int64
+	ExpiredKeys    int64
+	NetInputBytes  int64
+	NetOutputBytes int64
+}
+
+// parseInfo returns the fields of the INFO reply, section headers and empty lines are skipped
+func parseInfo(reply string) map[string]string {
+	info := make(map[string]string)
+	for _, line := range strings.Split(reply, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		info[parts[0]] = parts[1]
+	}
+	return info
+}
+
+func getStatus(info map[string]string) *Status {
+	return &Status{
+		Commands:       parseInt(info, "total_commands_processed"),
+		Connections:    parseInt(info, "total_connections_received"),
+		KeyspaceHits:   parseInt(info, "keyspace_hits"),
+		KeyspaceMisses: parseInt(info, "keyspace_misses"),
+		EvictedKeys:    parseInt(info, "evicted_keys"),
+		ExpiredKeys:    parseInt(info, "expired_keys"),
+		NetInputBytes:  parseInt(info, "total_net_input_bytes"),
+		NetOutputBytes: parseInt(info, "total_net_output_bytes"),
+	}
+}
+
+func fillResultsPerSecond(new *Status, old *Status, durationBetween time.Duration, result map[string]interface{}) {
+	sec := durationBetween.Seconds()
+	result["Commands per sec"] = common.FormatPerSec(new.Commands, old.Commands, sec)
+	result["Connections per sec"] = common.FormatPerSec(new.Connections, old.Connections, sec)
+	result["Evicted keys per sec"] = common.FormatPerSec(new.EvictedKeys, old.EvictedKeys, sec)
+	result["Expired keys per sec"] = common.FormatPerSec(new.ExpiredKeys, old.ExpiredKeys, sec)
+	result["Bytes read bps"] = common.FormatPerSec(new.NetInputBytes, old.NetInputBytes, sec)
+	result["Bytes write bps"] = common.FormatPerSec(new.NetOutputBytes, old.NetOutputBytes, sec)
+
+	hits := new.KeyspaceHits - old.KeyspaceHits
+	misses := new.KeyspaceMisses - old.KeyspaceMisses
+	if hits >= 0 && misses >= 0 && hits+misses > 0 {
+		result["Keyspace hit ratio percent"] = common.RoundToTwoDecimalPlaces(float64(hits) / float64(hits+misses) * 100)
+	} else {
+		// no lookups or the counters were reset
+		result["Keyspace hit ratio percent"] = nil
+	}
+}
+
+func fillEmptyResultsPerSecond(result map[string]interface{}) {
+	for _, key := range []string{
+		"Commands per sec",
+		"Connections per sec",
+		"Evicted keys per sec",
+		"Expired keys per sec",
+		"Bytes read bps",
+		"Bytes write bps",
+		"Keyspace hit ratio percent",
+	} {
+		result[key] = nil
+	}
+}
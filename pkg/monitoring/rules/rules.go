@@ -0,0 +1,264 @@
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+)
+
+const (
+	SeverityAlert   = "alert"
+	SeverityWarning = "warning"
+
+	reportName = "threshold rules"
+)
+
+// Rule raises an alert or a warning when a measurement crosses the threshold
+type Rule struct {
+	Name       string  `toml:"name" comment:"Name of the rule used in the alert text"`
+	Key        string  `toml:"key" comment:"Measurement key, e.g. 'fs.free_percent./'. A trailing '*' matches all keys with the prefix"`
+	Function   string  `toml:"function" comment:"threshold compare function, possible values: 'lt', 'lte', 'gt', 'gte'"`
+	Threshold  float64 `toml:"threshold" comment:"The rule fires when the compare function of the value and the threshold is true"`
+	Hysteresis float64 `toml:"hysteresis" comment:"A firing rule resolves only after the value moved beyond the threshold by this amount. Default: 0"`
+	Duration   float64 `toml:"duration" comment:"The condition must hold for N seconds before the rule fires. Default: 0"`
+	Severity   string  `toml:"severity" comment:"'alert' or 'warning'. Default: alert"`
+}
+
+func (r *Rule) Validate() error {
+	if r.Key == "" {
+		return fmt.Errorf("key is empty")
+	}
+
+	if _, err := compareFunc(r.Function); err != nil {
+		return err
+	}
+
+	switch r.Severity {
+	case "", SeverityAlert, SeverityWarning:
+	default:
+		return fmt.Errorf("unknown severity '%s'. Possible values: %s, %s", r.Severity, SeverityAlert, SeverityWarning)
+	}
+
+	if r.Hysteresis < 0 {
+		return fmt.Errorf("hysteresis should be equal or greater than 0.0")
+	}
+
+	if r.Duration < 0 {
+		return fmt.Errorf("duration should be equal or greater than 0.0")
+	}
+
+	return nil
+}
+
+func (r *Rule) matches(key string) bool {
+	if strings.HasSuffix(r.Key, "*") {
+		return strings.HasPrefix(key, strings.TrimSuffix(r.Key, "*"))
+	}
+	return key == r.Key
+}
+
+// resolveThreshold is the threshold a firing rule is compared with, shifted by the hysteresis to the normal range
+func (r *Rule) resolveThreshold() float64 {
+	switch r.Function {
+	case "lt", "lte":
+		return r.Threshold + r.Hysteresis
+	}
+	return r.Threshold - r.Hysteresis
+}
+
+func compareFunc(function string) (func(current, threshold float64) bool, error) {
+	switch function {
+	case "lt":
+		return func(current, threshold float64) bool {
+			return current < threshold
+		}, nil
+	case "lte":
+		return func(current, threshold float64) bool {
+			return current <= threshold
+		}, nil
+	case "gt":
+		return func(current, threshold float64) bool {
+			return current > threshold
+		}, nil
+	case "gte":
+		return func(current, threshold float64) bool {
+			return current >= threshold
+		}, nil
+	}
+	return nil, fmt.Errorf("wrong function '%s': should be one of: lt, lte, gt, gte", function)
+}
+
+// state is kept for every pair of a rule and a matching key
+type state struct {
+	rule         *Rule
+	key          string
+	pendingSince time.Time
+	firingSince  time.Time
+	value        float64
+}
+
+// Engine evaluates the rules against the measurements and keeps the state between the runs
+type Engine struct {
+	mu     sync.Mutex
+	rules  []Rule
+	states map[string]*state
+}
+
+func NewEngine(rules []Rule) *Engine {
+	return &Engine{
+		rules:  rules,
+		states: make(map[string]*state),
+	}
+}
+
+// SetRules replaces the rules, e.g. on the config reload.
+// The state of the rules which are still configured is kept, the state of the removed ones is dropped
+func (e *Engine) SetRules(rules []Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	states := make(map[string]*state)
+	for _, s := range e.states {
+		for i := range rules {
+			if rules[i] == *s.rule {
+				s.rule = &rules[i]
+				states[stateID(i, s.key)] = s
+				break
+			}
+		}
+	}
+
+	e.rules = rules
+	e.states = states
+}
+
+// Evaluate updates the state of the rules and returns the report with the firing ones.
+// Keys missing in the measurements of collectors which were not due leave the state unchanged.
+// The state of a key is dropped once its section was collected without it, e.g. of an unmounted file system
+func (e *Engine) Evaluate(measurements common.MeasurementsMap, now time.Time) *monitoring.ModuleReport {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	keys := make([]string, 0, len(measurements))
+	sections := make(map[string]bool)
+	for k := range measurements {
+		keys = append(keys, k)
+		sections[section(k)] = true
+	}
+	sort.Strings(keys)
+
+	for id, s := range e.states {
+		if _, exists := measurements[s.key]; !exists && sections[section(s.key)] {
+			delete(e.states, id)
+		}
+	}
+
+	for i := range e.rules {
+		rule := &e.rules[i]
+		compare, err := compareFunc(rule.Function)
+		if err != nil {
+			continue
+		}
+
+		for _, key := range keys {
+			if !rule.matches(key) {
+				continue
+			}
+			value, ok := common.ToFloat(measurements[key])
+			if !ok {
+				continue
+			}
+
+			id := stateID(i, key)
+			s, exists := e.states[id]
+			if !exists {
+				s = &state{rule: rule, key: key}
+				e.states[id] = s
+			}
+			s.value = value
+
+			if !s.firingSince.IsZero() {
+				if !compare(value, rule.resolveThreshold()) {
+					// resolved
+					s.firingSince = time.Time{}
+					s.pendingSince = time.Time{}
+				}
+				continue
+			}
+
+			if !compare(value, rule.Threshold) {
+				s.pendingSince = time.Time{}
+				continue
+			}
+
+			if s.pendingSince.IsZero() {
+				s.pendingSince = now
+			}
+			if now.Sub(s.pendingSince) >= common.SecToDuration(rule.Duration) {
+				s.firingSince = now
+			}
+		}
+	}
+
+	return e.report(now)
+}
+
+func (e *Engine) report(now time.Time) *monitoring.ModuleReport {
+	report := monitoring.NewReport(reportName, now, "")
+	report.Measurements = map[string]interface{}{}
+
+	ids := make([]string, 0, len(e.states))
+	for id := range e.states {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	firing := 0
+	for _, id := range ids {
+		s := e.states[id]
+		if s.firingSince.IsZero() {
+			continue
+		}
+		firing++
+
+		rule := s.rule
+		text := fmt.Sprintf("%s is %s (%s %s)", s.key, formatValue(s.value), rule.Function, formatValue(rule.Threshold))
+		if rule.Name != "" {
+			text = rule.Name + ": " + text
+		}
+		if rule.Duration > 0 {
+			text += fmt.Sprintf(" for at least %v", common.SecToDuration(rule.Duration))
+		}
+
+		if rule.Severity == SeverityWarning {
+			report.AddWarning(text)
+		} else {
+			report.AddAlert(text)
+		}
+		report.Measurements[s.key] = s.value
+	}
+	report.Measurements["firing"] = firing
+
+	return &report
+}
+
+func stateID(ruleIndex int, key string) string {
+	return fmt.Sprintf("%03d:%s", ruleIndex, key)
+}
+
+// section is the first part of the key, e.g. 'fs' for 'fs.free_percent./'
+func section(key string) string {
+	if i := strings.Index(key, "."); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+func formatValue(v float64) string {
+	return fmt.Sprintf("%.2f", v)
+}
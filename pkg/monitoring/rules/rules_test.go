@@ -0,0 +1,90 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+)
+
+func TestRuleValidate(t *testing.T) {
+	assert.NoError(t, (&Rule{Key: "mem.available_percent", Function: "lt"}).Validate())
+	assert.Error(t, (&Rule{Function: "lt"}).Validate())
+	assert.Error(t, (&Rule{Key: "mem.available_percent", Function: "lower"}).Validate())
+	assert.Error(t, (&Rule{Key: "mem.available_percent", Function: "lt", Severity: "critical"}).Validate())
+	assert.Error(t, (&Rule{Key: "mem.available_percent", Function: "lt", Duration: -1}).Validate())
+}
+
+func TestEngineEvaluate(t *testing.T) {
+	now := time.Now()
+	e := NewEngine([]Rule{
+		{Name: "disk full", Key: "fs.free_percent.*", Function: "lt", Threshold: 10, Hysteresis: 5, Duration: 300},
+		{Key: "mem.available_percent", Function: "lte", Threshold: 5, Severity: SeverityWarning},
+	})
+
+	t.Run("duration", func(t *testing.T) {
+		r := e.Evaluate(common.MeasurementsMap{"fs.free_percent./": 8.0, "fs.free_percent./home": 50.0}, now)
+		assert.Empty(t, r.Alerts, "the condition must hold for 5m")
+
+		r = e.Evaluate(common.MeasurementsMap{"fs.free_percent./": 7.0}, now.Add(5*time.Minute))
+		assert.Equal(t, 1, r.Measurements["firing"])
+		if assert.Len(t, r.Alerts, 1) {
+			assert.Equal(t, "disk full: fs.free_percent./ is 7.00 (lt 10.00) for at least 5m0s", string(r.Alerts[0]))
+		}
+	})
+
+	t.Run("missing section keeps the state", func(t *testing.T) {
+		r := e.Evaluate(common.MeasurementsMap{"cpu.load.avg.1": 0.5}, now.Add(6*time.Minute))
+		assert.Len(t, r.Alerts, 1)
+	})
+
+	t.Run("hysteresis", func(t *testing.T) {
+		r := e.Evaluate(common.MeasurementsMap{"fs.free_percent./": 12.0}, now.Add(7*time.Minute))
+		assert.Len(t, r.Alerts, 1, "still within the hysteresis")
+
+		r = e.Evaluate(common.MeasurementsMap{"fs.free_percent./": 15.0}, now.Add(8*time.Minute))
+		assert.Empty(t, r.Alerts)
+		assert.Equal(t, 0, r.Measurements["firing"])
+	})
+
+	t.Run("warning", func(t *testing.T) {
+		r := e.Evaluate(common.MeasurementsMap{"mem.available_percent": uint64(5)}, now.Add(9*time.Minute))
+		assert.Empty(t, r.Alerts)
+		if assert.Len(t, r.Warnings, 1) {
+			assert.Equal(t, "mem.available_percent is 5.00 (lte 5.00)", string(r.Warnings[0]))
+		}
+	})
+}
+
+func TestEngineDropsState(t *testing.T) {
+	now := time.Now()
+	rules := []Rule{
+		{Key: "fs.free_percent.*", Function: "lt", Threshold: 10},
+		{Key: "mem.available_percent", Function: "lt", Threshold: 5},
+	}
+	e := NewEngine(rules)
+
+	r := e.Evaluate(common.MeasurementsMap{"fs.free_percent./mnt": 1.0, "fs.free_percent./": 50.0, "mem.available_percent": 1.0}, now)
+	assert.Len(t, r.Alerts, 2)
+
+	t.Run("vanished key", func(t *testing.T) {
+		r := e.Evaluate(common.MeasurementsMap{"fs.free_percent./": 50.0}, now.Add(time.Minute))
+		if assert.Len(t, r.Alerts, 1) {
+			assert.Equal(t, "mem.available_percent is 1.00 (lt 5.00)", string(r.Alerts[0]))
+		}
+	})
+
+	t.Run("removed rule", func(t *testing.T) {
+		e.SetRules([]Rule{{Key: "cpu.load.avg.1", Function: "gt", Threshold: 10}, rules[1]})
+		r := e.Evaluate(common.MeasurementsMap{}, now.Add(2*time.Minute))
+		if assert.Len(t, r.Alerts, 1, "the state of the kept rule is preserved") {
+			assert.Equal(t, "mem.available_percent is 1.00 (lt 5.00)", string(r.Alerts[0]))
+		}
+
+		e.SetRules(rules[:1])
+		r = e.Evaluate(common.MeasurementsMap{}, now.Add(3*time.Minute))
+		assert.Empty(t, r.Alerts)
+	})
+}
@@ -14,12 +14,8 @@ import (
 	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
 )
 
-const cacheExpirationDuration = 30 * time.Minute
-
 type StorCLI struct {
-	binaryPath     string
-	lastRunAt      time.Time
-	lastRunReports []*monitoring.ModuleReport
+	binaryPath string
 }
 
 func CreateModule(binaryPath string) monitoring.Module {
@@ -36,10 +32,6 @@ func (s *StorCLI) Run() ([]*monitoring.ModuleReport, error) {
 	}
 
 	now := time.Now()
-	if !s.lastRunAt.IsZero() && (now.Sub(s.lastRunAt) < cacheExpirationDuration) {
-		return s.lastRunReports, nil
-	}
-
 	reports := make([]*monitoring.ModuleReport, 0)
 	cmdLineStr := s.getCommandLineCombined()
 	cmdExecReport := monitoring.NewReport("storecli execution for hardware raid health", now, cmdLineStr)
@@ -102,9 +94,6 @@ func (s *StorCLI) Run() ([]*monitoring.ModuleReport, error) {
 		}
 	}
 
-	s.lastRunReports = reports
-	s.lastRunAt = now
-
 	return reports, nil
 }
 
@@ -0,0 +1,162 @@
+package webstatus
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+)
+
+type ApacheConfig struct {
+	Enabled           bool    `toml:"enabled" comment:"Set 'true' to enable the Apache monitoring"`
+	URL               string  `toml:"url" comment:"URL of the mod_status page in the machine readable format"`
+	Timeout           float64 `toml:"timeout" comment:"Time limit in seconds to fetch the status page. Default: 5"`
+	MaxWorkers        int64   `toml:"max_workers" comment:"MaxRequestWorkers of Apache. Set to 0 to compare with the started workers, that's busy + idle workers"`
+	SaturationPercent float64 `toml:"saturation_percent" comment:"Warn if the busy workers exceed N percent of max_workers. Set to 0 to not check the saturation"`
+}
+
+func (cfg *ApacheConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.MaxWorkers < 0 {
+		return fmt.Errorf("max_workers should be equal or greater than 0")
+	}
+	return validate(cfg.URL, cfg.Timeout, cfg.SaturationPercent)
+}
+
+// ApacheStatus is the content of the server-status?auto page
+type ApacheStatus struct {
+	// Extended is false with ExtendedStatus Off, TotalAccesses and TotalKBytes are missing then
+	Extended      bool
+	TotalAccesses int64
+	TotalKBytes   int64
+	BusyWorkers   int64
+	IdleWorkers   int64
+	// Connections is reported by the event MPM only, -1 otherwise
+	Connections int64
+}
+
+func parseApacheStatus(body string) (*ApacheStatus, error) {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(body, "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 {
+			fields[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	// the scoreboard has slots up to ServerLimit * ThreadsPerChild, that's not the number of usable workers
+	if _, exists := fields["Scoreboard"]; !exists {
+		return nil, fmt.Errorf("unexpected server-status format, make sure the URL ends with ?auto")
+	}
+
+	_, extended := fields["Total Accesses"]
+	status := &ApacheStatus{
+		Extended:    extended,
+		Connections: -1,
+	}
+
+	for key, dest := range map[string]*int64{
+		"Total Accesses": &status.TotalAccesses,
+		"Total kBytes":   &status.TotalKBytes,
+		"BusyWorkers":    &status.BusyWorkers,
+		"IdleWorkers":    &status.IdleWorkers,
+		"ConnsTotal":     &status.Connections,
+	} {
+		val, exists := fields[key]
+		if !exists {
+			// Total Accesses and Total kBytes are missing with ExtendedStatus Off
+			continue
+		}
+		v, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%s'", key, val)
+		}
+		*dest = v
+	}
+
+	return status, nil
+}
+
+func CreateApacheModule(config *ApacheConfig) monitoring.Module {
+	return &Apache{
+		config: config,
+	}
+}
+
+type Apache struct {
+	config *ApacheConfig
+
+	lastStatus     *ApacheStatus
+	lastStatusTime time.Time
+}
+
+func (a *Apache) GetDescription() string {
+	return fmt.Sprintf("Apache status for %s", a.config.URL)
+}
+
+func (a *Apache) IsEnabled() bool {
+	return a.config.Enabled
+}
+
+func (a *Apache) Run() ([]*monitoring.ModuleReport, error) {
+	report := monitoring.NewReport(
+		fmt.Sprintf("Apache status for %s", a.config.URL),
+		time.Now(),
+		"",
+	)
+
+	statusTime := time.Now()
+	body, err := fetch(a.config.URL, a.config.Timeout)
+	if err != nil {
+		report.AddAlert(fmt.Sprintf("failed to get status: %s", err.Error()))
+		return []*monitoring.ModuleReport{&report}, nil
+	}
+
+	status, err := parseApacheStatus(body)
+	if err != nil {
+		log.WithError(err).Debugf("server-status: %s", body)
+		report.AddAlert(fmt.Sprintf("failed to parse status: %s", err.Error()))
+		return []*monitoring.ModuleReport{&report}, nil
+	}
+
+	maxWorkers := a.config.MaxWorkers
+	if maxWorkers == 0 {
+		maxWorkers = status.BusyWorkers + status.IdleWorkers
+	}
+
+	report.Measurements = map[string]interface{}{
+		"Busy workers":  status.BusyWorkers,
+		"Idle workers":  status.IdleWorkers,
+		"Total workers": maxWorkers,
+	}
+	if status.Connections >= 0 {
+		report.Measurements["Active connections"] = status.Connections
+	}
+
+	if a.lastStatus == nil || !status.Extended || !a.lastStatus.Extended {
+		// need one more iteration to calculate the rates, the counters are missing with ExtendedStatus Off
+		report.Measurements["Requests per sec"] = nil
+		report.Measurements["Bytes per sec"] = nil
+	} else {
+		sec := statusTime.Sub(a.lastStatusTime).Seconds()
+		report.Measurements["Requests per sec"] = common.FormatPerSec(status.TotalAccesses, a.lastStatus.TotalAccesses, sec)
+		report.Measurements["Bytes per sec"] = common.FormatPerSec(status.TotalKBytes*1024, a.lastStatus.TotalKBytes*1024, sec)
+	}
+	a.lastStatus = status
+	a.lastStatusTime = statusTime
+
+	if maxWorkers > 0 {
+		percent := float64(status.BusyWorkers) / float64(maxWorkers) * 100
+		report.Measurements["Busy workers percent"] = common.RoundToTwoDecimalPlaces(percent)
+		if a.config.SaturationPercent > 0 && percent >= a.config.SaturationPercent {
+			report.AddWarning(fmt.Sprintf("%d of %d workers busy (%.2f%%)", status.BusyWorkers, maxWorkers, percent))
+		}
+	}
+
+	return []*monitoring.ModuleReport{&report}, nil
+}
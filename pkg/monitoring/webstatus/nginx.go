@@ -0,0 +1,148 @@
+package webstatus
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+)
+
+type NginxConfig struct {
+	Enabled           bool    `toml:"enabled" comment:"Set 'true' to enable the nginx monitoring"`
+	URL               string  `toml:"url" comment:"URL of the stub_status page"`
+	Timeout           float64 `toml:"timeout" comment:"Time limit in seconds to fetch the status page. Default: 5"`
+	MaxConnections    int64   `toml:"max_connections" comment:"Maximum number of connections, that's worker_processes * worker_connections. Set to 0 to not check the saturation"`
+	SaturationPercent float64 `toml:"saturation_percent" comment:"Warn if the active connections exceed N percent of max_connections"`
+}
+
+func (cfg *NginxConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.MaxConnections < 0 {
+		return fmt.Errorf("max_connections should be equal or greater than 0")
+	}
+	return validate(cfg.URL, cfg.Timeout, cfg.SaturationPercent)
+}
+
+var (
+	nginxActiveRegex   = regexp.MustCompile(`Active connections:\s*(\d+)`)
+	nginxCountersRegex = regexp.MustCompile(`(?m)^\s*server accepts handled requests\s*\n\s*(\d+)\s+(\d+)\s+(\d+)\s*$`)
+	nginxStatesRegex   = regexp.MustCompile(`Reading:\s*(\d+)\s+Writing:\s*(\d+)\s+Waiting:\s*(\d+)`)
+)
+
+// NginxStatus is the content of the stub_status page
+type NginxStatus struct {
+	Active   int64
+	Accepts  int64
+	Handled  int64
+	Requests int64
+	Reading  int64
+	Writing  int64
+	Waiting  int64
+}
+
+func parseNginxStatus(body string) (*NginxStatus, error) {
+	active := nginxActiveRegex.FindStringSubmatch(body)
+	counters := nginxCountersRegex.FindStringSubmatch(body)
+	states := nginxStatesRegex.FindStringSubmatch(body)
+	if active == nil || counters == nil || states == nil {
+		return nil, fmt.Errorf("unexpected stub_status format")
+	}
+
+	var values []int64
+	for _, s := range append(append(active[1:], counters[1:]...), states[1:]...) {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	return &NginxStatus{
+		Active:   values[0],
+		Accepts:  values[1],
+		Handled:  values[2],
+		Requests: values[3],
+		Reading:  values[4],
+		Writing:  values[5],
+		Waiting:  values[6],
+	}, nil
+}
+
+func CreateNginxModule(config *NginxConfig) monitoring.Module {
+	return &Nginx{
+		config: config,
+	}
+}
+
+type Nginx struct {
+	config *NginxConfig
+
+	lastStatus     *NginxStatus
+	lastStatusTime time.Time
+}
+
+func (n *Nginx) GetDescription() string {
+	return fmt.Sprintf("nginx status for %s", n.config.URL)
+}
+
+func (n *Nginx) IsEnabled() bool {
+	return n.config.Enabled
+}
+
+func (n *Nginx) Run() ([]*monitoring.ModuleReport, error) {
+	report := monitoring.NewReport(
+		fmt.Sprintf("nginx status for %s", n.config.URL),
+		time.Now(),
+		"",
+	)
+
+	statusTime := time.Now()
+	body, err := fetch(n.config.URL, n.config.Timeout)
+	if err != nil {
+		report.AddAlert(fmt.Sprintf("failed to get status: %s", err.Error()))
+		return []*monitoring.ModuleReport{&report}, nil
+	}
+
+	status, err := parseNginxStatus(body)
+	if err != nil {
+		log.WithError(err).Debugf("stub_status: %s", body)
+		report.AddAlert(fmt.Sprintf("failed to parse status: %s", err.Error()))
+		return []*monitoring.ModuleReport{&report}, nil
+	}
+
+	report.Measurements = map[string]interface{}{
+		"Active connections": status.Active,
+		"Reading":            status.Reading,
+		"Writing":            status.Writing,
+		"Waiting":            status.Waiting,
+	}
+
+	if n.lastStatus == nil {
+		// need one more iteration to calculate the rates
+		report.Measurements["Requests per sec"] = nil
+		report.Measurements["Accepted connections per sec"] = nil
+		report.Measurements["Dropped connections per sec"] = nil
+	} else {
+		sec := statusTime.Sub(n.lastStatusTime).Seconds()
+		report.Measurements["Requests per sec"] = common.FormatPerSec(status.Requests, n.lastStatus.Requests, sec)
+		report.Measurements["Accepted connections per sec"] = common.FormatPerSec(status.Accepts, n.lastStatus.Accepts, sec)
+		report.Measurements["Dropped connections per sec"] = common.FormatPerSec(status.Accepts-status.Handled, n.lastStatus.Accepts-n.lastStatus.Handled, sec)
+	}
+	n.lastStatus = status
+	n.lastStatusTime = statusTime
+
+	if n.config.MaxConnections > 0 {
+		percent := float64(status.Active) / float64(n.config.MaxConnections) * 100
+		report.Measurements["Connections percent"] = common.RoundToTwoDecimalPlaces(percent)
+		if n.config.SaturationPercent > 0 && percent >= n.config.SaturationPercent {
+			report.AddWarning(fmt.Sprintf("%d of %d connections in use (%.2f%%)", status.Active, n.config.MaxConnections, percent))
+		}
+	}
+
+	return []*monitoring.ModuleReport{&report}, nil
+}
@@ -0,0 +1,66 @@
+package webstatus
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+
+	// the status pages are small, anything bigger is not a status page
+	maxBodySize = 1024 * 1024
+)
+
+var log = logrus.WithField("package", "webstatus")
+
+func validate(statusURL string, timeout, saturationPercent float64) error {
+	u, err := url.Parse(statusURL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %s", err.Error())
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url must start with http:// or https://")
+	}
+
+	if timeout < 0 {
+		return fmt.Errorf("timeout should be equal or greater than 0.0")
+	}
+
+	if saturationPercent < 0 || saturationPercent > 100 {
+		return fmt.Errorf("saturation_percent should be between 0 and 100")
+	}
+
+	return nil
+}
+
+// fetch returns the body of the status page
+func fetch(statusURL string, timeout float64) (string, error) {
+	client := http.Client{Timeout: defaultTimeout}
+	if timeout > 0 {
+		client.Timeout = time.Duration(timeout * float64(time.Second))
+	}
+
+	resp, err := client.Get(statusURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		return "", fmt.Errorf("%s returned %s", statusURL, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
@@ -0,0 +1,130 @@
+package webstatus
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/moduletest"
+)
+
+func TestNginx(t *testing.T) {
+	requests := 31070465
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests += 100
+		fmt.Fprintf(w, "Active connections: 291 \nserver accepts handled requests\n 16630948 16630940 %d \nReading: 6 Writing: 179 Waiting: 106 \n", requests)
+	}))
+	defer srv.Close()
+
+	m := CreateNginxModule(&NginxConfig{Enabled: true, URL: srv.URL, MaxConnections: 300, SaturationPercent: 90})
+	measurements, alerts, warnings := moduletest.Run(t, m)
+	assert.Empty(t, alerts)
+	assert.Equal(t, []string{"291 of 300 connections in use (97.00%)"}, warnings)
+	assert.Equal(t, int64(291), measurements["Active connections"])
+	assert.Equal(t, int64(6), measurements["Reading"])
+	assert.Equal(t, int64(179), measurements["Writing"])
+	assert.Equal(t, int64(106), measurements["Waiting"])
+	assert.Nil(t, measurements["Requests per sec"])
+
+	measurements, _, _ = moduletest.Run(t, m)
+	assert.True(t, measurements["Requests per sec"].(float64) > 0)
+	assert.Equal(t, 0.0, measurements["Dropped connections per sec"])
+}
+
+func TestParseNginxStatus(t *testing.T) {
+	status, err := parseNginxStatus("Active connections: 2 \r\nserver accepts handled requests\r\n 10 9 30 \r\nReading: 0 Writing: 1 Waiting: 1 \r\n")
+	assert.NoError(t, err)
+	assert.Equal(t, &NginxStatus{Active: 2, Accepts: 10, Handled: 9, Requests: 30, Reading: 0, Writing: 1, Waiting: 1}, status)
+
+	// a page which only looks similar, e.g. an error page of a proxy, is rejected
+	_, err = parseNginxStatus("Active connections: 2 \nerror 502 3 4 \nReading: 0 Writing: 1 Waiting: 1 \n")
+	assert.Error(t, err)
+}
+
+func TestApache(t *testing.T) {
+	accesses := 1520
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accesses += 100
+		fmt.Fprintf(w, "localhost\nServerVersion: Apache/2.4.41 (Ubuntu)\nTotal Accesses: %d\nTotal kBytes: 2048\n"+
+			"ConnsTotal: 3\nBusyWorkers: 2\nIdleWorkers: 6\nScoreboard: __W_K___....\n", accesses)
+	}))
+	defer srv.Close()
+
+	m := CreateApacheModule(&ApacheConfig{Enabled: true, URL: srv.URL + "/server-status?auto", SaturationPercent: 90})
+	measurements, alerts, warnings := moduletest.Run(t, m)
+	assert.Empty(t, alerts)
+	assert.Empty(t, warnings)
+	assert.Equal(t, int64(2), measurements["Busy workers"])
+	assert.Equal(t, int64(6), measurements["Idle workers"])
+	assert.Equal(t, int64(8), measurements["Total workers"])
+	assert.Equal(t, int64(3), measurements["Active connections"])
+	assert.Equal(t, 25.0, measurements["Busy workers percent"])
+	assert.Nil(t, measurements["Requests per sec"])
+
+	measurements, _, _ = moduletest.Run(t, m)
+	assert.True(t, measurements["Requests per sec"].(float64) > 0)
+	assert.Equal(t, 0.0, measurements["Bytes per sec"])
+
+	t.Run("extended status off", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "BusyWorkers: 2\nIdleWorkers: 6\nScoreboard: __W_K___\n")
+		}))
+		defer srv.Close()
+
+		m := CreateApacheModule(&ApacheConfig{Enabled: true, URL: srv.URL})
+		moduletest.Run(t, m)
+		measurements, _, _ := moduletest.Run(t, m)
+		assert.Nil(t, measurements["Requests per sec"])
+		assert.Nil(t, measurements["Bytes per sec"])
+	})
+
+	t.Run("saturated", func(t *testing.T) {
+		status, err := parseApacheStatus("BusyWorkers: 10\nIdleWorkers: 0\nScoreboard: WWWWWWWWWW......\n")
+		assert.NoError(t, err)
+		assert.False(t, status.Extended)
+		assert.Equal(t, int64(-1), status.Connections)
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "BusyWorkers: 10\nIdleWorkers: 0\nScoreboard: WWWWWWWWWW......\n")
+		}))
+		defer srv.Close()
+
+		_, _, warnings := moduletest.Run(t, CreateApacheModule(&ApacheConfig{Enabled: true, URL: srv.URL, SaturationPercent: 90}))
+		assert.Equal(t, []string{"10 of 10 workers busy (100.00%)"}, warnings)
+
+		measurements, _, warnings := moduletest.Run(t, CreateApacheModule(&ApacheConfig{Enabled: true, URL: srv.URL, MaxWorkers: 20, SaturationPercent: 90}))
+		assert.Empty(t, warnings)
+		assert.Equal(t, int64(20), measurements["Total workers"])
+		assert.Equal(t, 50.0, measurements["Busy workers percent"])
+	})
+
+	t.Run("html page", func(t *testing.T) {
+		_, err := parseApacheStatus("<html><body>Apache Server Status</body></html>")
+		assert.Error(t, err)
+	})
+}
+
+func TestFailures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/forbidden" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, "It works!")
+	}))
+	defer srv.Close()
+
+	_, alerts, _ := moduletest.Run(t, CreateNginxModule(&NginxConfig{Enabled: true, URL: srv.URL + "/forbidden"}))
+	assert.Len(t, alerts, 1)
+
+	_, alerts, _ = moduletest.Run(t, CreateNginxModule(&NginxConfig{Enabled: true, URL: srv.URL}))
+	assert.Equal(t, []string{"failed to parse status: unexpected stub_status format"}, alerts)
+
+	assert.Error(t, (&NginxConfig{Enabled: true, URL: "127.0.0.1/nginx_status"}).Validate())
+	assert.Error(t, (&ApacheConfig{Enabled: true, URL: "http://127.0.0.1/server-status?auto", SaturationPercent: 120}).Validate())
+	assert.Error(t, (&ApacheConfig{Enabled: true, URL: "http://127.0.0.1/server-status?auto", MaxWorkers: -1}).Validate())
+	assert.NoError(t, (&ApacheConfig{URL: "invalid"}).Validate())
+}
@@ -0,0 +1,255 @@
+package outbox
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	outboxDirPermissions   = 0755
+	outboxEntryPermissions = 0600
+	jsonExtension          = "json"
+	tmpExtension           = "tmp"
+)
+
+var log = logrus.WithField("package", "outbox")
+
+// Entry describes a single payload stored in the outbox
+type Entry struct {
+	ID        string
+	Timestamp int64
+	Size      int64
+}
+
+// Outbox is a durable on-disk queue of payloads which failed to be delivered.
+// Entries are kept in a flat directory, one file per payload, named after the payload timestamp
+// so they can be replayed in the order they were collected.
+type Outbox struct {
+	dirPath      string
+	maxSizeBytes int64
+	maxAge       time.Duration
+
+	mu sync.Mutex
+}
+
+// New creates a new object to manage the outbox dir
+// dirPath must be absolute path. maxSizeBytes and maxAge limits are not applied when set to 0
+func New(dirPath string, maxSizeBytes int64, maxAge time.Duration) *Outbox {
+	return &Outbox{
+		dirPath:      dirPath,
+		maxSizeBytes: maxSizeBytes,
+		maxAge:       maxAge,
+	}
+}
+
+// Put stores the payload collected at timestamp (unix seconds)
+// oldest entries are dropped to keep the outbox within the configured limits
+func (o *Outbox) Put(timestamp int64, payload []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	err := o.ensureDirExists()
+	if err != nil {
+		return err
+	}
+
+	id := fmt.Sprintf("%d_%d", timestamp, time.Now().UnixNano())
+	tmpPath := o.getFilePath(id, tmpExtension)
+	err = ioutil.WriteFile(tmpPath, payload, outboxEntryPermissions)
+	if err != nil {
+		return errors.Wrapf(err, "can not write outbox entry %s", tmpPath)
+	}
+
+	// rename is atomic, so a crash never leaves a partially written entry behind
+	err = os.Rename(tmpPath, o.getFilePath(id, jsonExtension))
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return errors.Wrapf(err, "can not finalize outbox entry %s", id)
+	}
+
+	return o.enforceLimits()
+}
+
+// Entries returns all non-expired entries sorted by timestamp, oldest first
+func (o *Outbox) Entries() ([]Entry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	err := o.removeExpired()
+	if err != nil {
+		return nil, err
+	}
+
+	return o.list()
+}
+
+// Read returns the payload of the entry with specified id
+func (o *Outbox) Read(id string) ([]byte, error) {
+	path := o.getFilePath(id, jsonExtension)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while reading outbox entry %s", path)
+	}
+	return b, nil
+}
+
+// Remove deletes the entry with specified id. It ignores error if entry already deleted
+func (o *Outbox) Remove(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return removeFile(o.getFilePath(id, jsonExtension))
+}
+
+func (o *Outbox) list() ([]Entry, error) {
+	pattern := fmt.Sprintf("%s/*.%s", o.dirPath, jsonExtension)
+	fileNames, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "while searching %s", pattern)
+	}
+
+	entries := make([]Entry, 0, len(fileNames))
+	for _, f := range fileNames {
+		id := strings.TrimSuffix(filepath.Base(f), "."+jsonExtension)
+		ts, ok := parseEntryTimestamp(id)
+		if !ok {
+			log.Warnf("skipping unexpected file in outbox dir: %s", f)
+			continue
+		}
+
+		info, err := os.Stat(f)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, errors.Wrapf(err, "while checking outbox entry %s", f)
+		}
+
+		entries = append(entries, Entry{ID: id, Timestamp: ts, Size: info.Size()})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Timestamp == entries[j].Timestamp {
+			return entries[i].ID < entries[j].ID
+		}
+		return entries[i].Timestamp < entries[j].Timestamp
+	})
+
+	return entries, nil
+}
+
+func (o *Outbox) removeExpired() error {
+	if o.maxAge <= 0 {
+		return nil
+	}
+
+	entries, err := o.list()
+	if err != nil {
+		return err
+	}
+
+	oldestAllowed := time.Now().Add(-o.maxAge).Unix()
+	for _, e := range entries {
+		if e.Timestamp >= oldestAllowed {
+			break
+		}
+
+		log.Infof("dropping outbox entry %s: older than %v", e.ID, o.maxAge)
+		err = removeFile(o.getFilePath(e.ID, jsonExtension))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *Outbox) enforceLimits() error {
+	err := o.removeExpired()
+	if err != nil {
+		return err
+	}
+
+	if o.maxSizeBytes <= 0 {
+		return nil
+	}
+
+	entries, err := o.list()
+	if err != nil {
+		return err
+	}
+
+	var totalSize int64
+	for _, e := range entries {
+		totalSize += e.Size
+	}
+
+	for _, e := range entries {
+		if totalSize <= o.maxSizeBytes {
+			break
+		}
+
+		log.Infof("dropping outbox entry %s: outbox size limit of %d bytes exceeded", e.ID, o.maxSizeBytes)
+		err = removeFile(o.getFilePath(e.ID, jsonExtension))
+		if err != nil {
+			return err
+		}
+		totalSize -= e.Size
+	}
+
+	return nil
+}
+
+func (o *Outbox) ensureDirExists() error {
+	_, err := os.Stat(o.dirPath)
+	if os.IsNotExist(err) {
+		err = os.MkdirAll(o.dirPath, outboxDirPermissions)
+		if err != nil {
+			return errors.Wrapf(
+				err,
+				"could not create outbox dir %s. Please check you have enough rights or try create the dir manually",
+				o.dirPath,
+			)
+		}
+	} else if err != nil {
+		err = errors.Wrapf(err, "while checking outbox dir %s exists", o.dirPath)
+	}
+	return err
+}
+
+func (o *Outbox) getFilePath(id, extension string) string {
+	return filepath.Join(o.dirPath, fmt.Sprintf("%s.%s", id, extension))
+}
+
+func parseEntryTimestamp(id string) (int64, bool) {
+	parts := strings.SplitN(id, "_", 2)
+	if len(parts) != 2 {
+		return 0, false
+	}
+
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return ts, true
+}
+
+// removeFile ignores error if file already deleted or not exists
+func removeFile(path string) error {
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "while removing %s", path)
+	}
+	return nil
+}
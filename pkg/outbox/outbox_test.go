@@ -0,0 +1,86 @@
+package outbox
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func helperCreateOutbox(t *testing.T, maxSizeBytes int64, maxAge time.Duration) (*Outbox, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "outbox")
+	assert.NoError(t, err)
+
+	return New(filepath.Join(dir, "outbox"), maxSizeBytes, maxAge), func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestOutboxEntriesOrder(t *testing.T) {
+	o, cleanup := helperCreateOutbox(t, 0, 0)
+	defer cleanup()
+
+	now := time.Now().Unix()
+	assert.NoError(t, o.Put(now-10, []byte("second")))
+	assert.NoError(t, o.Put(now-20, []byte("first")))
+	assert.NoError(t, o.Put(now, []byte("third")))
+
+	entries, err := o.Entries()
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 3) {
+		for i, expected := range []string{"first", "second", "third"} {
+			b, err := o.Read(entries[i].ID)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, string(b))
+		}
+	}
+
+	assert.NoError(t, o.Remove(entries[0].ID))
+	assert.NoError(t, o.Remove(entries[0].ID), "removing already removed entry should not fail")
+
+	entries, err = o.Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestOutboxLimits(t *testing.T) {
+	t.Run("max-size", func(t *testing.T) {
+		o, cleanup := helperCreateOutbox(t, 10, 0)
+		defer cleanup()
+
+		now := time.Now().Unix()
+		assert.NoError(t, o.Put(now-2, []byte("aaaa")))
+		assert.NoError(t, o.Put(now-1, []byte("bbbb")))
+		assert.NoError(t, o.Put(now, []byte("cccc")))
+
+		entries, err := o.Entries()
+		assert.NoError(t, err)
+		if assert.Len(t, entries, 2) {
+			b, err := o.Read(entries[0].ID)
+			assert.NoError(t, err)
+			assert.Equal(t, "bbbb", string(b))
+		}
+	})
+
+	t.Run("max-age", func(t *testing.T) {
+		o, cleanup := helperCreateOutbox(t, 0, time.Hour)
+		defer cleanup()
+
+		now := time.Now().Unix()
+		assert.NoError(t, o.Put(now-7200, []byte("expired")))
+		assert.NoError(t, o.Put(now, []byte("fresh")))
+
+		entries, err := o.Entries()
+		assert.NoError(t, err)
+		if assert.Len(t, entries, 1) {
+			b, err := o.Read(entries[0].ID)
+			assert.NoError(t, err)
+			assert.Equal(t, "fresh", string(b))
+		}
+	})
+}
@@ -3,11 +3,14 @@ package cagent
 import (
 	"fmt"
 	"syscall"
+	"time"
 
 	"github.com/shirou/gopsutil/net"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/cloudradar-monitoring/cagent/pkg/common"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/portpolicy"
 	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/processes"
 )
 
@@ -16,6 +19,8 @@ type PortStat struct {
 	LocalAddress string `json:"addr"`
 	PID          int32  `json:"pid,omitempty"`
 	ProgramName  string `json:"program,omitempty"`
+	// connected sockets, e.g. of UDP clients, are not listeners
+	connected bool
 }
 
 // PortsResult lists all active connections
@@ -50,6 +55,7 @@ func (ca *Cagent) PortsResult(processList []*processes.ProcStat) (common.Measure
 			LocalAddress: formatNetAddr(&conn.Laddr),
 			PID:          conn.Pid,
 			ProgramName:  programName,
+			connected:    conn.Raddr.Port != 0,
 		})
 	}
 
@@ -58,6 +64,30 @@ func (ca *Cagent) PortsResult(processList []*processes.ProcStat) (common.Measure
 	return common.MeasurementsMap{"list": ports}, nil
 }
 
+// evaluatePortsPolicy appends the report of the listening ports policy to the module reports
+func (ca *Cagent) evaluatePortsPolicy(measurements common.MeasurementsMap, ports []PortStat, now time.Time) {
+	if ca.portsPolicy == nil {
+		ca.portsPolicy = portpolicy.NewPolicy(&ca.Config.ListeningPortsPolicy)
+	}
+
+	listeners := make([]portpolicy.Listener, 0, len(ports))
+	for _, p := range ports {
+		if p.connected {
+			continue
+		}
+		listeners = append(listeners, portpolicy.Listener{
+			Protocol: p.Protocol,
+			Address:  p.LocalAddress,
+			Program:  p.ProgramName,
+		})
+	}
+
+	report := ca.portsPolicy.Evaluate(listeners, now)
+
+	reports, _ := measurements["modules"].([]*monitoring.ModuleReport)
+	measurements["modules"] = append(reports, report)
+}
+
 func formatNetAddr(addr *net.Addr) string {
 	return fmt.Sprintf("%s:%d", addr.IP, addr.Port)
 }
@@ -0,0 +1,99 @@
+package cagent
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/export"
+)
+
+const prometheusShutdownTimeout = 5 * time.Second
+
+// prometheusExporter serves the most recent measurements in the Prometheus text format
+type prometheusExporter struct {
+	server *http.Server
+
+	mu         sync.RWMutex
+	lastResult *Result
+}
+
+// StartPrometheusExporter starts serving the metrics if io_mode or one of the outputs is "prometheus".
+// Unlike pushing sinks there is nothing to retry for the pull-based exporter, so a failure to listen is reported once here
+func (ca *Cagent) StartPrometheusExporter() error {
+	if !ca.Config.usesPrometheus() {
+		return nil
+	}
+
+	_, err := ca.getPrometheusExporter()
+	return err
+}
+
+// getPrometheusExporter starts listening on the first call
+func (ca *Cagent) getPrometheusExporter() (*prometheusExporter, error) {
+	if ca.prometheusExporter != nil {
+		return ca.prometheusExporter, nil
+	}
+
+	listener, err := net.Listen("tcp", ca.Config.Prometheus.Listen)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen on %s for prometheus metrics", ca.Config.Prometheus.Listen)
+	}
+
+	pe := &prometheusExporter{}
+	mux := http.NewServeMux()
+	mux.Handle(ca.Config.Prometheus.Path, pe)
+	pe.server = &http.Server{Handler: mux}
+
+	go func() {
+		err := pe.server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Error("prometheus metrics server stopped")
+		}
+	}()
+
+	log.Infof("serving prometheus metrics on http://%s%s", listener.Addr().String(), ca.Config.Prometheus.Path)
+	ca.prometheusExporter = pe
+	return pe, nil
+}
+
+func (pe *prometheusExporter) update(result *Result) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+
+	pe.lastResult = result
+}
+
+func (pe *prometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pe.mu.RLock()
+	result := pe.lastResult
+	pe.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if result == nil {
+		// nothing collected yet
+		return
+	}
+
+	samples := export.Samples(result.Measurements)
+	samples = append(samples, export.Sample{Group: "cagent", Field: "last_collection_timestamp_seconds", Value: float64(result.Timestamp)})
+
+	err := export.WritePrometheus(w, samples)
+	if err != nil {
+		log.WithError(err).Debug("failed to write prometheus metrics")
+	}
+}
+
+func (pe *prometheusExporter) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), prometheusShutdownTimeout)
+	defer cancel()
+
+	if err := pe.server.Shutdown(ctx); err != nil {
+		log.WithError(err).Warn("failed to shutdown prometheus metrics server")
+	}
+}
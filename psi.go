@@ -0,0 +1,13 @@
+package cagent
+
+import (
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/psi"
+)
+
+func (ca *Cagent) PSIWatcher() *psi.Watcher {
+	if ca.psiWatcher == nil {
+		ca.psiWatcher = psi.NewWatcher(&ca.Config.PSIMonitoring)
+	}
+
+	return ca.psiWatcher
+}
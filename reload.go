@@ -0,0 +1,109 @@
+package cagent
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/smart"
+)
+
+// reloadWaitTimeout is the time to wait for the collectors which are still running after their timeout
+var reloadWaitTimeout = 10 * time.Second
+
+// ReloadConfig reads and validates the config file again and swaps it in.
+// If the new config is invalid or a collector which timed out is still running, the current one stays in force.
+// The state of the CPU watcher and the CPU utilisation analyser is preserved, so changes of the CPU settings require a restart
+func (ca *Cagent) ReloadConfig() error {
+	// HandleAllConfigSetup creates the default config if the file is missing, that's not desired here
+	if _, err := os.Stat(ca.ConfigLocation); err != nil {
+		return errors.Wrap(err, "keeping the current config")
+	}
+
+	cfg, err := HandleAllConfigSetup(ca.ConfigLocation)
+	if err != nil {
+		return errors.Wrap(err, "keeping the current config")
+	}
+
+	ca.configMu.Lock()
+
+	// a collector which timed out keeps running with the current config and watchers, so they are not swapped under it.
+	// No new collection is started meanwhile, that requires the lock
+	if running := ca.schedule.waitIdle(reloadWaitTimeout); len(running) > 0 {
+		ca.configMu.Unlock()
+		return errors.Errorf("keeping the current config: collectors %s are still running", strings.Join(running, ", "))
+	}
+
+	oldCfg := ca.Config
+	// the main loop is not running in heartbeat mode
+	if (oldCfg.OperationMode == OperationModeHeartbeat) != (cfg.OperationMode == OperationModeHeartbeat) {
+		log.Warnf("operation_mode change from '%s' to '%s' takes effect after a restart", oldCfg.OperationMode, cfg.OperationMode)
+		cfg.OperationMode = oldCfg.OperationMode
+	}
+
+	ca.Config = cfg
+	ca.SetLogLevel(cfg.LogLevel)
+
+	// watchers and modules are created lazily with the new config on the next run
+	ca.fsWatcher = nil
+	ca.netWatcher = nil
+	ca.dockerWatcher = nil
+	ca.psiWatcher = nil
+	oldModules := ca.modules
+	ca.modules = nil
+	ca.outbox = nil
+
+	// the state of the rules which are still configured is kept
+	if ca.rulesEngine != nil && !reflect.DeepEqual(oldCfg.Rules, cfg.Rules) {
+		ca.rulesEngine.SetRules(cfg.Rules)
+	}
+	if !reflect.DeepEqual(oldCfg.ListeningPortsPolicy, cfg.ListeningPortsPolicy) {
+		ca.portsPolicy = nil
+	}
+	if !reflect.DeepEqual(oldCfg.ProcessWatchlist, cfg.ProcessWatchlist) {
+		ca.watchlist = nil
+	}
+
+	ca.hubClient = nil
+	ca.hubClientOnce = sync.Once{}
+
+	ca.smart = nil
+	if cfg.SMARTMonitoring && cfg.SMARTCtl != "" {
+		ca.smart, err = smart.New(smart.Executable(cfg.SMARTCtl, false))
+		if err != nil {
+			log.Error(err.Error())
+		}
+	}
+
+	if ca.prometheusExporter != nil && (!cfg.usesPrometheus() || !reflect.DeepEqual(oldCfg.Prometheus, cfg.Prometheus)) {
+		ca.prometheusExporter.shutdown()
+		ca.prometheusExporter = nil
+	}
+	if err = ca.StartPrometheusExporter(); err != nil {
+		log.WithError(err).Error()
+	}
+
+	ca.configMu.Unlock()
+
+	// closing waits for the queries in progress, e.g. of a module which timed out, so it's done in the background
+	go closeModules(oldModules)
+
+	// the status API handlers read the config, so it's restarted without holding the lock
+	if !reflect.DeepEqual(oldCfg.StatusAPI, cfg.StatusAPI) {
+		if ca.statusAPI != nil {
+			ca.statusAPI.shutdown()
+			ca.statusAPI = nil
+		}
+		if err = ca.StartStatusAPI(); err != nil {
+			log.WithError(err).Error()
+		}
+	}
+
+	log.Infof("config reloaded from %s", ca.ConfigLocation)
+	return nil
+}
@@ -0,0 +1,68 @@
+package cagent
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadConfig(t *testing.T) {
+	tmpFile, err := ioutil.TempFile("", "cagent.conf")
+	assert.NoError(t, err)
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	writeConfig := func(content string) {
+		assert.NoError(t, ioutil.WriteFile(tmpFile.Name(), []byte(content), 0644))
+	}
+
+	writeConfig("log_level = \"error\"\ninterval = 90.0\n")
+	cfg, err := HandleAllConfigSetup(tmpFile.Name())
+	assert.NoError(t, err)
+
+	ca := &Cagent{Config: cfg, ConfigLocation: tmpFile.Name()}
+	cpuWatcher := &CPUWatcher{}
+	ca.cpuWatcher = cpuWatcher
+	ca.GetFileSystemWatcher()
+
+	t.Run("valid", func(t *testing.T) {
+		writeConfig("log_level = \"debug\"\ninterval = 30.0\n")
+		assert.NoError(t, ca.ReloadConfig())
+
+		assert.Equal(t, LogLevelDebug, ca.Config.LogLevel)
+		assert.Equal(t, 30.0, ca.Config.Interval)
+		assert.Nil(t, ca.fsWatcher)
+		assert.True(t, ca.cpuWatcher == cpuWatcher, "cpu watcher must be preserved")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		writeConfig("log_level = \"debug\"\ninterval = 30.0\noperation_mode = \"unknown\"\n")
+		assert.Error(t, ca.ReloadConfig())
+		assert.Equal(t, 30.0, ca.Config.Interval)
+		assert.Equal(t, OperationModeFull, ca.Config.OperationMode)
+	})
+
+	t.Run("collector still running", func(t *testing.T) {
+		defer func(timeout time.Duration) { reloadWaitTimeout = timeout }(reloadWaitTimeout)
+		reloadWaitTimeout = 0
+
+		ca.schedule.start("net", time.Now())
+		writeConfig("log_level = \"debug\"\ninterval = 60.0\n")
+		err := ca.ReloadConfig()
+		assert.EqualError(t, err, "keeping the current config: collectors net are still running")
+		assert.Equal(t, 30.0, ca.Config.Interval)
+
+		ca.schedule.finish("net")
+		assert.NoError(t, ca.ReloadConfig())
+		assert.Equal(t, 60.0, ca.Config.Interval)
+	})
+
+	t.Run("heartbeat mode requires restart", func(t *testing.T) {
+		writeConfig("operation_mode = \"heartbeat\"\n")
+		assert.NoError(t, ca.ReloadConfig())
+		assert.Equal(t, OperationModeFull, ca.Config.OperationMode)
+	})
+}
@@ -0,0 +1,24 @@
+package cagent
+
+import (
+	"time"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring"
+	"github.com/cloudradar-monitoring/cagent/pkg/monitoring/rules"
+)
+
+func (ca *Cagent) getRulesEngine() *rules.Engine {
+	if ca.rulesEngine == nil {
+		ca.rulesEngine = rules.NewEngine(ca.Config.Rules)
+	}
+	return ca.rulesEngine
+}
+
+// evaluateRules appends the report of the threshold rules to the module reports
+func (ca *Cagent) evaluateRules(measurements common.MeasurementsMap, now time.Time) {
+	report := ca.getRulesEngine().Evaluate(measurements, now)
+
+	reports, _ := measurements["modules"].([]*monitoring.ModuleReport)
+	measurements["modules"] = append(reports, report)
+}
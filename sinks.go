@@ -0,0 +1,368 @@
+package cagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/export"
+	"github.com/cloudradar-monitoring/cagent/pkg/outbox"
+)
+
+const (
+	defaultGraphitePrefix = "cagent"
+	maxUDPPayloadSize     = 1400
+)
+
+// Sink delivers the measurement results to a single destination
+type Sink interface {
+	Write(ctx context.Context, result *Result) error
+	String() string
+}
+
+// outputSinks returns the sinks results of a run are delivered to.
+// outputFile set on the command line has a precedence, otherwise [[outputs]] are used.
+// Without any [[outputs]] configured the destination is chosen by io_mode
+func (ca *Cagent) outputSinks(outputFile *os.File) []Sink {
+	if outputFile != nil {
+		enc := resultEncoder{format: ca.Config.GetOutFormat(), graphitePrefix: defaultGraphitePrefix}
+		return []Sink{&writerSink{name: outputFile.Name(), w: outputFile, enc: enc}}
+	}
+
+	if len(ca.Config.Outputs) == 0 {
+		if ca.Config.IOMode == IOModePrometheus {
+			return []Sink{&prometheusSink{exporter: ca.prometheusExporter}}
+		}
+		return []Sink{ca.newHubSink()}
+	}
+
+	var sinks []Sink
+	for _, o := range ca.Config.Outputs {
+		if !o.IsEnabled() {
+			continue
+		}
+
+		var sink Sink
+		enc := resultEncoder{format: o.GetFormat(), graphitePrefix: o.GetPrefix()}
+		switch o.Type {
+		case OutputTypeHub:
+			// Hub delivery is retried by the main loop according to on_http_5xx_retries
+			sinks = append(sinks, ca.newHubSink())
+			continue
+		case OutputTypePrometheus:
+			sinks = append(sinks, &prometheusSink{exporter: ca.prometheusExporter})
+			continue
+		case OutputTypeFile:
+			sink = &fileSink{path: o.Path, enc: enc}
+		case OutputTypeStdout:
+			sink = &writerSink{name: "stdout", w: os.Stdout, enc: enc}
+		case OutputTypeWebhook:
+			sink = newWebhookSink(o.URL, o.Headers, enc, o.GetTimeout())
+		case OutputTypeTCP, OutputTypeUDP:
+			sink = &netSink{network: o.Type, address: o.Address, enc: enc, timeout: o.GetTimeout()}
+		default:
+			log.Errorf("unknown output type '%s'", o.Type)
+			continue
+		}
+
+		if o.Retries > 0 {
+			sink = &retryingSink{Sink: sink, retries: o.Retries, interval: secToDuration(o.RetryInterval)}
+		}
+		sinks = append(sinks, sink)
+	}
+
+	return sinks
+}
+
+// hubSinks filters out all sinks except the Hub one
+func hubSinks(sinks []Sink) []Sink {
+	var res []Sink
+	for _, s := range sinks {
+		if _, isHub := s.(*hubSink); isHub {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// hubSink keeps the config and the client it was created with, so it's used without holding the config lock
+type hubSink struct {
+	ca     *Cagent
+	cfg    *Config
+	client *http.Client
+	outbox *outbox.Outbox
+}
+
+func (ca *Cagent) newHubSink() *hubSink {
+	ca.initHubClientOnce()
+	return &hubSink{ca: ca, cfg: ca.Config, client: ca.hubClient, outbox: ca.getOutbox()}
+}
+
+func (s *hubSink) String() string {
+	return "hub"
+}
+
+func (s *hubSink) Write(ctx context.Context, result *Result) error {
+	ca := s.ca
+	if s.cfg.Logs.HubFile != "" {
+		ca.prettyPrintMeasurementsToFile(result.Measurements, s.cfg.Logs.HubFile)
+	}
+
+	err := ca.postResultToHub(ctx, s.cfg, s.client, result)
+	ca.runState.setHubResponse(err)
+	if err != nil {
+		if err == ErrHubTooManyRequests || err == ErrHubServerError || err == ErrHubUnauthorized {
+			return err
+		}
+		return errors.Wrap(err, "failed to POST measurement result to Hub")
+	}
+
+	return nil
+}
+
+// prometheusSink updates the exporter which was started with the config the sink was created with.
+// The exporter is nil if it failed to listen, that's reported once at the start
+type prometheusSink struct {
+	exporter *prometheusExporter
+}
+
+func (s *prometheusSink) String() string {
+	return "prometheus"
+}
+
+func (s *prometheusSink) Write(_ context.Context, result *Result) error {
+	if s.exporter == nil {
+		return errors.New("prometheus metrics are not served")
+	}
+	s.exporter.update(result)
+	return nil
+}
+
+// writerSink writes results to an already opened file, e.g. stdout or the file passed with -o
+type writerSink struct {
+	name string
+	w    io.Writer
+	enc  resultEncoder
+}
+
+func (s *writerSink) String() string {
+	return s.name
+}
+
+func (s *writerSink) Write(_ context.Context, result *Result) error {
+	return s.enc.encode(s.w, result)
+}
+
+// fileSink appends results to the file. The file is opened on every write, so it can be rotated
+type fileSink struct {
+	path string
+	enc  resultEncoder
+}
+
+func (s *fileSink) String() string {
+	return "file " + s.path
+}
+
+func (s *fileSink) Write(_ context.Context, result *Result) error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open output file")
+	}
+
+	err = s.enc.encode(f, result)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// webhookSink POSTs every result to the URL
+type webhookSink struct {
+	url     string
+	headers map[string]string
+	enc     resultEncoder
+	client  *http.Client
+}
+
+func newWebhookSink(url string, headers map[string]string, enc resultEncoder, timeout time.Duration) *webhookSink {
+	return &webhookSink{
+		url:     url,
+		headers: headers,
+		enc:     enc,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+		},
+	}
+}
+
+func (s *webhookSink) String() string {
+	return "webhook " + s.url
+}
+
+func (s *webhookSink) Write(ctx context.Context, result *Result) error {
+	buf := &bytes.Buffer{}
+	if err := s.enc.encode(buf, result); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", s.url, buf)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", s.enc.contentType())
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook replied with HTTP %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// retryingSink repeats failed writes to the underlying sink
+type retryingSink struct {
+	Sink
+	retries  int
+	interval time.Duration
+}
+
+func (s *retryingSink) Write(ctx context.Context, result *Result) error {
+	err := s.Sink.Write(ctx, result)
+	for attempt := 1; err != nil && attempt <= s.retries; attempt++ {
+		log.WithError(err).Infof("output %s failed %d/%d, retrying in %v", s.Sink.String(), attempt, s.retries, s.interval)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(s.interval):
+		}
+		err = s.Sink.Write(ctx, result)
+	}
+	return err
+}
+
+// netSink sends results over a TCP connection or as UDP datagrams, e.g. to Graphite or InfluxDB listeners
+type netSink struct {
+	network string
+	address string
+	enc     resultEncoder
+	timeout time.Duration
+}
+
+func (s *netSink) String() string {
+	return s.network + " " + s.address
+}
+
+func (s *netSink) Write(ctx context.Context, result *Result) error {
+	buf := &bytes.Buffer{}
+	if err := s.enc.encode(buf, result); err != nil {
+		return err
+	}
+
+	dialer := net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer conn.Close()
+
+	err = conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if s.network == OutputTypeTCP {
+		_, err = conn.Write(buf.Bytes())
+		return errors.WithStack(err)
+	}
+
+	// lines are packed into datagrams small enough to avoid fragmentation
+	for _, packet := range splitLines(buf.Bytes(), maxUDPPayloadSize) {
+		if _, err = conn.Write(packet); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// splitLines groups whole lines into chunks not exceeding maxSize. A line longer than maxSize is returned as a separate chunk
+func splitLines(b []byte, maxSize int) [][]byte {
+	var chunks [][]byte
+	start := 0
+	end := 0
+	for end < len(b) {
+		lineEnd := bytes.IndexByte(b[end:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(b)
+		} else {
+			lineEnd += end + 1
+		}
+
+		if lineEnd-start > maxSize && end > start {
+			chunks = append(chunks, b[start:end])
+			start = end
+		}
+		end = lineEnd
+	}
+
+	if end > start {
+		chunks = append(chunks, b[start:end])
+	}
+	return chunks
+}
+
+// resultEncoder serializes results in one of the output formats
+type resultEncoder struct {
+	format         string
+	graphitePrefix string
+}
+
+func (e resultEncoder) encode(w io.Writer, result *Result) error {
+	var err error
+	switch e.format {
+	case OutputFormatJSONPretty:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "    ")
+		err = enc.Encode(result)
+	case OutputFormatInflux:
+		err = export.WriteInflux(w, export.Samples(result.Measurements), result.Timestamp)
+	case OutputFormatGraphite:
+		err = export.WriteGraphite(w, export.Samples(result.Measurements), e.graphitePrefix, result.Timestamp)
+	default:
+		err = json.NewEncoder(w).Encode(result)
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode measurement result as %s", e.format)
+	}
+	return nil
+}
+
+func (e resultEncoder) contentType() string {
+	switch e.format {
+	case OutputFormatInflux, OutputFormatGraphite:
+		return "text/plain; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
@@ -0,0 +1,186 @@
+package cagent
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+)
+
+func TestReportMeasurementsFanOut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sinks")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var received []Result
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		var res Result
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&res))
+		received = append(received, res)
+	}))
+	defer webhook.Close()
+
+	failingWebhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failingWebhook.Close()
+
+	disabled := false
+	outFilePath := filepath.Join(dir, "results.json")
+	ca := &Cagent{Config: NewConfig()}
+	ca.Config.Outputs = []OutputConfig{
+		{Type: OutputTypeFile, Path: outFilePath},
+		{Type: OutputTypeWebhook, URL: webhook.URL, Headers: map[string]string{"X-Token": "secret"}},
+		{Type: OutputTypeWebhook, URL: failingWebhook.URL, Retries: 1},
+		{Type: OutputTypeStdout, Enabled: &disabled},
+	}
+
+	sinks := ca.outputSinks(nil)
+	assert.Len(t, sinks, 3)
+
+	result := &Result{Timestamp: 1, Measurements: common.MeasurementsMap{"cagent.success": 1}}
+	hubErr, sinksErr := ca.reportMeasurements(result, sinks)
+	// a failed webhook is not retried by the main loop
+	assert.NoError(t, hubErr)
+	if assert.Error(t, sinksErr) {
+		assert.True(t, strings.Contains(sinksErr.Error(), "output webhook "+failingWebhook.URL))
+	}
+
+	if assert.Len(t, received, 1) {
+		assert.Equal(t, int64(1), received[0].Timestamp)
+	}
+
+	b, err := ioutil.ReadFile(outFilePath)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"timestamp":1,"measurements":{"cagent.success":1},"message":null}`+"\n", string(b))
+}
+
+func TestReportMeasurementsReplaysOutbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var timestamps []int64
+	hub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var res Result
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&res))
+		timestamps = append(timestamps, res.Timestamp)
+	}))
+	defer hub.Close()
+
+	ca := &Cagent{Config: NewConfig()}
+	ca.Config.HubURL = hub.URL
+	ca.Config.HubGzip = false
+	ca.Config.Outbox.Enabled = true
+	ca.Config.Outbox.DirPath = dir
+	// entries older than max_age are dropped
+	since := time.Now().Unix() - 3600
+	for i := 0; i < maxOutboxReplayEntries+2; i++ {
+		assert.NoError(t, ca.storeInOutbox(&Result{Timestamp: since + int64(i)}))
+	}
+
+	// the current result is sent first, then only a part of the backlog
+	result := &Result{Timestamp: since + 3600, Measurements: common.MeasurementsMap{"cagent.success": 1}}
+	hubErr, sinksErr := ca.reportMeasurements(result, ca.outputSinks(nil))
+	assert.NoError(t, hubErr)
+	assert.NoError(t, sinksErr)
+	if assert.Len(t, timestamps, maxOutboxReplayEntries+1) {
+		assert.Equal(t, since+3600, timestamps[0])
+		assert.Equal(t, since, timestamps[1])
+	}
+
+	entries, err := ca.getOutbox().Entries()
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestOutputSinksFallbackToIOMode(t *testing.T) {
+	ca := &Cagent{Config: NewConfig()}
+
+	sinks := ca.outputSinks(nil)
+	if assert.Len(t, sinks, 1) {
+		assert.Equal(t, "hub", sinks[0].String())
+	}
+
+	ca.Config.IOMode = IOModePrometheus
+	sinks = ca.outputSinks(nil)
+	if assert.Len(t, sinks, 1) {
+		assert.Equal(t, "prometheus", sinks[0].String())
+		// the exporter is started along with the config, not by the sink
+		assert.Error(t, sinks[0].Write(context.Background(), &Result{}))
+		assert.Nil(t, ca.prometheusExporter)
+	}
+
+	sinks = ca.outputSinks(os.Stdout)
+	if assert.Len(t, sinks, 1) {
+		assert.Equal(t, os.Stdout.Name(), sinks[0].String())
+	}
+}
+
+func TestNetSinkTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer conn.Close()
+		b, _ := ioutil.ReadAll(conn)
+		received <- string(b)
+	}()
+
+	sink := &netSink{
+		network: OutputTypeTCP,
+		address: listener.Addr().String(),
+		enc:     resultEncoder{format: OutputFormatGraphite, graphitePrefix: "cagent"},
+		timeout: time.Second,
+	}
+	result := &Result{Timestamp: 1546300800, Measurements: common.MeasurementsMap{"mem.used_percent": 42.5}}
+	assert.NoError(t, sink.Write(context.Background(), result))
+
+	assert.Equal(t, "cagent.mem.used_percent 42.5 1546300800\n", <-received)
+}
+
+func TestWebhookSinkInflux(t *testing.T) {
+	var body, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		contentType = r.Header.Get("Content-Type")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := newWebhookSink(server.URL+"/write?db=cagent", nil, resultEncoder{format: OutputFormatInflux}, time.Second)
+	result := &Result{Timestamp: 1546300800, Measurements: common.MeasurementsMap{"net.in_B_per_s.eth0": 100}}
+	assert.NoError(t, sink.Write(context.Background(), result))
+
+	assert.Equal(t, "cagent_net,interface=eth0 in_B_per_s=100 1546300800000000000\n", body)
+	assert.Equal(t, "text/plain; charset=utf-8", contentType)
+}
+
+func TestSplitLines(t *testing.T) {
+	chunks := splitLines([]byte("aaa\nbbb\ncccccc\nd\n"), 8)
+	var res []string
+	for _, c := range chunks {
+		res = append(res, string(c))
+	}
+	assert.Equal(t, []string{"aaa\nbbb\n", "cccccc\n", "d\n"}, res)
+}
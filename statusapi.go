@@ -0,0 +1,256 @@
+package cagent
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	statusAPIShutdownTimeout = 5 * time.Second
+	bearerPrefix             = "Bearer "
+)
+
+// runState keeps track of what the main loop is doing, it's exposed by the status API
+type runState struct {
+	mu sync.RWMutex
+
+	startedAt       time.Time
+	lastCollectedAt time.Time
+	lastResult      *Result
+
+	lastHubResponseAt time.Time
+	lastHubError      string
+
+	retries   int
+	nextRunAt time.Time
+}
+
+type statusResponse struct {
+	OperationMode   string           `json:"operation_mode"`
+	StartedAt       int64            `json:"started_at"`
+	LastCollectedAt int64            `json:"last_collected_at,omitempty"`
+	LastHubResponse *hubResponseInfo `json:"last_hub_response,omitempty"`
+	Retries         int              `json:"retries"`
+	NextRunAt       int64            `json:"next_run_at,omitempty"`
+}
+
+type hubResponseInfo struct {
+	Timestamp int64  `json:"timestamp"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (s *runState) setCollected(result *Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastCollectedAt = time.Now()
+	s.lastResult = result
+}
+
+func (s *runState) setHubResponse(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastHubResponseAt = time.Now()
+	s.lastHubError = ""
+	if err != nil {
+		s.lastHubError = err.Error()
+	}
+}
+
+func (s *runState) setSchedule(retries int, retryIn time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.retries = retries
+	s.nextRunAt = time.Now().Add(retryIn)
+}
+
+// statusAPI is the local HTTP API to inspect and control the running agent
+type statusAPI struct {
+	server *http.Server
+	token  string
+}
+
+// StartStatusAPI starts serving the status API if it's enabled in the config
+func (ca *Cagent) StartStatusAPI() error {
+	cfg := ca.currentConfig().StatusAPI
+	if !cfg.Enabled {
+		return nil
+	}
+
+	var listener net.Listener
+	var err error
+	if cfg.Socket != "" {
+		listener, err = listenUnixSocket(cfg.Socket)
+	} else {
+		listener, err = net.Listen("tcp", cfg.Listen)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to start status API")
+	}
+
+	api := &statusAPI{token: cfg.Token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", api.authorized(ca.handleStatus))
+	mux.HandleFunc("/last", api.authorized(ca.handleLast))
+	mux.HandleFunc("/collect", api.authorized(ca.handleCollect))
+	mux.HandleFunc("/health", api.authorized(ca.handleHealth))
+	api.server = &http.Server{Handler: mux}
+
+	go func() {
+		err := api.server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Error("status API stopped")
+		}
+	}()
+
+	log.Infof("status API listening on %s", listener.Addr().String())
+	ca.statusAPI = api
+	return nil
+}
+
+func listenUnixSocket(path string) (net.Listener, error) {
+	// the socket file is left behind when the agent was killed
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// limit access to the user and the group of the agent
+	if err = os.Chmod(path, 0660); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+func (api *statusAPI) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if api.token != "" {
+			header := r.Header.Get("Authorization")
+			if !strings.HasPrefix(header, bearerPrefix) ||
+				subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, bearerPrefix)), []byte(api.token)) != 1 {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+func (api *statusAPI) shutdown() {
+	ctx, cancel := context.WithTimeout(context.Background(), statusAPIShutdownTimeout)
+	defer cancel()
+
+	if err := api.server.Shutdown(ctx); err != nil {
+		log.WithError(err).Warn("failed to shutdown status API")
+	}
+}
+
+func (ca *Cagent) handleStatus(w http.ResponseWriter, r *http.Request) {
+	cfg := ca.currentConfig()
+	s := &ca.runState
+	s.mu.RLock()
+	resp := statusResponse{
+		OperationMode:   cfg.OperationMode,
+		StartedAt:       s.startedAt.Unix(),
+		LastCollectedAt: unixOrZero(s.lastCollectedAt),
+		Retries:         s.retries,
+		NextRunAt:       unixOrZero(s.nextRunAt),
+	}
+	if !s.lastHubResponseAt.IsZero() {
+		resp.LastHubResponse = &hubResponseInfo{
+			Timestamp: s.lastHubResponseAt.Unix(),
+			Success:   s.lastHubError == "",
+			Error:     s.lastHubError,
+		}
+	}
+	s.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (ca *Cagent) handleLast(w http.ResponseWriter, r *http.Request) {
+	ca.runState.mu.RLock()
+	result := ca.runState.lastResult
+	ca.runState.mu.RUnlock()
+
+	if result == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "nothing collected yet"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (ca *Cagent) handleCollect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+		return
+	}
+
+	if ca.currentConfig().OperationMode == OperationModeHeartbeat {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "measurements are not collected in heartbeat mode"})
+		return
+	}
+
+	select {
+	case ca.collectNow <- struct{}{}:
+	default:
+		// the collection is already requested
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "collection triggered"})
+}
+
+func (ca *Cagent) handleHealth(w http.ResponseWriter, r *http.Request) {
+	cfg := ca.currentConfig()
+	ca.runState.mu.RLock()
+	lastActivity := ca.runState.lastCollectedAt
+	if lastActivity.IsZero() {
+		lastActivity = ca.runState.startedAt
+	}
+	ca.runState.mu.RUnlock()
+
+	// reporting may take up to 5 minutes in addition to the interval
+	maxInactivity := 3*secToDuration(cfg.Interval) + 5*time.Minute
+	if cfg.OperationMode != OperationModeHeartbeat && time.Since(lastActivity) > maxInactivity {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "stalled"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithError(err).Debug("status API: failed to write response")
+	}
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,97 @@
+package cagent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudradar-monitoring/cagent/pkg/common"
+)
+
+func TestStatusAPIHandlers(t *testing.T) {
+	ca := &Cagent{Config: NewConfig(), collectNow: make(chan struct{}, 1)}
+	ca.runState.startedAt = time.Now()
+
+	t.Run("token", func(t *testing.T) {
+		api := &statusAPI{token: "secret"}
+		handler := api.authorized(ca.handleHealth)
+
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("GET", "/health", nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		// the scheme is required
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set("Authorization", "secret")
+		rec = httptest.NewRecorder()
+		handler(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		req = httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec = httptest.NewRecorder()
+		handler(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+
+	t.Run("last", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		ca.handleLast(rec, httptest.NewRequest("GET", "/last", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+
+		ca.runState.setCollected(&Result{Timestamp: 10, Measurements: common.MeasurementsMap{"cagent.success": 1}})
+		rec = httptest.NewRecorder()
+		ca.handleLast(rec, httptest.NewRequest("GET", "/last", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `{"timestamp":10,"measurements":{"cagent.success":1},"message":null}`+"\n", rec.Body.String())
+	})
+
+	t.Run("collect", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		ca.handleCollect(rec, httptest.NewRequest("GET", "/collect", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+		for i := 0; i < 2; i++ {
+			rec = httptest.NewRecorder()
+			ca.handleCollect(rec, httptest.NewRequest("POST", "/collect", nil))
+			assert.Equal(t, http.StatusAccepted, rec.Code)
+		}
+		assert.Len(t, ca.collectNow, 1)
+	})
+
+	t.Run("status", func(t *testing.T) {
+		ca.runState.setHubResponse(ErrHubServerError)
+		ca.runState.setSchedule(2, 0)
+
+		rec := httptest.NewRecorder()
+		ca.handleStatus(rec, httptest.NewRequest("GET", "/status", nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var resp statusResponse
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		assert.Equal(t, OperationModeFull, resp.OperationMode)
+		assert.Equal(t, 2, resp.Retries)
+		if assert.NotNil(t, resp.LastHubResponse) {
+			assert.False(t, resp.LastHubResponse.Success)
+			assert.Equal(t, ErrHubServerError.Error(), resp.LastHubResponse.Error)
+		}
+	})
+}
+
+func TestStatusAPIConfigValidate(t *testing.T) {
+	for listen, valid := range map[string]bool{
+		"127.0.0.1:9908": true,
+		"localhost:9908": true,
+		"[::1]:9908":     true,
+		"0.0.0.0:9908":   false,
+		"10.0.0.1:9908":  false,
+		"9908":           false,
+	} {
+		cfg := StatusAPIConfig{Enabled: true, Listen: listen}
+		assert.Equal(t, valid, cfg.Validate() == nil, listen)
+	}
+}